@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// addCommand saves a single bookmark. Its URL is canonicalized like an
+// imported one, so adding a link with tracking parameters that is already
+// saved without them reports the saved bookmark. Without --title the page
+// is fetched for its title, and for its description when no --note is
+// given either; when that fails the host name stands in for the title.
+func addCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	title := fs.String("title", "", "title of the bookmark")
+	note := fs.String("note", "", "note to save with it")
+	tags := fs.String("tag", "", "comma-separated tags")
+	expand := fs.Bool("expand", false, "save the final URL of a t.co, bit.ly or other short link")
+	noFetch := fs.Bool("no-fetch", false, "do not fetch the page for a title and description")
+
+	uris := parseInterspersed(fs, args)
+	if len(uris) != 1 || strings.TrimSpace(uris[0]) == "" {
+		fmt.Println("Usage: importer-exporter add URL [--title TITLE] [--note NOTE] [--tag TAGS] [--expand] [--no-fetch]")
+		os.Exit(1)
+	}
+	now := time.Now().Unix()
+	job := Job{URI: strings.TrimSpace(uris[0]), Title: *title, Note: *note, Tags: splitTags(*tags), CreatedAt: now, UpdatedAt: now}
+	if *expand {
+		job = expandJob(&http.Client{Timeout: 15 * time.Second}, job)
+	}
+	id, saved, err := addBookmark(db, job, !*noFetch)
+	if err != nil {
+		log.Fatalf("Failed to add %s: %v", job.URI, err)
+	}
+	if saved {
+		fmt.Printf("Already bookmarked as %d\n", id)
+		os.Exit(1)
+	}
+	fmt.Printf("Added %d\n", id)
+}
+
+// addBookmark saves job after applying the tag rules. With fetch, a
+// bookmark without a title is titled from its page, or its host when the
+// page cannot be read, and takes its note from the page description. When
+// the URL is already bookmarked, the ID of that bookmark is returned with
+// saved set.
+func addBookmark(db *sql.DB, job Job, fetch bool) (id int64, saved bool, err error) {
+	uri := job.URI
+	rules, err := loadTagRules(db)
+	if err != nil {
+		return 0, false, err
+	}
+	job = rules.apply(job)
+
+	err = db.QueryRow("SELECT id FROM bookmarks WHERE url IN (?, ?) AND deleted_at IS NULL",
+		uri, canonicalURL(uri, canonicalization)).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	} else if err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("failed to look up %s: %w", uri, err)
+	}
+
+	if job.Title == "" && fetch {
+		info, err := fetchPageInfo(&http.Client{Timeout: 5 * time.Second}, uri)
+		if err != nil {
+			log.Printf("Could not fetch the title of %s: %v", uri, err)
+		}
+		job.Title = info.Title
+		if job.Title == "" {
+			job.Title = hostTitle(uri)
+		}
+		if job.Note == "" {
+			job.Note = info.Description
+		}
+	}
+
+	if id, err = insertBookmark(db, job); err != nil {
+		return 0, false, err
+	}
+	if err := insertTags(db, id, job.Tags); err != nil {
+		return 0, false, fmt.Errorf("failed to tag %s: %w", uri, err)
+	}
+	return id, false, nil
+}
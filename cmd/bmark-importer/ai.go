@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The ai command asks a language model behind an OpenAI-compatible chat
+// completions endpoint, such as a local Ollama or llama.cpp server, to
+// summarize pages into notes or to pick tags for them. It is off unless an
+// endpoint is configured: nothing is sent anywhere without BMARK_AI_URL or
+// --api.
+
+const aiUsage = "Usage: importer-exporter ai summarize|tag [--api URL] [--model MODEL] [--dry-run] [--force] [--overwrite] [--max-tags 3] [--allow-new] ID...|QUERY..."
+
+// maxPromptText bounds how much page text is sent with each request.
+const maxPromptText = 12000
+
+type aiClient struct {
+	client *http.Client
+	api    string
+	model  string
+	key    string
+}
+
+// complete sends one system and one user message and returns the reply.
+func (c aiClient) complete(system, user string) (string, error) {
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	body := map[string]any{
+		"model": c.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+		"temperature": 0.2,
+	}
+	var header http.Header
+	if c.key != "" {
+		header = http.Header{"Authorization": {"Bearer " + c.key}}
+	}
+	if err := postJSON(c.client, c.api+"/chat/completions", header, body, &result); err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("no reply from the model")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+// aiCommand summarizes or tags the bookmarks given by ID or query.
+// summarize fills empty notes, or replaces notes with --overwrite; tag adds
+// up to --max-tags tags, chosen from those in use unless --allow-new.
+// Locked bookmarks are left alone unless forced, and every change is
+// recorded in the history.
+func aiCommand(db *sql.DB, args []string) {
+	if len(args) < 1 || args[0] != "summarize" && args[0] != "tag" {
+		fmt.Println(aiUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("ai "+args[0], flag.ExitOnError)
+	api := fs.String("api", os.Getenv("BMARK_AI_URL"), "OpenAI-compatible API base URL, e.g. http://localhost:11434/v1 ($BMARK_AI_URL)")
+	model := fs.String("model", os.Getenv("BMARK_AI_MODEL"), "model name ($BMARK_AI_MODEL)")
+	key := fs.String("key", os.Getenv("BMARK_AI_KEY"), "API key, if the endpoint needs one ($BMARK_AI_KEY)")
+	dryRun := fs.Bool("dry-run", false, "only show what the model suggests")
+	force := fs.Bool("force", false, "change locked bookmarks too")
+	overwrite := fs.Bool("overwrite", false, "summarize: replace existing notes")
+	maxTags := fs.Int("max-tags", 3, "tag: tags added per bookmark at most")
+	allowNew := fs.Bool("allow-new", false, "tag: accept tags that are not in use yet")
+	words := parseInterspersed(fs, args[1:])
+
+	if len(words) == 0 {
+		fmt.Println(aiUsage)
+		os.Exit(1)
+	}
+	if *api == "" || *model == "" {
+		log.Fatalf("AI features are off; set BMARK_AI_URL and BMARK_AI_MODEL, or pass --api and --model")
+	}
+	ai := aiClient{client: &http.Client{Timeout: 2 * time.Minute}, api: strings.TrimSuffix(*api, "/"), model: *model, key: *key}
+
+	var bookmarks []Bookmark
+	var err error
+	if allIDs(words) {
+		bookmarks, err = selectBookmarks(db, words, "")
+	} else {
+		filter := bookmarkFilter{Query: strings.Join(words, " ")}
+		if _, err := compileQuery(filter.Query); err != nil {
+			log.Fatalf("Invalid query: %v", err)
+		}
+		err = forEachBookmark(db, filter, func(b Bookmark) error {
+			bookmarks = append(bookmarks, b)
+			return nil
+		})
+	}
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if args[0] == "summarize" && !*overwrite {
+		bookmarks = slices.DeleteFunc(bookmarks, func(b Bookmark) bool { return strings.TrimSpace(b.Note) != "" })
+	}
+	if len(bookmarks) == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+	vocabulary, err := tagVocabulary(db)
+	if err != nil {
+		log.Fatalf("Failed to read tags: %v", err)
+	}
+
+	changed, failed, kept := 0, 0, 0
+	for _, b := range bookmarks {
+		if locked[b.ID] && !*force && !*dryRun {
+			kept++
+			continue
+		}
+		text, err := promptText(db, b)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", b.URI, err)
+			failed++
+			continue
+		}
+
+		switch args[0] {
+		case "summarize":
+			summary, err := ai.complete("You summarize web pages for a bookmark manager. "+
+				"Reply with two or three plain sentences saying what the page is about, without preamble.", text)
+			if err != nil {
+				log.Printf("Failed to summarize %s: %v", b.URI, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%d\t%s\n  %s\n", b.ID, b.URI, summary)
+			if *dryRun {
+				continue
+			}
+			err = inTagTx(db, *force, func(tx *sql.Tx) error {
+				if err := saveRevision(tx, b.ID); err != nil {
+					return err
+				}
+				_, err := tx.Exec("UPDATE bookmarks SET note = ?, updated_at = ? WHERE id = ?", summary, time.Now().Unix(), b.ID)
+				return err
+			})
+			if err != nil {
+				log.Fatalf("Failed to store summary of %s: %v", b.URI, err)
+			}
+		case "tag":
+			system := fmt.Sprintf("You tag web pages for a bookmark manager. Reply with at most %d lowercase tags, "+
+				"separated by commas and nothing else.", *maxTags)
+			if len(vocabulary) > 0 {
+				system += " Prefer these tags, most used first: " + strings.Join(vocabulary, ", ")
+			}
+			reply, err := ai.complete(system, text)
+			if err != nil {
+				log.Printf("Failed to tag %s: %v", b.URI, err)
+				failed++
+				continue
+			}
+			var add []string
+			for _, tag := range splitTags(strings.ToLower(reply)) {
+				if len(add) < *maxTags && !slices.Contains(b.Tags, tag) && !slices.Contains(add, tag) &&
+					(*allowNew || slices.Contains(vocabulary, tag)) {
+					add = append(add, tag)
+				}
+			}
+			if len(add) == 0 {
+				continue
+			}
+			fmt.Printf("%d\t%s\t+%s\n", b.ID, b.URI, strings.Join(add, ",+"))
+			if *dryRun {
+				continue
+			}
+			if err := addSuggestedTags(db, b.ID, add, *force); err != nil {
+				log.Fatalf("Failed to tag %s: %v", b.URI, err)
+			}
+		}
+		changed++
+	}
+	if kept > 0 {
+		fmt.Printf("Keeping %d locked bookmark(s), use --force to change them too\n", kept)
+	}
+	if !*dryRun {
+		fmt.Printf("Changed %d bookmark(s)\n", changed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// promptText describes a bookmark to the model: its title, URL and note,
+// and the text of its archived page, or of the live page when it has not
+// been archived.
+func promptText(db *sql.DB, b Bookmark) (string, error) {
+	var text string
+	err := db.QueryRow("SELECT text FROM page_texts WHERE bookmark_id = ?", b.ID).Scan(&text)
+	if err == sql.ErrNoRows {
+		page, _, fetchErr := fetchHTML(&http.Client{Timeout: 15 * time.Second}, b.URI)
+		if fetchErr != nil {
+			return "", fetchErr
+		}
+		text, err = extractText(page), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(text) > maxPromptText {
+		text = strings.ToValidUTF8(text[:maxPromptText], "")
+	}
+	prompt := "Title: " + b.Title + "\nURL: " + b.URI + "\n"
+	if b.Note != "" {
+		prompt += "Note: " + b.Note + "\n"
+	}
+	return prompt + "\n" + text, nil
+}
+
+// tagVocabulary returns the tags in use, most used first, at most 200.
+func tagVocabulary(db *sql.DB) ([]string, error) {
+	counts := make(map[string]int)
+	err := forEachBookmark(db, bookmarkFilter{}, func(b Bookmark) error {
+		for _, tag := range b.Tags {
+			if tag != deadTag {
+				counts[tag]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	return tags[:min(len(tags), 200)], nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const archiveOrgUsage = "Usage: importer-exporter archive-org save [--key ACCESS:SECRET] [--again] [--delay 10s] [QUERY...] | index [--again] [QUERY...]"
+
+// archiveOrgCommand works with snapshots of bookmarked pages on the
+// Internet Archive. The subcommand save asks the Save Page Now service to
+// capture each matching bookmark and stores the snapshot URL, which
+// "open --archived" opens when the live page is gone, and indexes the
+// text of the snapshot for "search --content"; index does the latter for
+// snapshots saved before. Bookmarks that already have a snapshot, or whose
+// snapshot is indexed, are skipped unless --again is given.
+func archiveOrgCommand(db *sql.DB, args []string) {
+	if len(args) < 1 || args[0] != "save" && args[0] != "index" {
+		fmt.Println(archiveOrgUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("archive-org "+args[0], flag.ExitOnError)
+	api := fs.String("api", envOr("BMARK_ARCHIVE_ORG_URL", "https://web.archive.org"), "Wayback Machine base URL ($BMARK_ARCHIVE_ORG_URL)")
+	key := fs.String("key", os.Getenv("ARCHIVE_ORG_KEY"), "S3 API keys as ACCESS:SECRET, for the authenticated API (default $ARCHIVE_ORG_KEY)")
+	again := fs.Bool("again", false, "redo bookmarks that already have a snapshot, or for index an indexed one")
+	delay := fs.Duration("delay", 10*time.Second, "time between captures, to stay below the rate limit")
+	timeout := fs.Duration("timeout", 5*time.Minute, "time to wait for each capture")
+	words := parseInterspersed(fs, args[1:])
+
+	filter := bookmarkFilter{Query: strings.Join(words, " ")}
+	if filter.Query != "" {
+		if _, err := compileQuery(filter.Query); err != nil {
+			log.Fatalf("Invalid query: %v", err)
+		}
+	}
+	saved, err := snapshotURLs(db)
+	if err != nil {
+		log.Fatalf("Failed to read snapshots: %v", err)
+	}
+	indexed := make(map[int64]bool)
+	err = queryEach(db, "SELECT bookmark_id FROM page_texts", func(rows *sql.Rows) error {
+		var id int64
+		err := rows.Scan(&id)
+		indexed[id] = true
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to read indexed pages: %v", err)
+	}
+	var bookmarks []Bookmark
+	err = forEachBookmark(db, filter, func(b Bookmark) error {
+		if args[0] == "index" && saved[b.ID] != "" && (*again || !indexed[b.ID]) ||
+			args[0] == "save" && (strings.HasPrefix(b.URI, "http://") || strings.HasPrefix(b.URI, "https://")) && (*again || saved[b.ID] == "") {
+			bookmarks = append(bookmarks, b)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(bookmarks) == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+
+	spn := savePageNow{
+		client:  &http.Client{Timeout: time.Minute},
+		api:     strings.TrimSuffix(*api, "/"),
+		key:     *key,
+		timeout: *timeout,
+	}
+	if args[0] == "index" {
+		indexSnapshots(db, spn.client, bookmarks, saved)
+		return
+	}
+	failed := 0
+	for i, b := range bookmarks {
+		if i > 0 {
+			time.Sleep(*delay)
+		}
+		snapshot, err := spn.save(b.URI)
+		if err != nil {
+			log.Printf("Failed to save %s: %v", b.URI, err)
+			failed++
+			continue
+		}
+		// Storing a snapshot is bookkeeping, so locked bookmarks get one too.
+		err = inTagTx(db, true, func(tx *sql.Tx) error {
+			_, err := tx.Exec("UPDATE bookmarks SET snapshot_url = ? WHERE id = ?", snapshot, b.ID)
+			return err
+		})
+		if err != nil {
+			log.Fatalf("Failed to store snapshot of %s: %v", b.URI, err)
+		}
+		fmt.Printf("%d\t%s\n", b.ID, snapshot)
+		if err := indexSnapshot(db, spn.client, b.ID, snapshot); err != nil {
+			log.Printf("Failed to index %s, try archive-org index later: %v", snapshot, err)
+		}
+	}
+	fmt.Printf("Saved %d of %d bookmark(s)\n", len(bookmarks)-failed, len(bookmarks))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func indexSnapshots(db *sql.DB, client *http.Client, bookmarks []Bookmark, snapshots map[int64]string) {
+	failed := 0
+	for _, b := range bookmarks {
+		if err := indexSnapshot(db, client, b.ID, snapshots[b.ID]); err != nil {
+			log.Printf("Failed to index %s: %v", snapshots[b.ID], err)
+			failed++
+			continue
+		}
+		fmt.Printf("%d\t%s\n", b.ID, snapshots[b.ID])
+	}
+	fmt.Printf("Indexed %d of %d snapshot(s)\n", len(bookmarks)-failed, len(bookmarks))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func snapshotURLs(db *sql.DB) (map[int64]string, error) {
+	snapshots := make(map[int64]string)
+	err := queryEach(db, "SELECT id, snapshot_url FROM bookmarks WHERE snapshot_url IS NOT NULL", func(rows *sql.Rows) error {
+		var id int64
+		var snapshot string
+		err := rows.Scan(&id, &snapshot)
+		snapshots[id] = snapshot
+		return err
+	})
+	return snapshots, err
+}
+
+// savePageNow is a client of the Save Page Now service. With keys it uses
+// the authenticated API, which queues a capture and is polled until the
+// capture is done; without, it uses the anonymous GET /save/URL.
+type savePageNow struct {
+	client  *http.Client
+	api     string
+	key     string
+	timeout time.Duration
+}
+
+// save captures uri and returns the URL of the snapshot.
+func (s savePageNow) save(uri string) (string, error) {
+	if s.key == "" {
+		return s.saveAnonymously(uri)
+	}
+
+	var job struct {
+		JobID   string `json:"job_id"`
+		Message string `json:"message"`
+	}
+	req, err := http.NewRequest("POST", s.api+"/save", strings.NewReader(url.Values{"url": {uri}}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := s.do(req, &job); err != nil {
+		return "", err
+	}
+	if job.JobID == "" {
+		return "", fmt.Errorf("capture refused: %s", job.Message)
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+		var status struct {
+			Status      string `json:"status"`
+			Timestamp   string `json:"timestamp"`
+			OriginalURL string `json:"original_url"`
+			Message     string `json:"message"`
+		}
+		req, err := http.NewRequest("GET", s.api+"/save/status/"+url.PathEscape(job.JobID), nil)
+		if err != nil {
+			return "", err
+		}
+		if err := s.do(req, &status); err != nil {
+			return "", err
+		}
+		switch status.Status {
+		case "pending":
+		case "success":
+			if status.OriginalURL == "" {
+				status.OriginalURL = uri
+			}
+			return s.api + "/web/" + status.Timestamp + "/" + status.OriginalURL, nil
+		default:
+			return "", fmt.Errorf("capture failed: %s", status.Message)
+		}
+	}
+	return "", fmt.Errorf("capture not done after %s", s.timeout)
+}
+
+func (s savePageNow) do(req *http.Request, result any) error {
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "LOW "+s.key)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// saveAnonymously captures uri without keys. The service answers once the
+// capture is done, redirecting to the snapshot or naming it in
+// Content-Location.
+func (s savePageNow) saveAnonymously(uri string) (string, error) {
+	client := *s.client
+	client.Timeout = s.timeout
+	resp, err := client.Get(s.api + "/save/" + uri)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if strings.HasPrefix(resp.Request.URL.Path, "/web/") {
+		return resp.Request.URL.String(), nil
+	}
+	if location := resp.Header.Get("Content-Location"); strings.HasPrefix(location, "/web/") {
+		return s.api + location, nil
+	}
+	return "", fmt.Errorf("no snapshot in the response")
+}
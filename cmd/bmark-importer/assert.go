@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// assertCommand counts the bookmarks matching a query and exits with
+// status 1 when the count is outside --min and --max, so curated link
+// lists can be checked in CI.
+func assertCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("assert", flag.ExitOnError)
+	query := fs.String("query", "", "terms such as tag:docs -tag:draft domain:go.dev since:2024-01-01 until:2024-12-31")
+	minCount := fs.Int("min", -1, "fail if fewer bookmarks match")
+	maxCount := fs.Int("max", -1, "fail if more bookmarks match")
+	quiet := fs.Bool("quiet", false, "do not list offending bookmarks")
+	fs.Parse(args)
+
+	if *minCount < 0 && *maxCount < 0 {
+		fmt.Println("Usage: importer-exporter assert --query QUERY [--min N] [--max N]")
+		os.Exit(2)
+	}
+
+	filter, err := parseFilterQuery(*query)
+	if err != nil {
+		log.Printf("Invalid --query: %v", err)
+		os.Exit(2)
+	}
+
+	var matches []Bookmark
+	err = forEachBookmark(db, filter, func(b Bookmark) error {
+		matches = append(matches, b)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to read bookmarks: %v", err)
+		os.Exit(2)
+	}
+
+	count := len(matches)
+	switch {
+	case *maxCount >= 0 && count > *maxCount:
+		fmt.Printf("FAIL: %d bookmarks match %q, expected at most %d\n", count, *query, *maxCount)
+		if !*quiet {
+			for _, b := range matches {
+				fmt.Printf("  %d %s\n", b.ID, b.URI)
+			}
+		}
+		os.Exit(1)
+	case *minCount >= 0 && count < *minCount:
+		fmt.Printf("FAIL: %d bookmarks match %q, expected at least %d\n", count, *query, *minCount)
+		os.Exit(1)
+	}
+	fmt.Printf("OK: %d bookmarks match %q\n", count, *query)
+}
+
+// parseFilterQuery turns space-separated key:value terms into a filter.
+// All terms must match.
+func parseFilterQuery(query string) (bookmarkFilter, error) {
+	var filter bookmarkFilter
+	for _, term := range strings.Fields(query) {
+		key, value, ok := strings.Cut(term, ":")
+		if !ok || value == "" {
+			return filter, fmt.Errorf("%q is not a key:value term", term)
+		}
+		var err error
+		switch key {
+		case "tag":
+			filter.Tags = append(filter.Tags, value)
+		case "-tag":
+			filter.ExcludeTags = append(filter.ExcludeTags, value)
+		case "domain":
+			filter.Domain = strings.ToLower(value)
+		case "since":
+			filter.Since, err = parseDateFlag(value, false)
+		case "until":
+			filter.Until, err = parseDateFlag(value, true)
+		case "health":
+			return filter, fmt.Errorf("health: terms need link check results, which are not recorded yet")
+		default:
+			return filter, fmt.Errorf("unknown term %q, use tag, -tag, domain, since or until", key)
+		}
+		if err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
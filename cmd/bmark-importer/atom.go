@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultAtomLimit = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    string         `xml:"summary,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+// writeAtom writes an Atom feed of the most recently added bookmarks,
+// newest first, so other people or devices can subscribe to them. The
+// feed is limited to 50 entries unless --limit says otherwise.
+func writeAtom(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	filter := opts.Filter
+	filter.NewestFirst = true
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAtomLimit
+	}
+
+	feed := atomFeed{
+		ID:     "urn:bmark:bookmarks",
+		Title:  "Bookmarks",
+		Author: atomAuthor{Name: "bmark"},
+	}
+	if len(filter.Tags) > 0 {
+		feed.ID = "urn:bmark:tag:" + url.PathEscape(strings.Join(filter.Tags, ","))
+		feed.Title = "Bookmarks tagged " + strings.Join(filter.Tags, ", ")
+	}
+
+	var bookmarks []Bookmark
+	err := forEachBookmark(db, filter, func(b Bookmark) error {
+		bookmarks = append(bookmarks, b)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(bookmarks), encodeAtom(out, feed, bookmarks)
+}
+
+// encodeAtom writes feed with an entry for each bookmark.
+func encodeAtom(out io.Writer, feed atomFeed, bookmarks []Bookmark) error {
+	var updated int64
+	for _, b := range bookmarks {
+		title := b.Title
+		if title == "" {
+			title = b.URI
+		}
+		entry := atomEntry{
+			ID:        b.URI,
+			Title:     title,
+			Link:      atomLink{Href: b.URI},
+			Published: formatTime(b.CreatedAt),
+			Updated:   formatTime(b.UpdatedAt),
+			Summary:   b.Note,
+		}
+		for _, tag := range b.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+		updated = max(updated, b.UpdatedAt)
+	}
+	if updated == 0 {
+		updated = time.Now().Unix()
+	}
+	feed.Updated = formatTime(updated)
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
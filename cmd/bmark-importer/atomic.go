@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is written under a temporary name in the directory of its
+// final path and only renamed over it by Commit. An interrupted or failed
+// export therefore leaves the previous file untouched instead of a
+// truncated one; at worst a hidden .tmp file is left next to it.
+type atomicFile struct {
+	*os.File
+	path string
+	done bool
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+
+	// CreateTemp makes files only the owner can read; keep the mode of
+	// the file being replaced, or use what os.Create would.
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &atomicFile{File: file, path: path}, nil
+}
+
+// Commit closes the file and moves it into place. With sync, the data and
+// then the rename are flushed to disk first, so a backup survives a power
+// cut right after the export finished.
+func (f *atomicFile) Commit(sync bool) error {
+	defer f.Abort()
+	if sync {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return err
+	}
+	f.done = true
+	if sync {
+		syncDir(filepath.Dir(f.path))
+	}
+	return nil
+}
+
+// Abort removes the temporary file unless it was committed. It is safe to
+// call more than once, which makes it suitable for defer.
+func (f *atomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// syncDir flushes a directory entry change. Not every platform can sync
+// a directory, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// writeFileAtomic is os.WriteFile through an atomicFile.
+func writeFileAtomic(path string, data []byte, sync bool) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit(sync)
+}
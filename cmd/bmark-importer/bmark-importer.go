@@ -1,28 +1,40 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"database/sql"
+	"flag"
 	"fmt"
-	"html"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 	"sync"
-	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 type Bookmark struct {
-	URI       string
-	Title     string
-	CreatedAt int64
-	UpdatedAt int64
-	Tags      []string
-	Note      string
+	ID         int64
+	URI        string
+	Title      string
+	CreatedAt  int64
+	UpdatedAt  int64
+	Tags       []string
+	Note       string
+	Private    bool
+	Unread     bool
+	Starred    bool
+	Archived   bool
+	Rating     int
+	Visits     int
+	DeletedAt  int64
+	LastVisit  int64
+	Keyword    string
+	FolderID   int64
+	ExternalID string
 }
 
 type Job struct {
@@ -32,76 +44,512 @@ type Job struct {
 	CreatedAt int64
 	UpdatedAt int64
 	Tags      []string
+	Private   bool
+	Unread    bool
+	Starred   bool
+	Archived  bool
+	Rating    int
+	LastVisit int64
+	Keyword   string
+	Folder    []string
+	IconURI   string
+	Icon      string
+	Recovered bool
+	// ExternalID is set when importing a bmark export; a bookmark which
+	// already carries it is updated in place instead of keyed by URL.
+	ExternalID string
+	// ShortURL is the short link the URI was expanded from.
+	ShortURL string
+	// SyncUnread updates the unread flag of an existing bookmark, for
+	// sources such as reading lists that track read state themselves.
+	SyncUnread bool
+}
+
+// htmlOptions controls how Netscape HTML files are interpreted.
+type htmlOptions struct {
+	// Folders is "ignore", "tags" (folder paths become hierarchical tags
+	// such as work/projects/go) or "table" (stored in the folders table).
+	Folders string
+}
+
+type Result struct {
+	Err       error
+	Recovered bool
+}
+
+func printUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  importer-exporter [--demo|--local] COMMAND ...")
+	fmt.Println("  importer-exporter --local pull|push [--tag TAG]")
+	fmt.Println("  importer-exporter add URL [--title TITLE] [--note NOTE] [--tag TAGS] [--expand] [--no-fetch]")
+	fmt.Println("  importer-exporter import [--format FORMAT] [--identity FILE] [--expand] <file>...")
+	fmt.Println("  importer-exporter export [--format FORMAT] [--fields LIST] [--template FILE] [--encrypt age:RECIPIENT|gpg:KEY] [output]")
+	fmt.Println("  importer-exporter export --split-by tag [--format FORMAT] DIR")
+	fmt.Println("  importer-exporter export site [--title TITLE] DIR")
+	fmt.Println("  importer-exporter export pinboard --token user:TOKEN [--tag TAG]")
+	fmt.Println("  importer-exporter export linkding --url URL --token TOKEN [--tag TAG]")
+	fmt.Println("  importer-exporter migrate [--yes] [--dry-run]")
+	fmt.Println("  importer-exporter du [--by tag|domain] [--limit N]")
+	fmt.Println("  importer-exporter stats [--limit N] [--months N] [--json]")
+	fmt.Println("  importer-exporter changelog enable|disable|export [file]")
+	fmt.Println("  importer-exporter verify-log [--head HASH]")
+	fmt.Println("  importer-exporter lock|unlock ID|URL...")
+	fmt.Println("  importer-exporter star|unstar ID|URL...")
+	fmt.Println("  importer-exporter archive|unarchive ID|URL...")
+	fmt.Println("  importer-exporter rate ID|URL 1-5|0")
+	fmt.Println("  importer-exporter mark-read|mark-unread ID|URL...")
+	fmt.Println("  importer-exporter list [-q QUERY] [--tag TAG] [--untagged] [--starred] [--unread] [--min-rating N] [--all] [--domain DOMAIN] [--since DATE] [--limit N] [--sort created|updated|title|visits]")
+	fmt.Println("  importer-exporter frequent [--limit N]")
+	fmt.Println("  importer-exporter domains [--limit N] [--all] [--by-name]")
+	fmt.Println("  importer-exporter report untagged | stale [--older-than 1y] [--never-visited] [--all] [--ids]")
+	fmt.Println("  importer-exporter search [--limit N] [--all] [--fuzzy|--regex|--content] WORD... [tag:TAG]")
+	fmt.Println("  importer-exporter enrich [--force] [--tag TAG] [--domain DOMAIN] [--query QUERY] [--concurrency N] [--per-host-delay 1s] [ID|URL...]")
+	fmt.Println("  importer-exporter archive-org save [--key ACCESS:SECRET] [--again] [--delay 10s] [QUERY...]")
+	fmt.Println("  importer-exporter archive-org index [--again] [QUERY...]")
+	fmt.Println("  importer-exporter favicons fetch [--ttl 720h] [--concurrency 8] [--force] [QUERY...]")
+	fmt.Println("  importer-exporter suggest-tags [--accept-top N] [--limit 5] [--dry-run] [--force] ID...|QUERY...")
+	fmt.Println("  importer-exporter ai summarize|tag [--api URL] [--model MODEL] [--dry-run] [--force] [--overwrite] [--max-tags 3] [--allow-new] ID...|QUERY...")
+	fmt.Println("  importer-exporter serve [--listen 127.0.0.1:8080] [--token TOKEN] [--owner NAME]")
+	fmt.Println("  importer-exporter token create --name NAME [--scopes read,write] [--user USER] | list | revoke ID|NAME...")
+	fmt.Println("  importer-exporter user add NAME | list | rm NAME")
+	fmt.Println("  importer-exporter publish|unpublish ID|URL...")
+	fmt.Println("  importer-exporter webhook add --url URL [--events add,delete,tag] [--secret S] | list | rm ID|URL... | test ID|URL [--user USER]")
+	fmt.Println("  importer-exporter check [--concurrency 20] [--timeout 15s] [--per-host-delay 1s] [--dead-after 3] [--fix-redirects [--yes] [--force]] [QUERY...]")
+	fmt.Println("  importer-exporter open [--print] [--archived] ID|KEYWORD|URL|TITLE... | --next-unread")
+	fmt.Println("  importer-exporter tag list | tree | rename OLD NEW | merge FROM... INTO | rm TAG... [--force] | prune | publish|unpublish TAG...")
+	fmt.Println("  importer-exporter retag --query QUERY | --from-tag TAGS [--add-tag TAGS] [--rm-tag TAGS] [--dry-run] [--force]")
+	fmt.Println("  importer-exporter rule add PATTERN TAGS [--retroactive] | list | rm ID... | apply [--dry-run] [--force]")
+	fmt.Println("  importer-exporter folder list | create PATH | move ID|URL... PATH [--force]")
+	fmt.Println("  importer-exporter edit ID|URL [--title TITLE] [--note NOTE] [--url URL] [--keyword KEYWORD] [--add-tag|--rm-tag|--set-tags TAGS] | --editor")
+	fmt.Println("  importer-exporter bulk-edit [--force] [QUERY... | -]")
+	fmt.Println("  importer-exporter rm [--yes] [--force] ID|URL... | --tag TAG | --domain DOMAIN")
+	fmt.Println("  importer-exporter history ID|URL")
+	fmt.Println("  importer-exporter revert ID|URL --to REVISION [--force]")
+	fmt.Println("  importer-exporter dedupe [--auto newest|oldest] [--dry-run] [--force] [--by-content]")
+	fmt.Println("  importer-exporter undo [--list]")
+	fmt.Println("  importer-exporter trash list | restore ID|URL... | empty [--older-than 30d] [--yes]")
+	fmt.Println("  importer-exporter assert --query QUERY [--min N] [--max N]")
+	fmt.Println("  importer-exporter sample [--tag TAG] [--n N] [--recent-bias]")
+	fmt.Println("  importer-exporter random [--tag TAG] [--domain DOMAIN] [--unread] [--all] [--open]")
+	fmt.Println("  importer-exporter translate [--to LANG] [--backend libretranslate|deepl] ID... | --query TEXT")
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage:")
-		fmt.Println("  importer-exporter import <bookmark.html>")
-		fmt.Println("  importer-exporter export [output.html]")
+	args := os.Args[1:]
+	var demo, local bool
+	for len(args) > 0 && (args[0] == "--demo" || args[0] == "--local") {
+		demo = demo || args[0] == "--demo"
+		local = local || args[0] == "--local"
+		args = args[1:]
+	}
+	if demo && local {
+		log.Fatalf("Use either --demo or --local, not both")
+	}
+
+	if len(args) < 1 {
+		printUsage()
 		os.Exit(1)
 	}
 
-	mode := os.Args[1]
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalf("Cannot find user home directory: %v", err)
+	mode := args[0]
+	var err error
+	if canonicalization, err = parseCanonicalization(os.Getenv("BMARK_CANONICALIZE")); err != nil {
+		log.Fatalf("Invalid BMARK_CANONICALIZE: %v", err)
+	}
+	var dbFile string
+	if demo {
+		dir, err := os.MkdirTemp("", "bmark-demo-")
+		if err != nil {
+			log.Fatalf("Failed to create demo profile: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		dbFile = filepath.Join(dir, "bookmark.db")
+	} else if local {
+		if dbFile, err = findLocalDatabase(); err != nil {
+			log.Fatalf("Cannot find project database: %v", err)
+		}
+	} else {
+		if dbFile, err = globalDatabasePath(); err != nil {
+			log.Fatalf("Cannot find user home directory: %v", err)
+		}
 	}
-	dbFile := filepath.Join(homeDir, ".local", "share", "bookmarks", "bookmark.db")
 
-	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_busy_timeout=5000", dbFile))
+	var db *sql.DB
+	if demo {
+		db, err = newDemoDatabase(dbFile)
+		fmt.Fprintf(os.Stderr, "Using a temporary demo profile at %s\n", dbFile)
+	} else {
+		db, err = openDatabase(dbFile)
+	}
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
 	defer db.Close()
 
-	db.SetMaxOpenConns(1)
-
-	if err := initializeDatabase(db); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	if journaledCommands[mode] {
+		if err := beginOperation(db, strings.Join(args, " ")); err != nil {
+			log.Fatalf("Failed to start operation: %v", err)
+		}
 	}
 
 	switch mode {
+	case "add":
+		addCommand(db, args[1:])
 	case "import":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: importer-exporter import <bookmark.html>")
-			os.Exit(1)
-		}
-		bookmarksFile := os.Args[2]
-		importBookmarks(db, bookmarksFile)
+		importBookmarks(db, args[1:])
 	case "export":
-		outputFile := "exported_bookmarks.html"
-		if len(os.Args) >= 3 {
-			outputFile = os.Args[2]
+		exportBookmarks(db, args[1:])
+	case "du":
+		diskUsage(db, dbFile, args[1:])
+	case "changelog":
+		changelogCommand(db, args[1:])
+	case "verify-log":
+		verifyLog(db, args[1:])
+	case "sample":
+		sampleBookmarks(db, args[1:])
+	case "translate":
+		translateCommand(db, args[1:])
+	case "rm":
+		removeCommand(db, args[1:])
+	case "edit":
+		editCommand(db, args[1:])
+	case "bulk-edit":
+		bulkEditCommand(db, args[1:])
+	case "list":
+		listCommand(db, args[1:])
+	case "search":
+		searchCommand(db, args[1:])
+	case "enrich":
+		enrichCommand(db, args[1:])
+	case "check":
+		checkCommand(db, args[1:])
+	case "favicons":
+		faviconsCommand(db, args[1:])
+	case "suggest-tags":
+		suggestCommand(db, args[1:])
+	case "ai":
+		aiCommand(db, args[1:])
+	case "serve":
+		serveCommand(db, dbFile, args[1:])
+	case "token":
+		tokenCommand(db, args[1:])
+	case "user":
+		userCommand(db, dbFile, args[1:])
+	case "webhook":
+		webhookCommand(db, dbFile, args[1:])
+	case "archive-org":
+		archiveOrgCommand(db, args[1:])
+	case "open":
+		openCommand(db, args[1:])
+	case "tag":
+		tagCommand(db, args[1:])
+	case "retag":
+		retagCommand(db, args[1:])
+	case "rule":
+		ruleCommand(db, args[1:])
+	case "folder":
+		folderCommand(db, args[1:])
+	case "migrate":
+		migrateCommand(db, args[1:])
+	case "assert":
+		assertCommand(db, args[1:])
+	case "pull", "push":
+		if !local {
+			log.Fatalf("%s copies between a project and the global database, run it with --local", mode)
 		}
-		exportBookmarks(db, outputFile)
+		syncLocal(db, mode, args[1:])
+	case "mark-read", "mark-unread":
+		statusCommand(db, args[1:], mode, "unread", mode == "mark-unread", "marked "+strings.TrimPrefix(mode, "mark-"))
+	case "archive", "unarchive":
+		statusCommand(db, args[1:], mode, "archived", mode == "archive", mode+"d")
+	case "stats":
+		statsCommand(db, dbFile, args[1:])
+	case "random":
+		randomCommand(db, args[1:])
+	case "report":
+		reportCommand(db, args[1:])
+	case "domains":
+		domainsCommand(db, args[1:])
+	case "frequent":
+		frequentCommand(db, args[1:])
+	case "dedupe":
+		dedupeCommand(db, args[1:])
+	case "history":
+		historyCommand(db, args[1:])
+	case "revert":
+		revertCommand(db, args[1:])
+	case "undo":
+		undoCommand(db, args[1:])
+	case "trash":
+		trashCommand(db, args[1:])
+	case "rate":
+		rateCommand(db, args[1:])
+	case "star", "unstar":
+		statusCommand(db, args[1:], mode, "starred", mode == "star", mode+"red")
+	case "publish", "unpublish":
+		statusCommand(db, args[1:], mode, "public", mode == "publish", mode+"ed")
+	case "lock":
+		lockCommand(db, args[1:], true)
+	case "unlock":
+		lockCommand(db, args[1:], false)
 	default:
-		fmt.Println("Invalid mode. Use 'import' or 'export'.")
+		fmt.Println("Invalid mode.")
+		printUsage()
 		os.Exit(1)
 	}
+
+	if journaledCommands[mode] {
+		if err := endOperation(db); err != nil {
+			log.Printf("Failed to finish operation: %v", err)
+		}
+	}
+	if err := sealChangelog(db); err != nil {
+		log.Printf("Failed to seal changelog: %v", err)
+	}
+	deliverWebhooks(db)
 }
 
-func importBookmarks(db *sql.DB, bookmarksFile string) {
-	data, err := os.ReadFile(bookmarksFile)
+// parseInterspersed parses flags that may come before, between or after
+// the positional arguments, as in "edit 12 --title X", and returns the
+// positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func globalDatabasePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalf("Failed to read bookmarks file: %v", err)
+		return "", err
 	}
-	content := string(data)
+	return filepath.Join(homeDir, ".local", "share", "bookmarks", "bookmark.db"), nil
+}
 
-	blocks := strings.Split(content, "<DT>")
-	jobs := make(chan Job, len(blocks))
-	results := make(chan error, len(blocks))
+// driverName is go-sqlite3 with the SQL functions bmark-importer adds.
+// They only exist on connections opened here, never in the shell script.
+const driverName = "sqlite3_bmark"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("url_host", urlHost, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("regexp", sqlRegexp, true)
+		},
+	})
+}
+
+// openDatabase opens the SQLite database at dsn and brings its schema up
+// to date. dsn may be ":memory:"; the pool is limited to one connection,
+// so an in-memory database lives as long as the returned handle.
+func openDatabase(dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, fmt.Sprintf("%s?_busy_timeout=5000&_foreign_keys=on", dsn))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+
+	if err := initializeDatabase(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	if err := sealChangelog(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to seal changelog: %w", err)
+	}
+
+	return db, nil
+}
+
+func importBookmarks(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "auto", "input format: html, json, chrome-reading-list, zotero-csv or zotero-rdf")
+	// netscape and delicious exports are read the same way now that notes
+	// keep their markup and line breaks in either; the flag is accepted
+	// only so that existing scripts keep working.
+	dialect := fs.String("dialect", "netscape", "HTML dialect: netscape or delicious (both are read the same way)")
+	folders := fs.String("folders", "ignore", "what to do with <H3> folders: ignore, tags or table")
+	identity := fs.String("identity", "", "age identity file used to decrypt .age files")
+	expand := fs.Bool("expand", false, "follow t.co, bit.ly and other short links and save the final URL")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Println("Usage: importer-exporter import [--format FORMAT] <file>...")
+		os.Exit(1)
+	}
+	if *dialect != "netscape" && *dialect != "delicious" {
+		log.Fatalf("Unknown HTML dialect: %s", *dialect)
+	}
+	if *folders != "ignore" && *folders != "tags" && *folders != "table" {
+		log.Fatalf("Unknown folder mode: %s", *folders)
+	}
+	opts := htmlOptions{Folders: *folders}
+
+	if fs.NArg() == 1 {
+		parse, err := fileParser(fs.Arg(0), *format, opts, *identity)
+		if err != nil {
+			log.Fatalf("Failed to import %s: %v", fs.Arg(0), err)
+		}
+		if *expand {
+			parse = expandShortlinks(parse)
+		}
+		runImport(db, parse)
+		return
+	}
+
+	// Several files are staged and merged first, so the same bookmark
+	// in two exports is only imported once.
+	sources := make([]importSource, fs.NArg())
+	for i, path := range fs.Args() {
+		parse, err := fileParser(path, *format, opts, *identity)
+		if err != nil {
+			log.Fatalf("Failed to import %s: %v", path, err)
+		}
+		if *expand {
+			parse = expandShortlinks(parse)
+		}
+		sources[i] = importSource{Name: path, Path: path, Read: func() ([]Job, error) { return collectJobs(parse) }}
+	}
+	staged, errs := readSources(sources)
+	for i, err := range errs {
+		if err != nil {
+			log.Fatalf("Failed to read bookmarks file %s: %v", sources[i].Path, err)
+		}
+	}
+	importStaged(db, fs.Args(), staged)
+}
+
+// fileParser returns the parser for one bookmarks file, detecting its
+// format from the name when format is "auto".
+func fileParser(bookmarksFile, format string, opts htmlOptions, identity string) (func(jobs chan<- Job) error, error) {
+	name := bookmarksFile
+	if isEncrypted(name) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	compressed := strings.HasSuffix(name, ".gz")
+	if format == "auto" {
+		format = detectImportFormat(strings.TrimSuffix(name, ".gz"))
+	}
+
+	// Plain files are streamed so large exports are parsed in constant
+	// memory; encrypted ones are decrypted up front. Gzipped files, as
+	// written by export --compress, are decompressed on the fly.
+	openInput := func() (io.ReadCloser, error) {
+		var input io.ReadCloser
+		if isEncrypted(bookmarksFile) {
+			data, err := decryptFile(bookmarksFile, identity)
+			if err != nil {
+				return nil, err
+			}
+			input = io.NopCloser(bytes.NewReader(data))
+		} else {
+			file, err := os.Open(bookmarksFile)
+			if err != nil {
+				return nil, err
+			}
+			input = file
+		}
+		if !compressed {
+			return input, nil
+		}
+		gz, err := gzip.NewReader(input)
+		if err != nil {
+			input.Close()
+			return nil, fmt.Errorf("failed to read gzip header: %w", err)
+		}
+		return gzipReadCloser{gz, input}, nil
+	}
+
+	var read func(input io.Reader, jobs chan<- Job) error
+	switch format {
+	case "html":
+		read = func(input io.Reader, jobs chan<- Job) error { return parseNetscape(input, jobs, opts) }
+	case "json":
+		read = parseJSON
+	case "chrome-reading-list":
+		read = parseChromeReadingList
+	case "zotero-csv":
+		read = parseZoteroCSV
+	case "zotero-rdf":
+		read = parseZoteroRDF
+	default:
+		return nil, fmt.Errorf("unknown import format: %s", format)
+	}
+
+	return func(jobs chan<- Job) error {
+		input, err := openInput()
+		if err != nil {
+			return err
+		}
+		defer input.Close()
+		return read(input, jobs)
+	}, nil
+}
+
+func detectImportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "zotero-csv"
+	case ".rdf":
+		return "zotero-rdf"
+	case ".json":
+		return "json"
+	default:
+		return "html"
+	}
+}
+
+// gzipReadCloser closes both the gzip stream and the file beneath it.
+type gzipReadCloser struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func (r gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+type importSummary struct {
+	Imported  int
+	Recovered int
+	Errors    []error
+}
+
+// importJobs feeds the jobs produced by parse through the insert workers.
+// The tag rules are applied to every job on the way. Per-bookmark
+// failures are collected in the summary; an error is only returned when
+// the rules cannot be read or parse itself fails.
+func importJobs(db *sql.DB, parse func(jobs chan<- Job) error) (importSummary, error) {
+	rules, err := loadTagRules(db)
+	if err != nil {
+		return importSummary{}, err
+	}
+	jobs := make(chan Job, 100)
+	results := make(chan Result, 100)
 
 	var wg sync.WaitGroup
 	workerCount := 5
 	wg.Add(workerCount)
 
 	for range workerCount {
-		go worker(db, jobs, results, &wg)
+		go worker(db, rules, jobs, results, &wg)
 	}
 
+	var parseErr error
 	go func() {
-		parseBlocks(blocks, jobs)
+		parseErr = parse(jobs)
 		close(jobs)
 	}()
 
@@ -110,131 +558,111 @@ func importBookmarks(db *sql.DB, bookmarksFile string) {
 		close(results)
 	}()
 
-	successCount := 0
-	for err := range results {
-		if err != nil {
-			log.Printf("Error: %v", err)
-		} else {
-			successCount++
-		}
-	}
-
-	fmt.Printf("%d bookmarks successfully imported!\n", successCount)
-}
-
-func parseBlocks(blocks []string, jobs chan<- Job) {
-	reAnchor := regexp.MustCompile(`(?i)<A\s+([^>]+)>(.*?)</A>`)
-	reHref := regexp.MustCompile(`HREF="([^"]+)"`)
-	reAddDate := regexp.MustCompile(`ADD_DATE="(\d+)"`)
-	reLastMod := regexp.MustCompile(`LAST_MODIFIED="(\d+)"`)
-	reTags := regexp.MustCompile(`TAGS="([^"]+)"`)
-	reDesc := regexp.MustCompile(`(?i)<DD>([^<]+)`)
-
-	now := time.Now().Unix()
-
-	for _, block := range blocks {
-		block = strings.TrimSpace(block)
-		if block == "" {
+	var summary importSummary
+	for res := range results {
+		if res.Err != nil {
+			summary.Errors = append(summary.Errors, res.Err)
 			continue
 		}
-
-		anchorMatch := reAnchor.FindStringSubmatch(block)
-		if len(anchorMatch) < 3 {
-			continue
+		summary.Imported++
+		if res.Recovered {
+			summary.Recovered++
 		}
+	}
 
-		attrStr := anchorMatch[1]
-		title := htmlUnescape(strings.TrimSpace(anchorMatch[2]))
-
-		uri := extractHref(reHref, attrStr)
-		if uri == "" {
-			continue
-		}
+	return summary, parseErr
+}
 
-		createdAt := extractTimestamp(reAddDate, attrStr, now)
-		updatedAt := extractTimestamp(reLastMod, attrStr, createdAt)
-		tags := extractTags(reTags, attrStr)
-		note := extractDescription(reDesc, block)
+// runImport imports the jobs produced by parse and prints a summary.
+func runImport(db *sql.DB, parse func(jobs chan<- Job) error) {
+	summary, err := importJobs(db, parse)
+	for _, err := range summary.Errors {
+		log.Printf("Error: %v", err)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks file: %v", err)
+	}
 
-		jobs <- Job{
-			URI:       uri,
-			Title:     title,
-			Note:      note,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
-			Tags:      tags,
-		}
+	fmt.Printf("%d bookmarks successfully imported!\n", summary.Imported)
+	if summary.Recovered > 0 {
+		fmt.Printf("%d of them were recovered from malformed markup.\n", summary.Recovered)
 	}
 }
 
-func worker(db *sql.DB, jobs <-chan Job, results chan<- error, wg *sync.WaitGroup) {
+func worker(db *sql.DB, rules tagRules, jobs <-chan Job, results chan<- Result, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for job := range jobs {
-		bookmarkID, err := insertBookmark(db, job.URI, job.Title, job.Note, job.CreatedAt, job.UpdatedAt)
+		job = rules.apply(job)
+		bookmarkID, err := insertBookmark(db, job)
 		if err != nil {
-			results <- fmt.Errorf("failed to insert bookmark %s: %v", job.URI, err)
+			results <- Result{Err: fmt.Errorf("failed to insert bookmark %s: %v", job.URI, err)}
 			continue
 		}
 
 		if err := insertTags(db, bookmarkID, job.Tags); err != nil {
-			results <- fmt.Errorf("failed to insert tags for bookmark %s: %v", job.URI, err)
+			results <- Result{Err: fmt.Errorf("failed to insert tags for bookmark %s: %v", job.URI, err)}
 			continue
 		}
 
-		results <- nil
+		results <- Result{Recovered: job.Recovered}
 	}
 }
 
-func extractHref(re *regexp.Regexp, attrStr string) string {
-	if m := re.FindStringSubmatch(attrStr); m != nil {
-		return m[1]
+func insertBookmark(db *sql.DB, job Job) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	return ""
-}
+	defer tx.Rollback()
 
-func extractTimestamp(re *regexp.Regexp, attrStr string, defaultValue int64) int64 {
-	if m := re.FindStringSubmatch(attrStr); m != nil {
-		if timestamp, err := strconv.ParseInt(m[1], 10, 64); err == nil {
-			return timestamp
+	if uri := canonicalURL(job.URI, canonicalization); uri != job.URI {
+		// A bookmark saved before its URL would have been canonicalized
+		// keeps it, so importing it again does not add a second copy.
+		var saved int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM bookmarks WHERE url = ?", job.URI).Scan(&saved); err != nil {
+			return 0, fmt.Errorf("failed to look up %s: %w", job.URI, err)
 		}
-	}
-	return defaultValue
-}
-
-func extractTags(re *regexp.Regexp, attrStr string) []string {
-	if m := re.FindStringSubmatch(attrStr); m != nil && m[1] != "" {
-		tags := strings.Split(m[1], ",")
-		var cleanedTags []string
-		for _, tag := range tags {
-			tag = strings.TrimSpace(tag)
-			if tag != "" {
-				cleanedTags = append(cleanedTags, tag)
-			}
+		if saved == 0 {
+			job.URI = uri
 		}
-		return cleanedTags
 	}
-	return []string{}
-}
 
-func extractDescription(re *regexp.Regexp, block string) string {
-	if m := re.FindStringSubmatch(block); m != nil {
-		return htmlUnescape(strings.TrimSpace(m[1]))
+	folderID, err := ensureFolder(tx, job.Folder)
+	if err != nil {
+		return 0, err
+	}
+	if job.Keyword, err = claimKeyword(tx, job); err != nil {
+		return 0, err
 	}
-	return ""
-}
 
-func insertBookmark(db *sql.DB, uri, title, note string, createdAt, updatedAt int64) (int64, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	if job.ExternalID != "" {
+		bookmarkID, found, err := updateByExternalID(tx, job, folderID)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			if err := storeFavicon(tx, job.URI, job.IconURI, job.Icon); err != nil {
+				return 0, err
+			}
+			if err := storeShortURL(tx, bookmarkID, job.ShortURL); err != nil {
+				return 0, err
+			}
+			if err := tx.Commit(); err != nil {
+				return 0, fmt.Errorf("failed to commit transaction: %w", err)
+			}
+			return bookmarkID, nil
+		}
 	}
-	defer tx.Rollback()
 
 	res, err := tx.Exec(`
-		INSERT OR IGNORE INTO bookmarks (url, title, note, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?)`,
-		uri, title, note, createdAt, updatedAt)
+		INSERT OR IGNORE INTO bookmarks (url, title, note, created_at, updated_at, private, unread,
+			starred, archived, rating, last_visited_at, keyword, folder_id, external_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.URI, job.Title, job.Note, job.CreatedAt, job.UpdatedAt, job.Private, job.Unread, job.Starred, job.Archived,
+		sql.NullInt64{Int64: int64(job.Rating), Valid: job.Rating > 0},
+		sql.NullInt64{Int64: job.LastVisit, Valid: job.LastVisit > 0}, nullIfEmpty(job.Keyword), folderID,
+		nullIfEmpty(job.ExternalID))
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert or ignore bookmark: %w", err)
 	}
@@ -253,10 +681,36 @@ func insertBookmark(db *sql.DB, uri, title, note string, createdAt, updatedAt in
 		}
 	} else {
 
-		err = tx.QueryRow("SELECT id FROM bookmarks WHERE url = ?", uri).Scan(&bookmarkID)
+		err = tx.QueryRow("SELECT id FROM bookmarks WHERE url = ?", job.URI).Scan(&bookmarkID)
 		if err != nil {
 			return 0, fmt.Errorf("failed to retrieve existing bookmark ID: %w", err)
 		}
+
+		if err := restoreFromTrash(tx, bookmarkID); err != nil {
+			return 0, err
+		}
+
+		// The read state follows the source even on locked bookmarks,
+		// like visiting one does.
+		if job.SyncUnread {
+			if err := overrideLocks(tx); err != nil {
+				return 0, err
+			}
+			_, err = tx.Exec("UPDATE bookmarks SET unread = ? WHERE id = ? AND unread != ?", job.Unread, bookmarkID, job.Unread)
+			if err != nil {
+				return 0, fmt.Errorf("failed to update read state: %w", err)
+			}
+			if err := restoreLocks(tx); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := storeFavicon(tx, job.URI, job.IconURI, job.Icon); err != nil {
+		return 0, err
+	}
+	if err := storeShortURL(tx, bookmarkID, job.ShortURL); err != nil {
+		return 0, err
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -273,6 +727,20 @@ func insertTags(db *sql.DB, bookmarkID int64, tags []string) error {
 	}
 	defer tx.Rollback()
 
+	if err := linkTags(tx, bookmarkID, tags); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tags transaction: %w", err)
+	}
+
+	return nil
+}
+
+// linkTags adds tags to a bookmark inside tx, creating tags that do not
+// exist yet.
+func linkTags(tx *sql.Tx, bookmarkID int64, tags []string) error {
 	for _, tag := range tags {
 		if tag == "" {
 			continue
@@ -311,100 +779,9 @@ func insertTags(db *sql.DB, bookmarkID int64, tags []string) error {
 			return fmt.Errorf("failed to link bookmark %d to tag %d: %w", bookmarkID, tagID, err)
 		}
 	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit tags transaction: %w", err)
-	}
-
 	return nil
 }
 
-func htmlUnescape(s string) string {
-	replacements := []struct{ old, new string }{
-		{"&amp;", "&"},
-		{"&lt;", "<"},
-		{"&gt;", ">"},
-		{"&quot;", `"`},
-		{"&#39;", "'"},
-	}
-	for _, r := range replacements {
-		s = strings.ReplaceAll(s, r.old, r.new)
-	}
-	return s
-}
-
-func exportBookmarks(db *sql.DB, outputFile string) {
-	rows, err := db.Query(`
-		SELECT b.url, b.title, b.created_at, b.updated_at, b.note, GROUP_CONCAT(t.tag, ',') as tags
-		FROM bookmarks b
-		LEFT JOIN bookmark_tags bt ON b.id = bt.bookmark_id
-		LEFT JOIN tags t ON bt.tag_id = t.id
-		GROUP BY b.id
-	`)
-	if err != nil {
-		log.Fatalf("Failed to query bookmarks for export: %v", err)
-	}
-	defer rows.Close()
-
-	file, err := os.Create(outputFile)
-	if err != nil {
-		log.Fatalf("Failed to create output file %s: %v", outputFile, err)
-	}
-	defer file.Close()
-
-	fmt.Fprintln(file, `<!DOCTYPE NETSCAPE-Bookmark-file-1>`)
-	fmt.Fprintln(file, ``)
-	fmt.Fprintln(file, `<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">`)
-	fmt.Fprintln(file, `<TITLE>Bookmarks</TITLE>`)
-	fmt.Fprintln(file, `<H1>Bookmarks</H1>`)
-	fmt.Fprintln(file, `<DL><p>`)
-
-	bookmarkCount := 0
-	for rows.Next() {
-		var uri, title, note string
-		var createdAt, updatedAt int64
-		var tags sql.NullString
-
-		err := rows.Scan(&uri, &title, &createdAt, &updatedAt, &note, &tags)
-		if err != nil {
-			log.Printf("Row error during export: %v", err)
-			continue
-		}
-
-		titleEsc := html.EscapeString(title)
-		noteEsc := html.EscapeString(note)
-		uriEsc := html.EscapeString(uri)
-
-		var tagsEsc string
-		if tags.Valid {
-			tagsEsc = html.EscapeString(tags.String)
-		} else {
-			tagsEsc = ""
-		}
-
-		attr := fmt.Sprintf(`HREF="%s" ADD_DATE="%d" LAST_MODIFIED="%d"`, uriEsc, createdAt, updatedAt)
-		if tagsEsc != "" {
-			attr += fmt.Sprintf(` TAGS="%s"`, tagsEsc)
-		}
-		fmt.Fprintf(file, `<DT><A %s>%s</A>`, attr, titleEsc)
-
-		if noteEsc != "" {
-			fmt.Fprintf(file, `<DD>%s`, noteEsc)
-		}
-		fmt.Fprintln(file, "")
-
-		bookmarkCount++
-	}
-
-	fmt.Fprintln(file, `</DL><p>`)
-
-	if bookmarkCount == 0 {
-		fmt.Println("No bookmarks found in database.")
-	} else {
-		fmt.Printf("Exported %d bookmarks to: %s\n", bookmarkCount, outputFile)
-	}
-}
-
 func initializeDatabase(db *sql.DB) error {
 	tables := []string{
 		`CREATE TABLE IF NOT EXISTS bookmarks (
@@ -419,6 +796,19 @@ func initializeDatabase(db *sql.DB) error {
 			id INTEGER PRIMARY KEY NOT NULL,
 			tag TEXT NOT NULL UNIQUE
 		);`,
+		`CREATE TABLE IF NOT EXISTS folders (
+			id INTEGER PRIMARY KEY NOT NULL,
+			name TEXT NOT NULL,
+			parent_id INTEGER,
+			FOREIGN KEY (parent_id) REFERENCES folders(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS favicons (
+			host TEXT PRIMARY KEY NOT NULL,
+			icon_uri TEXT,
+			mime TEXT,
+			data BLOB,
+			fetched_at INTEGER NOT NULL
+		);`,
 		`CREATE TABLE IF NOT EXISTS bookmark_tags (
 			bookmark_id INTEGER,
 			tag_id INTEGER,
@@ -426,6 +816,44 @@ func initializeDatabase(db *sql.DB) error {
 			FOREIGN KEY (bookmark_id) REFERENCES bookmarks(id) ON DELETE CASCADE,
 			FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
 		);`,
+		lockOverrideSchema,
+		pushStateSchema,
+		samplesSchema,
+		translationsSchema,
+		metadataSchema,
+		operationsSchema,
+		undoLogSchema,
+		revisionsSchema,
+		tagRulesSchema,
+		pageTextsSchema,
+		usersSchema,
+		apiTokensSchema,
+		webhooksSchema,
+		webhookEventsSchema,
+	}
+
+	columns := []struct{ table, name, definition string }{
+		{"bookmarks", "private", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookmarks", "unread", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookmarks", "last_visited_at", "INTEGER"},
+		{"bookmarks", "keyword", "TEXT"},
+		{"bookmarks", "folder_id", "INTEGER REFERENCES folders(id) ON DELETE SET NULL"},
+		{"bookmarks", "external_id", "TEXT"},
+		{"bookmarks", "locked", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookmarks", "visit_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookmarks", "starred", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookmarks", "archived", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookmarks", "rating", "INTEGER CHECK (rating BETWEEN 1 AND 5)"},
+		{"bookmarks", "deleted_at", "INTEGER"},
+		{"bookmarks", "check_status", "INTEGER"},
+		{"bookmarks", "check_error", "TEXT"},
+		{"bookmarks", "checked_at", "INTEGER"},
+		{"bookmarks", "check_failures", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookmarks", "snapshot_url", "TEXT"},
+		{"page_texts", "content_hash", "TEXT"},
+		{"api_tokens", "user_id", "INTEGER REFERENCES users(id) ON DELETE CASCADE"},
+		{"bookmarks", "public", "INTEGER NOT NULL DEFAULT 0"},
+		{"tags", "public", "INTEGER NOT NULL DEFAULT 0"},
 	}
 
 	indexes := []string{
@@ -433,6 +861,9 @@ func initializeDatabase(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_tag ON tags (tag);`,
 		`CREATE INDEX IF NOT EXISTS idx_bookmark_id ON bookmark_tags (bookmark_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_tag_id ON bookmark_tags (tag_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_folder_parent ON folders (parent_id, name);`,
+		`CREATE INDEX IF NOT EXISTS idx_revision_bookmark ON bookmark_revisions (bookmark_id);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_external_id ON bookmarks (external_id) WHERE external_id IS NOT NULL;`,
 	}
 
 	for _, table := range tables {
@@ -441,11 +872,66 @@ func initializeDatabase(db *sql.DB) error {
 		}
 	}
 
+	for _, column := range columns {
+		if err := addColumnIfMissing(db, column.table, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
 	for _, index := range indexes {
 		if _, err := db.Exec(index); err != nil {
 			return fmt.Errorf("failed to create index: %v", err)
 		}
 	}
 
+	for _, trigger := range lockTriggers {
+		if _, err := db.Exec(trigger); err != nil {
+			return fmt.Errorf("failed to create trigger: %v", err)
+		}
+	}
+
+	for _, trigger := range webhookTriggers {
+		if _, err := db.Exec(trigger); err != nil {
+			return fmt.Errorf("failed to create trigger: %v", err)
+		}
+	}
+
+	if err := uniqueKeywords(db); err != nil {
+		return err
+	}
+	if err := journalTriggers(db); err != nil {
+		return err
+	}
+	return initializeSearch(db)
+}
+
+// addColumnIfMissing upgrades databases created by older versions, or by
+// the shell script, which only know the original schema.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect table %s: %v", table, err)
+	}
+	rows.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %v", table, column, err)
+	}
 	return nil
 }
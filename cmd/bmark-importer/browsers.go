@@ -0,0 +1,238 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Firefox's built-in folders. Bookmarks directly inside them get no
+// folder; the tags root holds one folder per tag instead of bookmarks.
+var firefoxRoots = map[string]bool{
+	"root________": true,
+	"menu________": true,
+	"toolbar_____": true,
+	"unfiled_____": true,
+	"mobile______": true,
+	"tags________": true,
+}
+
+// readFirefoxPlaces reads the bookmarks of a Firefox profile from its
+// places.sqlite. Firefox keeps the database locked while it runs, so a
+// copy (with its write-ahead log) is read instead.
+func readFirefoxPlaces(path string) ([]Job, error) {
+	dir, err := os.MkdirTemp("", "bmark-places-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	copyPath := filepath.Join(dir, "places.sqlite")
+	if err := copyFile(path, copyPath); err != nil {
+		return nil, err
+	}
+	if err := copyFile(path+"-wal", copyPath+"-wal"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", copyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	places := make(map[int64]string)
+	keywords := make(map[int64]string)
+	err = queryEach(db, "SELECT id, url FROM moz_places", func(rows *sql.Rows) error {
+		var id int64
+		var uri string
+		if err := rows.Scan(&id, &uri); err != nil {
+			return err
+		}
+		places[id] = uri
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read places: %w", err)
+	}
+	err = queryEach(db, "SELECT place_id, keyword FROM moz_keywords", func(rows *sql.Rows) error {
+		var id int64
+		var keyword string
+		if err := rows.Scan(&id, &keyword); err != nil {
+			return err
+		}
+		keywords[id] = keyword
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keywords: %w", err)
+	}
+
+	type entry struct {
+		id, kind, fk, parent, added, modified int64
+		title, guid                           string
+	}
+	var entries []entry
+	byID := make(map[int64]*entry)
+	err = queryEach(db, `SELECT id, type, COALESCE(fk, 0), COALESCE(parent, 0),
+		COALESCE(title, ''), COALESCE(dateAdded, 0), COALESCE(lastModified, 0), guid
+		FROM moz_bookmarks ORDER BY parent, position`, func(rows *sql.Rows) error {
+		var e entry
+		if err := rows.Scan(&e.id, &e.kind, &e.fk, &e.parent, &e.title, &e.added, &e.modified, &e.guid); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bookmarks: %w", err)
+	}
+	for i := range entries {
+		byID[entries[i].id] = &entries[i]
+	}
+
+	// Tags are stored as bookmarks inside a folder named after the tag,
+	// which is itself a child of the tags root.
+	tags := make(map[int64][]string)
+	var bookmarks []*entry
+	for i := range entries {
+		e := &entries[i]
+		if e.kind != 1 {
+			continue
+		}
+		if parent := byID[e.parent]; parent != nil {
+			if grandparent := byID[parent.parent]; grandparent != nil && grandparent.guid == "tags________" {
+				tags[e.fk] = append(tags[e.fk], parent.title)
+				continue
+			}
+		}
+		bookmarks = append(bookmarks, e)
+	}
+
+	var jobs []Job
+	for _, e := range bookmarks {
+		uri := places[e.fk]
+		if uri == "" || strings.HasPrefix(uri, "place:") {
+			continue
+		}
+		var folder []string
+		for parent := byID[e.parent]; parent != nil && !firefoxRoots[parent.guid]; parent = byID[parent.parent] {
+			folder = append([]string{strings.ReplaceAll(parent.title, "/", "-")}, folder...)
+		}
+		// Firefox timestamps are in microseconds.
+		createdAt := e.added / 1e6
+		jobs = append(jobs, Job{
+			URI:       uri,
+			Title:     e.title,
+			CreatedAt: createdAt,
+			UpdatedAt: max(e.modified/1e6, createdAt),
+			Tags:      tags[e.fk],
+			Keyword:   keywords[e.fk],
+			Folder:    folder,
+		})
+	}
+	return jobs, nil
+}
+
+type chromeNode struct {
+	Type      string       `json:"type"`
+	Name      string       `json:"name"`
+	URL       string       `json:"url"`
+	DateAdded string       `json:"date_added"`
+	Modified  string       `json:"date_modified"`
+	Children  []chromeNode `json:"children"`
+}
+
+// readChromeBookmarks reads the Bookmarks file of a Chrome, Chromium or
+// Brave profile. Folders below the bookmark bar and "Other bookmarks"
+// roots are kept as folders.
+func readChromeBookmarks(path string) ([]Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Roots map[string]json.RawMessage `json:"roots"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var jobs []Job
+	var walk func(node chromeNode, folder []string)
+	walk = func(node chromeNode, folder []string) {
+		switch node.Type {
+		case "url":
+			createdAt := chromeTime(node.DateAdded)
+			jobs = append(jobs, Job{
+				URI:       node.URL,
+				Title:     node.Name,
+				CreatedAt: createdAt,
+				UpdatedAt: max(chromeTime(node.Modified), createdAt),
+				Folder:    append([]string(nil), folder...),
+			})
+		case "folder":
+			for _, child := range node.Children {
+				walk(child, append(folder, strings.ReplaceAll(node.Name, "/", "-")))
+			}
+		}
+	}
+	for _, name := range []string{"bookmark_bar", "other", "synced"} {
+		var root chromeNode
+		if raw, ok := file.Roots[name]; !ok || json.Unmarshal(raw, &root) != nil {
+			continue
+		}
+		for _, child := range root.Children {
+			walk(child, nil)
+		}
+	}
+	return jobs, nil
+}
+
+// chromeTime converts Chrome's microseconds since 1601-01-01 to Unix time.
+func chromeTime(s string) int64 {
+	us, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || us == 0 {
+		return 0
+	}
+	return us/1e6 - 11644473600
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// queryEach runs query and calls fn for every row.
+func queryEach(db *sql.DB, query string, fn func(rows *sql.Rows) error, args ...any) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
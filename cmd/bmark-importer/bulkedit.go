@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bulkEditCommand edits the bookmarks matching a query, or those whose
+// IDs are read from stdin, in $EDITOR.
+func bulkEditCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("bulk-edit", flag.ExitOnError)
+	force := fs.Bool("force", false, "change locked bookmarks too")
+	words := parseInterspersed(fs, args)
+
+	var bookmarks []Bookmark
+	var err error
+	if len(words) == 1 && words[0] == "-" {
+		var keys []string
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			keys = append(keys, strings.Fields(scanner.Text())...)
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("Failed to read IDs: %v", err)
+		}
+		bookmarks, err = selectBookmarks(db, keys, "")
+	} else {
+		filter := bookmarkFilter{Query: strings.Join(words, " ")}
+		if filter.Query != "" {
+			if _, err := compileQuery(filter.Query); err != nil {
+				log.Fatalf("Invalid query: %v", err)
+			}
+		}
+		err = forEachBookmark(db, filter, func(b Bookmark) error {
+			bookmarks = append(bookmarks, b)
+			return nil
+		})
+	}
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(bookmarks) == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+
+	if edited, trashed, ok := editInEditor(db, bookmarks, *force); ok {
+		fmt.Printf("Updated %d bookmark(s), moved %d to the trash\n", edited, trashed)
+	}
+}
+
+// editInEditor writes bookmarks to a temporary file, opens it in $EDITOR
+// and applies what was changed once the editor exits: edited fields are
+// saved, and bookmarks whose [[bookmark]] block was removed go to the
+// trash. All changes are made in one transaction, and a file that does
+// not parse can be edited again. It returns the number of bookmarks
+// updated and trashed, or false when the file was left as it was.
+func editInEditor(db *sql.DB, bookmarks []Bookmark, force bool) (int, int, bool) {
+	file, err := os.CreateTemp("", "bmark-bulk-*.toml")
+	if err != nil {
+		log.Fatalf("Failed to create temporary file: %v", err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+
+	original := make(map[int64]Bookmark, len(bookmarks))
+	docs := make([]editableBookmark, len(bookmarks))
+	for i, b := range bookmarks {
+		original[b.ID] = b
+		docs[i] = editableFrom(b)
+	}
+	header := []string{fmt.Sprintf("%d bookmark(s). Save and quit to apply your changes.", len(bookmarks))}
+	if len(bookmarks) > 1 {
+		header = append(header, "Removing a [[bookmark]] block moves the bookmark to the trash.")
+	}
+	header = append(header, "Quit without saving, or empty the file, to change nothing.")
+	err = writeEditDoc(file, header, docs)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+	for {
+		if err := runEditor(path); err != nil {
+			log.Fatalf("Failed to edit bookmarks: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if string(data) == string(written) {
+			fmt.Println("No changes.")
+			return 0, 0, false
+		}
+
+		edited, trashed, err := bulkEditChanges(string(data), original, locked, force)
+		if err == nil && len(edited) == 0 && len(trashed) == len(original) {
+			fmt.Println("The file has no bookmarks left, nothing was changed.")
+			return 0, 0, false
+		}
+		if err == nil {
+			err = applyBulkEdit(db, edited, trashed, force)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			if confirm("Edit again?") {
+				continue
+			}
+			fmt.Println("Nothing was changed.")
+			os.Remove(path)
+			os.Exit(1)
+		}
+		return len(edited), len(trashed), true
+	}
+}
+
+// bulkEditChanges compares an edited document with the bookmarks it was
+// written from. It returns the bookmarks with changed fields and the IDs
+// of those left out of the document.
+func bulkEditChanges(data string, original map[int64]Bookmark, locked map[int64]bool, force bool) ([]editableBookmark, []int64, error) {
+	docs, err := parseEditDoc(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[int64]bool)
+	var edited []editableBookmark
+	for _, doc := range docs {
+		b, ok := original[doc.ID]
+		switch {
+		case !doc.Set["id"]:
+			return nil, nil, fmt.Errorf("line %d: the bookmark has no id", doc.Line)
+		case !ok:
+			return nil, nil, fmt.Errorf("line %d: bookmark %d is not one of the bookmarks being edited", doc.Line, doc.ID)
+		case seen[doc.ID]:
+			return nil, nil, fmt.Errorf("line %d: bookmark %d appears twice", doc.Line, doc.ID)
+		}
+		seen[doc.ID] = true
+
+		merged := editableFrom(b)
+		if doc.Set["url"] {
+			merged.URL = strings.TrimSpace(doc.URL)
+		}
+		if doc.Set["title"] {
+			merged.Title = doc.Title
+		}
+		if doc.Set["note"] {
+			merged.Note = doc.Note
+		}
+		if doc.Set["tags"] {
+			merged.Tags = normalizeEditedTags(doc.Tags)
+		}
+		if merged.URL == "" {
+			return nil, nil, fmt.Errorf("line %d: bookmark %d needs a url", doc.Line, doc.ID)
+		}
+		if !editChanged(b, merged) {
+			continue
+		}
+		if locked[b.ID] && !force {
+			return nil, nil, fmt.Errorf("line %d: bookmark %d is locked, use --force to change it", doc.Line, doc.ID)
+		}
+		edited = append(edited, merged)
+	}
+
+	var trashed []int64
+	for id := range original {
+		if seen[id] {
+			continue
+		}
+		if locked[id] && !force {
+			return nil, nil, fmt.Errorf("bookmark %d is locked, use --force to move it to the trash", id)
+		}
+		trashed = append(trashed, id)
+	}
+	slices.Sort(trashed)
+	return edited, trashed, nil
+}
+
+// normalizeEditedTags trims tags and drops empty and repeated ones.
+func normalizeEditedTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+func editChanged(b Bookmark, e editableBookmark) bool {
+	if b.URI != e.URL || b.Title != e.Title || b.Note != e.Note {
+		return true
+	}
+	before, after := slices.Clone(b.Tags), slices.Clone(e.Tags)
+	slices.Sort(before)
+	slices.Sort(after)
+	return !slices.Equal(before, after)
+}
+
+// applyBulkEdit saves the edited bookmarks, each with a revision first,
+// and trashes the removed ones.
+func applyBulkEdit(db *sql.DB, edited []editableBookmark, trashed []int64, force bool) error {
+	now := time.Now().Unix()
+	return inTagTx(db, force, func(tx *sql.Tx) error {
+		for _, e := range edited {
+			if err := saveRevision(tx, e.ID); err != nil {
+				return err
+			}
+			_, err := tx.Exec("UPDATE bookmarks SET url = ?, title = ?, note = ?, updated_at = ? WHERE id = ?",
+				e.URL, e.Title, e.Note, now, e.ID)
+			if err != nil {
+				return fmt.Errorf("failed to update bookmark %d: %w", e.ID, err)
+			}
+			if _, err := tx.Exec("DELETE FROM bookmark_tags WHERE bookmark_id = ?", e.ID); err != nil {
+				return err
+			}
+			if err := linkTags(tx, e.ID, e.Tags); err != nil {
+				return err
+			}
+		}
+		for _, id := range trashed {
+			if _, err := tx.Exec("UPDATE bookmarks SET deleted_at = ? WHERE id = ?", now, id); err != nil {
+				return fmt.Errorf("failed to trash bookmark %d: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// The changelog is an optional, append-only record of every mutation. It
+// is filled by triggers so that changes made through the shell script are
+// captured too; the triggers only use built-in SQL, and the hash chain is
+// computed here ("sealing") the next time bmark-importer runs. Each entry
+// hashes the previous entry's hash, so editing or removing a sealed entry
+// breaks the chain from that point on.
+
+const changelogSchema = `CREATE TABLE IF NOT EXISTS changelog (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	at INTEGER NOT NULL,
+	op TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	row_id INTEGER NOT NULL,
+	payload TEXT NOT NULL,
+	hash TEXT
+);`
+
+var changelogTriggers = []struct{ name, sql string }{
+	{"changelog_append_only", `CREATE TRIGGER IF NOT EXISTS changelog_append_only
+		BEFORE UPDATE ON changelog WHEN OLD.hash IS NOT NULL
+		BEGIN SELECT RAISE(ABORT, 'changelog is append-only'); END;`},
+	{"changelog_no_delete", `CREATE TRIGGER IF NOT EXISTS changelog_no_delete
+		BEFORE DELETE ON changelog
+		BEGIN SELECT RAISE(ABORT, 'changelog is append-only'); END;`},
+	{"changelog_bookmarks_insert", `CREATE TRIGGER IF NOT EXISTS changelog_bookmarks_insert
+		AFTER INSERT ON bookmarks BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'insert', 'bookmarks', NEW.id,
+			json_object('url', NEW.url, 'title', NEW.title, 'note', NEW.note));
+		END;`},
+	{"changelog_bookmarks_update", `CREATE TRIGGER IF NOT EXISTS changelog_bookmarks_update
+		AFTER UPDATE ON bookmarks BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'update', 'bookmarks', NEW.id,
+			json_object('url', NEW.url, 'title', NEW.title, 'note', NEW.note,
+				'old_url', OLD.url, 'old_title', OLD.title, 'old_note', OLD.note));
+		END;`},
+	{"changelog_bookmarks_delete", `CREATE TRIGGER IF NOT EXISTS changelog_bookmarks_delete
+		AFTER DELETE ON bookmarks BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'delete', 'bookmarks', OLD.id,
+			json_object('url', OLD.url, 'title', OLD.title, 'note', OLD.note));
+		END;`},
+	{"changelog_tags_insert", `CREATE TRIGGER IF NOT EXISTS changelog_tags_insert
+		AFTER INSERT ON tags BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'insert', 'tags', NEW.id, json_object('tag', NEW.tag));
+		END;`},
+	{"changelog_tags_update", `CREATE TRIGGER IF NOT EXISTS changelog_tags_update
+		AFTER UPDATE ON tags BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'update', 'tags', NEW.id,
+			json_object('tag', NEW.tag, 'old_tag', OLD.tag));
+		END;`},
+	{"changelog_tags_delete", `CREATE TRIGGER IF NOT EXISTS changelog_tags_delete
+		AFTER DELETE ON tags BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'delete', 'tags', OLD.id, json_object('tag', OLD.tag));
+		END;`},
+	{"changelog_bookmark_tags_insert", `CREATE TRIGGER IF NOT EXISTS changelog_bookmark_tags_insert
+		AFTER INSERT ON bookmark_tags BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'insert', 'bookmark_tags', NEW.bookmark_id,
+			json_object('bookmark_id', NEW.bookmark_id, 'tag_id', NEW.tag_id));
+		END;`},
+	{"changelog_bookmark_tags_delete", `CREATE TRIGGER IF NOT EXISTS changelog_bookmark_tags_delete
+		AFTER DELETE ON bookmark_tags BEGIN
+		INSERT INTO changelog (at, op, table_name, row_id, payload)
+		VALUES (strftime('%s', 'now'), 'delete', 'bookmark_tags', OLD.bookmark_id,
+			json_object('bookmark_id', OLD.bookmark_id, 'tag_id', OLD.tag_id));
+		END;`},
+}
+
+type changelogEntry struct {
+	ID        int64           `json:"id"`
+	At        int64           `json:"at"`
+	Op        string          `json:"op"`
+	TableName string          `json:"table"`
+	RowID     int64           `json:"row_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Hash      string          `json:"hash"`
+}
+
+func (e changelogEntry) computeHash(prev string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%s|%s|%d|%s", prev, e.ID, e.At, e.Op, e.TableName, e.RowID, e.Payload)))
+	return hex.EncodeToString(sum[:])
+}
+
+func changelogCommand(db *sql.DB, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: importer-exporter changelog enable|disable|export [file]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "enable":
+		if _, err := db.Exec(changelogSchema); err != nil {
+			log.Fatalf("Failed to create changelog table: %v", err)
+		}
+		for _, trigger := range changelogTriggers {
+			if _, err := db.Exec(trigger.sql); err != nil {
+				log.Fatalf("Failed to create trigger %s: %v", trigger.name, err)
+			}
+		}
+		fmt.Println("Changelog enabled. All changes to bookmarks and tags are recorded from now on.")
+	case "disable":
+		// The append-only triggers stay in place so the recorded history
+		// cannot be edited after logging stops.
+		for _, trigger := range changelogTriggers {
+			if trigger.name == "changelog_append_only" || trigger.name == "changelog_no_delete" {
+				continue
+			}
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger.name); err != nil {
+				log.Fatalf("Failed to drop trigger %s: %v", trigger.name, err)
+			}
+		}
+		fmt.Println("Changelog disabled. Existing entries are kept.")
+	case "export":
+		if err := sealChangelog(db); err != nil {
+			log.Fatalf("Failed to seal changelog: %v", err)
+		}
+		var out io.Writer = os.Stdout
+		var file *atomicFile
+		if len(args) > 1 {
+			var err error
+			if file, err = createAtomic(args[1]); err != nil {
+				log.Fatalf("Failed to create output file %s: %v", args[1], err)
+			}
+			defer file.Abort()
+			out = file
+		}
+		enc := json.NewEncoder(out)
+		err := forEachChangelogEntry(db, func(e changelogEntry) error {
+			return enc.Encode(e)
+		})
+		if err != nil {
+			log.Fatalf("Failed to export changelog: %v", err)
+		}
+		// The changelog is evidence; make sure it is on disk.
+		if file != nil {
+			if err := file.Commit(true); err != nil {
+				log.Fatalf("Failed to write %s: %v", args[1], err)
+			}
+		}
+	default:
+		fmt.Printf("Unknown changelog command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func changelogEnabled(db *sql.DB) bool {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'changelog'").Scan(&n)
+	return err == nil && n > 0
+}
+
+func forEachChangelogEntry(db *sql.DB, fn func(changelogEntry) error) error {
+	rows, err := db.Query("SELECT id, at, op, table_name, row_id, payload, COALESCE(hash, '') FROM changelog ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e changelogEntry
+		var payload string
+		if err := rows.Scan(&e.ID, &e.At, &e.Op, &e.TableName, &e.RowID, &payload, &e.Hash); err != nil {
+			return err
+		}
+		e.Payload = json.RawMessage(payload)
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// sealChangelog hashes entries recorded by the triggers since the last
+// run, continuing the chain from the newest sealed entry.
+func sealChangelog(db *sql.DB) error {
+	if !changelogEnabled(db) {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var prev string
+	err = tx.QueryRow("SELECT hash FROM changelog WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1").Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, at, op, table_name, row_id, payload FROM changelog WHERE hash IS NULL ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var pending []changelogEntry
+	for rows.Next() {
+		var e changelogEntry
+		var payload string
+		if err := rows.Scan(&e.ID, &e.At, &e.Op, &e.TableName, &e.RowID, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		e.Payload = json.RawMessage(payload)
+		pending = append(pending, e)
+	}
+	rows.Close()
+
+	for _, e := range pending {
+		prev = e.computeHash(prev)
+		if _, err := tx.Exec("UPDATE changelog SET hash = ? WHERE id = ?", prev, e.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// verifyLog recomputes the whole hash chain. --head checks that a head
+// hash noted down earlier (for example from a previous verify-log run) is
+// still part of the chain, which catches a rewritten history.
+func verifyLog(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("verify-log", flag.ExitOnError)
+	head := fs.String("head", "", "previously recorded head hash that must still be in the chain")
+	fs.Parse(args)
+
+	if !changelogEnabled(db) {
+		fmt.Println("No changelog found. Enable it with: bmark changelog enable")
+		os.Exit(1)
+	}
+	if err := sealChangelog(db); err != nil {
+		log.Fatalf("Failed to seal changelog: %v", err)
+	}
+
+	var prev string
+	var count, lastID int64
+	var broken []string
+	headFound := *head == ""
+	err := forEachChangelogEntry(db, func(e changelogEntry) error {
+		if lastID != 0 && e.ID != lastID+1 {
+			broken = append(broken, fmt.Sprintf("entries %d to %d are missing", lastID+1, e.ID-1))
+		}
+		if want := e.computeHash(prev); e.Hash != want {
+			broken = append(broken, fmt.Sprintf("entry %d (%s %s %d) does not match its hash", e.ID, e.Op, e.TableName, e.RowID))
+		}
+		if e.Hash == *head {
+			headFound = true
+		}
+		prev = e.Hash
+		lastID = e.ID
+		count++
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read changelog: %v", err)
+	}
+	if !headFound {
+		broken = append(broken, fmt.Sprintf("head %s is not part of the chain", *head))
+	}
+
+	if len(broken) > 0 {
+		for _, problem := range broken {
+			fmt.Printf("TAMPERED: %s\n", problem)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Changelog OK: %d entries, head %s\n", count, prev)
+}
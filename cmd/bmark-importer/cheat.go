@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// titleWidth keeps one long title from pushing every URL in an aligned
+// listing off the right edge of the terminal.
+const titleWidth = 48
+
+// writeCheat writes a plain-text cheat sheet: an upper-case heading per
+// group, then one "title  url" line per bookmark with the columns aligned
+// within the group and the note indented below the URL. It reads well in
+// less and prints without any markup.
+func writeCheat(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	names, groups, count, err := groupBookmarks(db, opts.GroupBy, opts.Filter)
+	if err != nil {
+		return count, err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, strings.ToUpper(name))
+		for _, b := range groups[name] {
+			title := strings.Join(strings.Fields(b.Title), " ")
+			if title == "" {
+				title = "-"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", truncate(title, titleWidth), b.URI)
+			if note := strings.Join(strings.Fields(b.Note), " "); note != "" {
+				fmt.Fprintf(tw, "  \t%s\n", note)
+			}
+		}
+	}
+	return count, tw.Flush()
+}
+
+// truncate shortens s to width characters, marking the cut with an
+// ellipsis.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// deadTag marks bookmarks whose page is gone.
+const deadTag = "dead"
+
+// checkUserAgent is sent by the link checker; some sites refuse requests
+// without a browser-like one.
+const checkUserAgent = "Mozilla/5.0 (compatible; bmark link checker)"
+
+type linkCheck struct {
+	bookmark Bookmark
+	status   int
+	err      error
+	// movedTo is where the page now lives when every redirect on the way
+	// was permanent (301 or 308).
+	movedTo string
+}
+
+func (c linkCheck) ok() bool {
+	return c.err == nil && c.status < 400
+}
+
+// gone reports whether the server said the page no longer exists, which
+// is taken as final without waiting for more failed checks.
+func (c linkCheck) gone() bool {
+	return c.err == nil && (c.status == http.StatusNotFound || c.status == http.StatusGone)
+}
+
+func (c linkCheck) describe() string {
+	if c.err != nil {
+		return c.err.Error()
+	}
+	return fmt.Sprintf("%d %s", c.status, http.StatusText(c.status))
+}
+
+// checkCommand requests every matching bookmark and records the HTTP
+// status and time of the check with the bookmark. A bookmark is tagged
+// dead when its page answers 404 or 410, or after --dead-after failed
+// checks in a row; the tag comes off again once the page answers. Locked
+// bookmarks are checked but not retagged.
+func checkCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 20, "links checked at the same time")
+	timeout := fs.Duration("timeout", 15*time.Second, "time to wait for each link")
+	delay := fs.Duration("per-host-delay", time.Second, "minimum time between requests to the same host")
+	deadAfter := fs.Int("dead-after", 3, "failed checks in a row before a bookmark is tagged dead")
+	fixRedirects := fs.Bool("fix-redirects", false, "replace URLs that redirect permanently with their new location")
+	yes := fs.Bool("yes", false, "update redirected URLs without asking")
+	force := fs.Bool("force", false, "update the URLs of locked bookmarks too")
+	words := parseInterspersed(fs, args)
+
+	filter := bookmarkFilter{Query: strings.Join(words, " ")}
+	if filter.Query != "" {
+		if _, err := compileQuery(filter.Query); err != nil {
+			log.Fatalf("Invalid query: %v", err)
+		}
+	}
+	var bookmarks []Bookmark
+	err := forEachBookmark(db, filter, func(b Bookmark) error {
+		if strings.HasPrefix(b.URI, "http://") || strings.HasPrefix(b.URI, "https://") {
+			bookmarks = append(bookmarks, b)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(bookmarks) == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+
+	client := &http.Client{
+		Timeout:       *timeout,
+		Transport:     newHostLimiter(http.DefaultTransport, *delay),
+		CheckRedirect: traceRedirect,
+	}
+	var failing, moved []linkCheck
+	checked, dead, revived := 0, 0, 0
+	for c := range checkLinks(client, bookmarks, *concurrency) {
+		checked++
+		failures, err := recordCheck(db, c, *deadAfter, locked[c.bookmark.ID])
+		if err != nil {
+			log.Fatalf("Failed to record check of %s: %v", c.bookmark.URI, err)
+		}
+		if c.ok() && c.movedTo != "" {
+			moved = append(moved, c)
+		}
+		hadTag := slices.Contains(c.bookmark.Tags, deadTag)
+		switch {
+		case c.ok() && hadTag && !locked[c.bookmark.ID]:
+			revived++
+		case !c.ok():
+			failing = append(failing, c)
+			if !hadTag && !locked[c.bookmark.ID] && (c.gone() || failures >= *deadAfter) {
+				dead++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "\rChecked %d of %d", checked, len(bookmarks))
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if len(failing) > 0 {
+		slices.SortFunc(failing, func(a, b linkCheck) int { return int(a.bookmark.ID - b.bookmark.ID) })
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range failing {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", c.bookmark.ID, truncate(c.describe(), 40), c.bookmark.URI)
+		}
+		tw.Flush()
+	}
+	fmt.Printf("Checked %d bookmark(s): %d failing, %d newly tagged %s", checked, len(failing), dead, deadTag)
+	if revived > 0 {
+		fmt.Printf(", %d back online", revived)
+	}
+	if len(moved) > 0 {
+		fmt.Printf(", %d moved", len(moved))
+	}
+	fmt.Println()
+
+	if *fixRedirects && len(moved) > 0 {
+		fixRedirectedURLs(db, moved, locked, *yes, *force)
+	}
+}
+
+// fixRedirectedURLs points moved bookmarks at their new location. A
+// bookmark whose new URL is already saved separately is left for dedupe.
+func fixRedirectedURLs(db *sql.DB, moved []linkCheck, locked map[int64]bool, yes, force bool) {
+	slices.SortFunc(moved, func(a, b linkCheck) int { return int(a.bookmark.ID - b.bookmark.ID) })
+	saved := make(map[string]int64)
+	err := queryEach(db, "SELECT id, url FROM bookmarks", func(rows *sql.Rows) error {
+		var id int64
+		var uri string
+		err := rows.Scan(&id, &uri)
+		saved[uri] = id
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+
+	var fixes []linkCheck
+	for _, c := range moved {
+		c.movedTo = canonicalURL(c.movedTo, canonicalization)
+		switch id, ok := saved[c.movedTo]; {
+		case c.movedTo == c.bookmark.URI:
+		case ok:
+			fmt.Printf("%d\t%s is already saved as %d, see bmark dedupe\n", c.bookmark.ID, c.movedTo, id)
+		case locked[c.bookmark.ID] && !force:
+			fmt.Printf("%d\t%s is locked, use --force to update it\n", c.bookmark.ID, c.bookmark.URI)
+		default:
+			fmt.Printf("%d\t%s -> %s\n", c.bookmark.ID, c.bookmark.URI, c.movedTo)
+			fixes = append(fixes, c)
+			saved[c.movedTo] = c.bookmark.ID
+		}
+	}
+	if len(fixes) == 0 {
+		return
+	}
+	if !yes && !confirm(fmt.Sprintf("Update %d URL(s)?", len(fixes))) {
+		fmt.Println("No URLs were updated.")
+		return
+	}
+
+	now := time.Now().Unix()
+	err = inTagTx(db, force, func(tx *sql.Tx) error {
+		for _, c := range fixes {
+			if err := saveRevision(tx, c.bookmark.ID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE bookmarks SET url = ?, updated_at = ? WHERE id = ?", c.movedTo, now, c.bookmark.ID); err != nil {
+				return fmt.Errorf("failed to update %s: %w", c.bookmark.URI, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to update redirected URLs: %v", err)
+	}
+	fmt.Printf("Updated %d URL(s), the old ones are in bmark history\n", len(fixes))
+}
+
+type redirectTraceKey struct{}
+
+// redirectTrace follows the redirects of one request.
+type redirectTrace struct {
+	hops      int
+	permanent bool
+}
+
+// traceRedirect is the CheckRedirect of the link checker. It notes in
+// the redirectTrace of the request whether every redirect is permanent.
+func traceRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if t, ok := req.Context().Value(redirectTraceKey{}).(*redirectTrace); ok {
+		if t.hops == 0 {
+			t.permanent = true
+		}
+		t.hops++
+		if code := req.Response.StatusCode; code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			t.permanent = false
+		}
+	}
+	return nil
+}
+
+// checkLinks checks bookmarks with a pool of workers and streams the
+// results, in no particular order.
+func checkLinks(client *http.Client, bookmarks []Bookmark, concurrency int) <-chan linkCheck {
+	queue := make(chan Bookmark)
+	results := make(chan linkCheck)
+	var wg sync.WaitGroup
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range queue {
+				status, movedTo, err := checkLink(client, b.URI)
+				results <- linkCheck{bookmark: b, status: status, err: err, movedTo: movedTo}
+			}
+		}()
+	}
+	go func() {
+		for _, b := range bookmarks {
+			queue <- b
+		}
+		close(queue)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// checkLink returns the status of uri after redirects, and the final URL
+// when the page has moved permanently. It asks with HEAD first and falls
+// back to GET for servers that do not answer HEAD properly.
+func checkLink(client *http.Client, uri string) (int, string, error) {
+	status, movedTo, err := requestStatus(client, "HEAD", uri)
+	if err == nil && status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented &&
+		status != http.StatusForbidden && status != http.StatusBadRequest {
+		return status, movedTo, nil
+	}
+	return requestStatus(client, "GET", uri)
+}
+
+func requestStatus(client *http.Client, method, uri string) (int, string, error) {
+	trace := &redirectTrace{}
+	req, err := http.NewRequestWithContext(context.WithValue(context.Background(), redirectTraceKey{}, trace), method, uri, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("User-Agent", checkUserAgent)
+	resp, err := client.Do(req)
+	if uerr, ok := err.(*url.Error); ok {
+		// The URL is shown next to the error anyway.
+		return 0, "", uerr.Err
+	} else if err != nil {
+		return 0, "", err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	movedTo := ""
+	if trace.hops > 0 && trace.permanent {
+		movedTo = resp.Request.URL.String()
+	}
+	return resp.StatusCode, movedTo, nil
+}
+
+// recordCheck stores the outcome of a check and adds or removes the dead
+// tag. It returns the number of failed checks in a row.
+func recordCheck(db *sql.DB, c linkCheck, deadAfter int, locked bool) (int, error) {
+	var failures int
+	err := inTagTx(db, true, func(tx *sql.Tx) error {
+		status := sql.NullInt64{Int64: int64(c.status), Valid: c.err == nil}
+		checkErr := ""
+		if c.err != nil {
+			checkErr = c.err.Error()
+		}
+		_, err := tx.Exec(`UPDATE bookmarks SET check_status = ?, check_error = ?, checked_at = ?,
+			check_failures = CASE WHEN ? THEN 0 ELSE check_failures + 1 END WHERE id = ?`,
+			status, nullIfEmpty(checkErr), time.Now().Unix(), c.ok(), c.bookmark.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow("SELECT check_failures FROM bookmarks WHERE id = ?", c.bookmark.ID).Scan(&failures); err != nil {
+			return err
+		}
+
+		hasTag := slices.Contains(c.bookmark.Tags, deadTag)
+		switch {
+		case locked:
+		case c.ok() && hasTag:
+			_, err = tx.Exec(`DELETE FROM bookmark_tags WHERE bookmark_id = ?
+				AND tag_id = (SELECT id FROM tags WHERE tag = ?)`, c.bookmark.ID, deadTag)
+		case !c.ok() && !hasTag && (c.gone() || failures >= deadAfter):
+			err = linkTags(tx, c.bookmark.ID, []string{deadTag})
+		}
+		return err
+	})
+	return failures, err
+}
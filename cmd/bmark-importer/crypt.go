@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// age encryption runs in process with filippo.io/age, so exports can be
+// encrypted without the age tool installed. GPG is delegated to the gpg
+// command line tool and its agent, so no GPG key handling lives here.
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+type commandWriter struct {
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func (w *commandWriter) Write(p []byte) (int, error) { return w.stdin.Write(p) }
+
+func (w *commandWriter) Close() error {
+	if err := w.stdin.Close(); err != nil {
+		return err
+	}
+	return w.cmd.Wait()
+}
+
+// encryptingWriter wraps dst so that everything written is encrypted for
+// spec, which is "age:RECIPIENT", "age:RECIPIENTS_FILE" or "gpg:KEY_ID".
+// An empty spec writes through unchanged. Close must be called to flush
+// the ciphertext.
+func encryptingWriter(dst io.Writer, spec string) (io.WriteCloser, error) {
+	if spec == "" {
+		return nopWriteCloser{dst}, nil
+	}
+
+	tool, recipient, ok := strings.Cut(spec, ":")
+	if !ok || recipient == "" {
+		return nil, fmt.Errorf("invalid encryption spec %q, expected age:RECIPIENT or gpg:KEY_ID", spec)
+	}
+
+	var cmd *exec.Cmd
+	switch tool {
+	case "age":
+		return ageEncryptingWriter(dst, []string{recipient})
+	case "gpg":
+		cmd = exec.Command("gpg", "--batch", "--yes", "--encrypt", "--recipient", recipient, "--output", "-")
+	default:
+		return nil, fmt.Errorf("unknown encryption tool %q, use age or gpg", tool)
+	}
+
+	cmd.Stdout = dst
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", tool, err)
+	}
+	return &commandWriter{stdin: stdin, cmd: cmd}, nil
+}
+
+// ageEncryptingWriter encrypts everything written to it for all of the
+// recipients, each an age public key or the path of a recipients file.
+func ageEncryptingWriter(dst io.Writer, recipients []string) (io.WriteCloser, error) {
+	var parsed []age.Recipient
+	for _, recipient := range recipients {
+		if file, err := os.Open(recipient); err == nil {
+			list, err := age.ParseRecipients(file)
+			file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read recipients file %s: %w", recipient, err)
+			}
+			parsed = append(parsed, list...)
+			continue
+		}
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", recipient, err)
+		}
+		parsed = append(parsed, r)
+	}
+	return age.Encrypt(dst, parsed...)
+}
+
+func encryptedExtension(spec string) string {
+	if strings.HasPrefix(spec, "gpg:") {
+		return ".gpg"
+	}
+	return ".age"
+}
+
+func isEncrypted(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".age", ".gpg", ".asc":
+		return true
+	}
+	return false
+}
+
+// decryptFile decrypts an export written with --encrypt or --encrypt-to.
+// age needs an identity file; gpg finds the secret key through its agent.
+func decryptFile(path, identity string) ([]byte, error) {
+	if strings.EqualFold(filepath.Ext(path), ".age") {
+		if identity == "" {
+			return nil, fmt.Errorf("%s is age-encrypted, pass --identity with your age key file", path)
+		}
+		return ageDecryptFile(path, identity)
+	}
+	cmd := exec.Command("gpg", "--batch", "--quiet", "--decrypt", path)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return out.Bytes(), nil
+}
+
+func ageDecryptFile(path, identity string) ([]byte, error) {
+	keys, err := os.Open(identity)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := age.ParseIdentities(keys)
+	keys.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file %s: %w", identity, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := age.Decrypt(file, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The default columns match what spreadsheet users and Raindrop's CSV
+// importer expect.
+var defaultCSVColumns = []string{"url", "title", "note", "tags", "created_at"}
+
+var csvColumns = map[string]func(b Bookmark) string{
+	"id":    func(b Bookmark) string { return strconv.FormatInt(b.ID, 10) },
+	"url":   func(b Bookmark) string { return b.URI },
+	"title": func(b Bookmark) string { return b.Title },
+	"note":  func(b Bookmark) string { return b.Note },
+	"tags":  func(b Bookmark) string { return strings.Join(b.Tags, ",") },
+	"created_at": func(b Bookmark) string {
+		return formatTime(b.CreatedAt)
+	},
+	"updated_at": func(b Bookmark) string {
+		return formatTime(b.UpdatedAt)
+	},
+	"last_visited_at": func(b Bookmark) string {
+		if b.LastVisit == 0 {
+			return ""
+		}
+		return formatTime(b.LastVisit)
+	},
+	"keyword":  func(b Bookmark) string { return b.Keyword },
+	"private":  func(b Bookmark) string { return strconv.FormatBool(b.Private) },
+	"unread":   func(b Bookmark) string { return strconv.FormatBool(b.Unread) },
+	"starred":  func(b Bookmark) string { return strconv.FormatBool(b.Starred) },
+	"archived": func(b Bookmark) string { return strconv.FormatBool(b.Archived) },
+	"rating": func(b Bookmark) string {
+		if b.Rating == 0 {
+			return ""
+		}
+		return strconv.Itoa(b.Rating)
+	},
+}
+
+func csvColumnNames() []string {
+	names := make([]string, 0, len(csvColumns))
+	for name := range csvColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateCSVColumns(columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("at least one CSV column is required")
+	}
+	for _, column := range columns {
+		if _, ok := csvColumns[column]; !ok {
+			return fmt.Errorf("unknown CSV column %q, available: %s", column, strings.Join(csvColumnNames(), ", "))
+		}
+	}
+	return nil
+}
+
+func writeCSV(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	w := csv.NewWriter(out)
+	w.Comma = opts.Delimiter
+
+	if err := w.Write(opts.Columns); err != nil {
+		return 0, err
+	}
+
+	bookmarkCount := 0
+	record := make([]string, len(opts.Columns))
+	err := forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		for i, column := range opts.Columns {
+			record[i] = csvColumns[column](b)
+		}
+		bookmarkCount++
+		return w.Write(record)
+	})
+	if err != nil {
+		return bookmarkCount, err
+	}
+
+	w.Flush()
+	return bookmarkCount, w.Error()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dedupeCommand groups saved bookmarks whose URLs share a urlKey and
+// merges each group into one bookmark. The survivor gains the tags of the
+// others and their notes, appended below its own, and keeps everything
+// else; the others go to the trash. Without --auto each group is shown
+// and the bookmark to keep is asked for. With --by-content bookmarks are
+// grouped by the hash of their archived page text instead, which catches
+// the same article under different URLs.
+func dedupeCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	auto := fs.String("auto", "", "merge without asking, keeping the newest or oldest bookmark of each group")
+	dryRun := fs.Bool("dry-run", false, "only show the duplicates")
+	force := fs.Bool("force", false, "merge groups with locked bookmarks too")
+	byContent := fs.Bool("by-content", false, "group bookmarks whose archived pages have the same text")
+	fs.Parse(args)
+
+	if *auto != "" && *auto != "newest" && *auto != "oldest" {
+		fmt.Println("Usage: importer-exporter dedupe [--auto newest|oldest] [--dry-run] [--force] [--by-content]")
+		os.Exit(1)
+	}
+
+	var hashes map[int64]string
+	if *byContent {
+		var err error
+		if hashes, err = contentHashes(db); err != nil {
+			log.Fatalf("Failed to read page texts: %v", err)
+		}
+	}
+	byKey := make(map[string][]Bookmark)
+	var keys []string
+	err := forEachBookmark(db, bookmarkFilter{}, func(b Bookmark) error {
+		key := urlKey(b.URI)
+		if *byContent {
+			if key = hashes[b.ID]; key == "" {
+				return nil
+			}
+		}
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], b)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+
+	var groups [][]Bookmark
+	for _, key := range keys {
+		if group := byKey[key]; len(group) > 1 {
+			// Newest first, so the default choice is the latest copy.
+			sort.SliceStable(group, func(i, j int) bool { return group[i].CreatedAt > group[j].CreatedAt })
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		fmt.Println("No duplicates found.")
+		return
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	merged, removed, skipped := 0, 0, 0
+	for n, group := range groups {
+		fmt.Printf("Group %d of %d:\n", n+1, len(groups))
+		hasLocked := false
+		for i, b := range group {
+			mark := ""
+			if locked[b.ID] {
+				mark = " (locked)"
+				hasLocked = true
+			}
+			fmt.Printf("  %d) %d  %s  %s  [%s]%s\n", i+1, b.ID, time.Unix(b.CreatedAt, 0).Format("2006-01-02"),
+				b.URI, strings.Join(b.Tags, ","), mark)
+		}
+		if *dryRun {
+			continue
+		}
+		if hasLocked && !*force {
+			fmt.Println("  Skipped, it has locked bookmarks (use --force)")
+			skipped++
+			continue
+		}
+
+		keep := 0
+		switch *auto {
+		case "oldest":
+			keep = len(group) - 1
+		case "":
+			fmt.Fprintf(os.Stderr, "Keep which bookmark? [1-%d, s to skip, q to stop] (1) ", len(group))
+			answer, err := in.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer == "q" || answer == "" && err != nil {
+				fmt.Printf("Merged %d group(s), moved %d bookmark(s) to the trash\n", merged, removed)
+				return
+			}
+			if answer == "s" {
+				skipped++
+				continue
+			}
+			if answer != "" {
+				i, err := strconv.Atoi(answer)
+				if err != nil || i < 1 || i > len(group) {
+					fmt.Println("  Skipped, no such bookmark")
+					skipped++
+					continue
+				}
+				keep = i - 1
+			}
+		}
+
+		survivor := group[keep]
+		others := append(append([]Bookmark{}, group[:keep]...), group[keep+1:]...)
+		if err := mergeDuplicates(db, survivor, others, *force); err != nil {
+			log.Fatalf("Failed to merge into %s: %v", survivor.URI, err)
+		}
+		fmt.Printf("  Kept %d %s\n", survivor.ID, survivor.URI)
+		merged++
+		removed += len(others)
+	}
+	if *dryRun {
+		return
+	}
+	fmt.Printf("Merged %d group(s), moved %d bookmark(s) to the trash", merged, removed)
+	if skipped > 0 {
+		fmt.Printf(", skipped %d", skipped)
+	}
+	fmt.Println()
+}
+
+// mergeDuplicates folds the tags and notes of others into survivor and
+// moves them to the trash. A note is only added once, and the survivor
+// takes the first title when it has none.
+func mergeDuplicates(db *sql.DB, survivor Bookmark, others []Bookmark, force bool) error {
+	title := survivor.Title
+	notes := []string{}
+	seen := make(map[string]bool)
+	if note := strings.TrimSpace(survivor.Note); note != "" {
+		notes = append(notes, note)
+		seen[note] = true
+	}
+	var tags []string
+	for _, b := range others {
+		tags = append(tags, b.Tags...)
+		if title == "" {
+			title = b.Title
+		}
+		if note := strings.TrimSpace(b.Note); note != "" && !seen[note] {
+			notes = append(notes, note)
+			seen[note] = true
+		}
+	}
+
+	now := time.Now().Unix()
+	return inTagTx(db, force, func(tx *sql.Tx) error {
+		if err := saveRevision(tx, survivor.ID); err != nil {
+			return err
+		}
+		for _, b := range others {
+			if _, err := tx.Exec("UPDATE bookmarks SET deleted_at = ? WHERE id = ?", now, b.ID); err != nil {
+				return fmt.Errorf("failed to trash %s: %w", b.URI, err)
+			}
+		}
+		_, err := tx.Exec("UPDATE bookmarks SET title = ?, note = ?, updated_at = ? WHERE id = ?",
+			title, strings.Join(notes, "\n\n"), now, survivor.ID)
+		if err != nil {
+			return err
+		}
+		return linkTags(tx, survivor.ID, tags)
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	_ "embed"
+	"fmt"
+)
+
+//go:embed fixtures/demo.html
+var demoFixtures []byte
+
+// newDemoDatabase opens a database at dsn and fills it with the embedded
+// demo bookmarks. It backs the --demo flag with a throwaway file, and with
+// ":memory:" gives integrations a populated database that needs no disk.
+func newDemoDatabase(dsn string) (*sql.DB, error) {
+	db, err := openDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := htmlOptions{Folders: "table"}
+	summary, err := importJobs(db, func(jobs chan<- Job) error {
+		return parseNetscape(bytes.NewReader(demoFixtures), jobs, opts)
+	})
+	if err == nil && len(summary.Errors) > 0 {
+		err = summary.Errors[0]
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load demo bookmarks: %w", err)
+	}
+	return db, nil
+}
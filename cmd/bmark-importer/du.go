@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type usageEntry struct {
+	Name  string
+	Rows  int64
+	Bytes int64
+}
+
+// diskUsage reports how much space the database takes and what it is
+// spent on. SQLite does not expose per-table page counts without the
+// dbstat extension, so table and breakdown sizes are estimates based on
+// the length of the stored values.
+func diskUsage(db *sql.DB, dbFile string, args []string) {
+	fs := flag.NewFlagSet("du", flag.ExitOnError)
+	by := fs.String("by", "", "break bookmark sizes down by tag or domain")
+	limit := fs.Int("limit", 20, "number of entries to show in the breakdown")
+	fs.Parse(args)
+
+	fmt.Printf("Database file      %10s  %s\n", formatBytes(fileSize(dbFile)), dbFile)
+	if size := fileSize(dbFile + "-wal"); size > 0 {
+		fmt.Printf("Write-ahead log    %10s\n", formatBytes(size))
+	}
+
+	var pageSize, freePages int64
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		log.Fatalf("Failed to read page size: %v", err)
+	}
+	if err := db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		log.Fatalf("Failed to read free page count: %v", err)
+	}
+	fmt.Printf("Free pages         %10s\n", formatBytes(pageSize*freePages))
+
+	tables, err := tableUsage(db)
+	if err != nil {
+		log.Fatalf("Failed to measure tables: %v", err)
+	}
+	fmt.Println("")
+	fmt.Println("Tables (approximate content size):")
+	for _, t := range tables {
+		fmt.Printf("  %-24s %8d rows %10s\n", t.Name, t.Rows, formatBytes(t.Bytes))
+	}
+
+	switch *by {
+	case "":
+	case "tag", "domain":
+		entries, err := bookmarkUsage(db, *by)
+		if err != nil {
+			log.Fatalf("Failed to measure bookmarks by %s: %v", *by, err)
+		}
+		fmt.Println("")
+		fmt.Printf("Bookmarks by %s (approximate):\n", *by)
+		for i, e := range entries {
+			if i == *limit {
+				fmt.Printf("  ... %d more\n", len(entries)-i)
+				break
+			}
+			fmt.Printf("  %-40s %8d %10s\n", e.Name, e.Rows, formatBytes(e.Bytes))
+		}
+	default:
+		log.Fatalf("Unknown breakdown: %s (use tag or domain)", *by)
+	}
+
+	// Deleting only moves bookmarks to the trash, so emptying it is what
+	// frees their space.
+	var trashed usageEntry
+	err = db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(LENGTH(url) + COALESCE(LENGTH(title), 0) + COALESCE(LENGTH(note), 0)), 0)
+		FROM bookmarks WHERE deleted_at IS NOT NULL`).Scan(&trashed.Rows, &trashed.Bytes)
+	if err != nil {
+		log.Fatalf("Failed to measure trash: %v", err)
+	}
+	if trashed.Rows > 0 {
+		fmt.Println("")
+		fmt.Printf("Trash              %10s  %d bookmarks\n", formatBytes(trashed.Bytes), trashed.Rows)
+	}
+
+	fmt.Println("")
+	fmt.Println("To reclaim space:")
+	fmt.Println("  bmark trash empty               delete trashed bookmarks for good")
+	fmt.Println("  bmark tag prune                 remove tags no bookmark uses")
+	if freePages > 0 {
+		fmt.Printf("  sqlite3 %s VACUUM   return free pages to the file system\n", dbFile)
+	}
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// tableUsage estimates the content size of every regular table, so tables
+// added by later schema versions are covered without listing them here.
+// Virtual tables are skipped; their storage shows up in their shadow
+// tables.
+func tableUsage(db *sql.DB) ([]usageEntry, error) {
+	rows, err := db.Query(`
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND sql NOT LIKE 'CREATE VIRTUAL%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	var entries []usageEntry
+	for _, name := range names {
+		columns, err := tableColumns(db, name)
+		if err != nil {
+			return nil, err
+		}
+		var lengths []string
+		for _, column := range columns {
+			lengths = append(lengths, fmt.Sprintf(`COALESCE(LENGTH("%s"), 0)`, column))
+		}
+		e := usageEntry{Name: name}
+		query := fmt.Sprintf(`SELECT COUNT(*), COALESCE(SUM(%s), 0) FROM "%s"`, strings.Join(lengths, " + "), name)
+		if err := db.QueryRow(query).Scan(&e.Rows, &e.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to measure %s: %w", name, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func tableColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// bookmarkUsage groups the size of each bookmark (URL, title and note) by
+// tag or by host, largest first. A bookmark with several tags is counted
+// under each of them. Trashed bookmarks are left out, as in list; diskUsage
+// reports them on their own.
+func bookmarkUsage(db *sql.DB, by string) ([]usageEntry, error) {
+	rows, err := db.Query(`
+		SELECT b.url, LENGTH(b.url) + COALESCE(LENGTH(b.title), 0) + COALESCE(LENGTH(b.note), 0),
+			COALESCE(GROUP_CONCAT(t.tag, ','), '')
+		FROM bookmarks b
+		LEFT JOIN bookmark_tags bt ON b.id = bt.bookmark_id
+		LEFT JOIN tags t ON bt.tag_id = t.id
+		WHERE b.deleted_at IS NULL
+		GROUP BY b.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]*usageEntry)
+	add := func(name string, size int64) {
+		e, ok := totals[name]
+		if !ok {
+			e = &usageEntry{Name: name}
+			totals[name] = e
+		}
+		e.Rows++
+		e.Bytes += size
+	}
+
+	for rows.Next() {
+		var uri, tags string
+		var size int64
+		if err := rows.Scan(&uri, &size, &tags); err != nil {
+			return nil, err
+		}
+		if by == "domain" {
+			host := urlHost(uri)
+			if host == "" {
+				host = "(no host)"
+			}
+			add(host, size)
+			continue
+		}
+		if tags == "" {
+			add("(untagged)", size)
+			continue
+		}
+		for _, tag := range strings.Split(tags, ",") {
+			add(tag, size)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]usageEntry, 0, len(totals))
+	for _, e := range totals {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
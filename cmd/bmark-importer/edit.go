@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// editCommand changes one bookmark, picked by ID or exact URL. Only the
+// given fields change; --set-tags replaces all tags, while --add-tag and
+// --rm-tag adjust them. With --editor the URL, title, tags and note are
+// edited as a document in $EDITOR instead. Every edit bumps updated_at.
+func editCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	title := fs.String("title", "", "new title")
+	note := fs.String("note", "", "new note")
+	newURL := fs.String("url", "", "new URL")
+	keyword := fs.String("keyword", "", "unique keyword for bmark open; empty removes it")
+	addTags := fs.String("add-tag", "", "comma-separated tags to add")
+	rmTags := fs.String("rm-tag", "", "comma-separated tags to remove")
+	setTags := fs.String("set-tags", "", "comma-separated tags replacing all current ones")
+	force := fs.Bool("force", false, "edit the bookmark even if it is locked")
+	editor := fs.Bool("editor", false, "edit the URL, title, tags and note in $EDITOR")
+
+	var key string
+	if keys := parseInterspersed(fs, args); len(keys) == 1 {
+		key = keys[0]
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	delete(set, "force")
+	if key == "" || len(set) == 0 {
+		fmt.Println("Usage: importer-exporter edit ID|URL [--title TITLE] [--note NOTE] [--url URL] [--keyword KEYWORD] [--add-tag TAGS] [--rm-tag TAGS] [--set-tags TAGS] | --editor")
+		os.Exit(1)
+	}
+	if *editor && len(set) > 1 {
+		log.Fatalf("--editor cannot be combined with other fields")
+	}
+	if set["url"] && strings.TrimSpace(*newURL) == "" {
+		log.Fatalf("The URL cannot be empty")
+	}
+
+	id, err := findBookmarkID(db, key)
+	if err == sql.ErrNoRows {
+		fmt.Printf("No bookmark matches %s\n", key)
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalf("Failed to find bookmark %s: %v", key, err)
+	}
+	if *editor {
+		bookmarks, err := selectBookmarks(db, []string{strconv.FormatInt(id, 10)}, "")
+		if err != nil || len(bookmarks) != 1 {
+			log.Fatalf("Failed to read bookmark %s: %v", key, err)
+		}
+		if _, _, ok := editInEditor(db, bookmarks, *force); ok {
+			fmt.Printf("Updated %s\n", key)
+		}
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if *force {
+		if err := overrideLocks(tx); err != nil {
+			log.Fatalf("Failed to edit %s: %v", key, err)
+		}
+	}
+
+	// The keyword is not part of the history.
+	if len(set) > 1 || !set["keyword"] {
+		if err := saveRevision(tx, id); err != nil {
+			log.Fatalf("Failed to edit %s: %v", key, err)
+		}
+	}
+
+	columns := []string{"updated_at = ?"}
+	values := []any{time.Now().Unix()}
+	if set["title"] {
+		columns = append(columns, "title = ?")
+		values = append(values, *title)
+	}
+	if set["note"] {
+		columns = append(columns, "note = ?")
+		values = append(values, *note)
+	}
+	if set["url"] {
+		columns = append(columns, "url = ?")
+		values = append(values, strings.TrimSpace(*newURL))
+	}
+	if set["keyword"] {
+		kw := strings.TrimSpace(*keyword)
+		var owner int64
+		err := tx.QueryRow("SELECT id FROM bookmarks WHERE keyword = ? AND id != ?", kw, id).Scan(&owner)
+		if err == nil && kw != "" {
+			log.Fatalf("Keyword %s is already used by bookmark %d", kw, owner)
+		} else if err != nil && err != sql.ErrNoRows {
+			log.Fatalf("Failed to check keyword %s: %v", kw, err)
+		}
+		columns = append(columns, "keyword = ?")
+		values = append(values, nullIfEmpty(kw))
+	}
+	if _, err := tx.Exec("UPDATE bookmarks SET "+strings.Join(columns, ", ")+" WHERE id = ?", append(values, id)...); err != nil {
+		log.Fatalf("Failed to update bookmark %s: %v", key, err)
+	}
+
+	if set["set-tags"] {
+		if _, err := tx.Exec("DELETE FROM bookmark_tags WHERE bookmark_id = ?", id); err != nil {
+			log.Fatalf("Failed to clear tags: %v", err)
+		}
+		if err := linkTags(tx, id, splitTags(*setTags)); err != nil {
+			log.Fatalf("Failed to set tags: %v", err)
+		}
+	}
+	for _, tag := range splitTags(*rmTags) {
+		_, err := tx.Exec(`DELETE FROM bookmark_tags WHERE bookmark_id = ?
+			AND tag_id IN (SELECT id FROM tags WHERE tag = ?)`, id, tag)
+		if err != nil {
+			log.Fatalf("Failed to remove tag %s: %v", tag, err)
+		}
+	}
+	if err := linkTags(tx, id, splitTags(*addTags)); err != nil {
+		log.Fatalf("Failed to add tags: %v", err)
+	}
+
+	if *force {
+		if err := restoreLocks(tx); err != nil {
+			log.Fatalf("Failed to edit %s: %v", key, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to save bookmark %s: %v", key, err)
+	}
+	fmt.Printf("Updated %s\n", key)
+}
+
+// findBookmarkID resolves an ID or exact URL to a bookmark ID. It
+// returns sql.ErrNoRows when nothing matches.
+func findBookmarkID(db *sql.DB, key string) (int64, error) {
+	var id int64
+	if n, err := strconv.ParseInt(key, 10, 64); err == nil {
+		return n, db.QueryRow("SELECT id FROM bookmarks WHERE id = ? AND deleted_at IS NULL", n).Scan(&id)
+	}
+	err := db.QueryRow("SELECT id FROM bookmarks WHERE url = ? AND deleted_at IS NULL", key).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Bookmarks are edited in $EDITOR as a small TOML document, one
+// [[bookmark]] table per bookmark:
+//
+//	[[bookmark]]
+//	id = 12
+//	url = "https://go.dev/"
+//	title = "The Go Programming Language"
+//	tags = ["go", "lang"]
+//	note = """
+//	Several lines
+//	of note."""
+//
+// Only the part of TOML needed for this is read: strings in all four
+// quoting styles, integers, arrays of strings and comments.
+
+// editableBookmark holds the fields of a bookmark that can be edited as
+// text. Set lists the keys present in the document; missing keys keep
+// their current value.
+type editableBookmark struct {
+	ID    int64
+	URL   string
+	Title string
+	Note  string
+	Tags  []string
+	Set   map[string]bool
+	Line  int
+}
+
+func editableFrom(b Bookmark) editableBookmark {
+	return editableBookmark{ID: b.ID, URL: b.URI, Title: b.Title, Note: b.Note, Tags: b.Tags}
+}
+
+// writeEditDoc writes bookmarks as a document for parseEditDoc, after the
+// header lines as comments.
+func writeEditDoc(w io.Writer, header []string, bookmarks []editableBookmark) error {
+	var sb strings.Builder
+	for _, line := range header {
+		sb.WriteString("# " + line + "\n")
+	}
+	for _, b := range bookmarks {
+		quoted := make([]string, len(b.Tags))
+		for i, tag := range b.Tags {
+			quoted[i] = tomlString(tag)
+		}
+		note := tomlString(b.Note)
+		if strings.Contains(b.Note, "\n") {
+			note = `"""` + "\n" + tomlMultiline(b.Note) + `"""`
+		}
+		fmt.Fprintf(&sb, "\n[[bookmark]]\nid = %d\nurl = %s\ntitle = %s\ntags = [%s]\nnote = %s\n",
+			b.ID, tomlString(b.URL), tomlString(b.Title), strings.Join(quoted, ", "), note)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func tomlString(s string) string {
+	return `"` + tomlEscape(s, false) + `"`
+}
+
+func tomlMultiline(s string) string {
+	return tomlEscape(s, true)
+}
+
+func tomlEscape(s string, multiline bool) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '"':
+			sb.WriteString(`\"`)
+		case r == '\n' && multiline:
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\u%04X`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+type editDocParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *editDocParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *editDocParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *editDocParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skip passes over spaces and comments, and over newlines too when
+// newlines is set.
+func (p *editDocParser) skip(newlines bool) {
+	for !p.eof() {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.next()
+		case c == '\n' && newlines:
+			p.next()
+		case c == '#':
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.next()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// parseEditDoc reads a document written by writeEditDoc and edited by
+// the user.
+func parseEditDoc(src string) ([]editableBookmark, error) {
+	p := &editDocParser{src: src, line: 1}
+	var bookmarks []editableBookmark
+	for {
+		p.skip(true)
+		if p.eof() {
+			return bookmarks, nil
+		}
+		if strings.HasPrefix(p.src[p.pos:], "[[") {
+			end := strings.Index(p.src[p.pos:], "]]")
+			if end < 0 {
+				return nil, p.errorf("missing ]]")
+			}
+			if name := strings.TrimSpace(p.src[p.pos+2 : p.pos+end]); name != "bookmark" {
+				return nil, p.errorf("unknown table [[%s]], only [[bookmark]] is allowed", name)
+			}
+			bookmarks = append(bookmarks, editableBookmark{Set: make(map[string]bool), Line: p.line})
+			p.pos += end + 2
+		} else {
+			if len(bookmarks) == 0 {
+				return nil, p.errorf("expected [[bookmark]]")
+			}
+			if err := p.keyValue(&bookmarks[len(bookmarks)-1]); err != nil {
+				return nil, err
+			}
+		}
+		p.skip(false)
+		if !p.eof() && p.src[p.pos] != '\n' {
+			return nil, p.errorf("unexpected %q at end of line", p.src[p.pos])
+		}
+	}
+}
+
+func (p *editDocParser) keyValue(b *editableBookmark) error {
+	start := p.pos
+	for !p.eof() && (isBareKeyChar(p.src[p.pos])) {
+		p.pos++
+	}
+	key := p.src[start:p.pos]
+	if key == "" {
+		return p.errorf("expected a key such as title = \"...\"")
+	}
+	p.skip(false)
+	if p.eof() || p.next() != '=' {
+		return p.errorf("expected = after %s", key)
+	}
+	p.skip(false)
+	if b.Set[key] {
+		return p.errorf("%s is set twice", key)
+	}
+	b.Set[key] = true
+
+	var err error
+	switch key {
+	case "id":
+		start := p.pos
+		for !p.eof() && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '_') {
+			p.pos++
+		}
+		b.ID, err = strconv.ParseInt(strings.ReplaceAll(p.src[start:p.pos], "_", ""), 10, 64)
+		if err != nil {
+			return p.errorf("id must be a number")
+		}
+	case "url":
+		b.URL, err = p.stringValue()
+	case "title":
+		b.Title, err = p.stringValue()
+	case "note":
+		b.Note, err = p.stringValue()
+	case "tags":
+		b.Tags, err = p.stringArray()
+	default:
+		return p.errorf("unknown key %s, use id, url, title, tags or note", key)
+	}
+	return err
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *editDocParser) stringArray() ([]string, error) {
+	if p.eof() || p.next() != '[' {
+		return nil, p.errorf("expected an array like [\"a\", \"b\"]")
+	}
+	var values []string
+	for {
+		p.skip(true)
+		if p.eof() {
+			return nil, p.errorf("missing ]")
+		}
+		if p.src[p.pos] == ']' {
+			p.next()
+			return values, nil
+		}
+		value, err := p.stringValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skip(true)
+		if !p.eof() && p.src[p.pos] == ',' {
+			p.next()
+		} else if p.eof() || p.src[p.pos] != ']' {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *editDocParser) stringValue() (string, error) {
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		p.pos += 3
+		p.trimFirstNewline()
+		return p.basicString(`"""`, true)
+	case strings.HasPrefix(rest, `'''`):
+		p.pos += 3
+		p.trimFirstNewline()
+		return p.literalString(`'''`)
+	case strings.HasPrefix(rest, `"`):
+		p.pos++
+		return p.basicString(`"`, false)
+	case strings.HasPrefix(rest, `'`):
+		p.pos++
+		return p.literalString(`'`)
+	}
+	return "", p.errorf("expected a quoted string")
+}
+
+func (p *editDocParser) trimFirstNewline() {
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos++
+	}
+	if strings.HasPrefix(p.src[p.pos:], "\n") {
+		p.next()
+	}
+}
+
+func (p *editDocParser) literalString(end string) (string, error) {
+	i := strings.Index(p.src[p.pos:], end)
+	if i < 0 || len(end) == 1 && strings.Contains(p.src[p.pos:p.pos+i], "\n") {
+		return "", p.errorf("unterminated string")
+	}
+	value := p.src[p.pos : p.pos+i]
+	for range i + len(end) {
+		p.next()
+	}
+	return value, nil
+}
+
+func (p *editDocParser) basicString(end string, multiline bool) (string, error) {
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], end) {
+			p.pos += len(end)
+			return sb.String(), nil
+		}
+		c := p.next()
+		switch {
+		case c == '\n' && !multiline:
+			return "", p.errorf("unterminated string")
+		case c != '\\':
+			sb.WriteByte(c)
+			continue
+		}
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		switch e := p.next(); e {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case '"', '\\':
+			sb.WriteByte(e)
+		case 'u', 'U':
+			size := 4
+			if e == 'U' {
+				size = 8
+			}
+			if p.pos+size > len(p.src) {
+				return "", p.errorf("short \\%c escape", e)
+			}
+			r, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("invalid \\%c escape", e)
+			}
+			sb.WriteRune(rune(r))
+			p.pos += size
+		case ' ', '\t', '\r', '\n':
+			// A backslash at the end of a line joins it with the next
+			// non-blank line.
+			if !multiline {
+				return "", p.errorf("invalid escape \\%c", e)
+			}
+			for !p.eof() && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+				p.next()
+			}
+		default:
+			return "", p.errorf("invalid escape \\%c", e)
+		}
+	}
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, falling back to vi. The
+// editor reads from the terminal even when bmark's input is a pipe.
+func runEditor(path string) error {
+	editor := strings.Fields(envOr("VISUAL", envOr("EDITOR", "vi")))
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		cmd.Stdin = tty
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", editor[0], err)
+	}
+	return nil
+}
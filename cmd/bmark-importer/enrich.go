@@ -0,0 +1,552 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const metadataSchema = `CREATE TABLE IF NOT EXISTS metadata (
+	bookmark_id INTEGER NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	source TEXT NOT NULL,
+	fetched_at INTEGER NOT NULL,
+	PRIMARY KEY (bookmark_id, key),
+	FOREIGN KEY (bookmark_id) REFERENCES bookmarks(id) ON DELETE CASCADE
+);`
+
+// An enricher fetches details about the pages of one site from its API
+// or oEmbed endpoint. Each returned key is stored as "<name>.<key>" in the
+// metadata table. To support another site, implement the interface and
+// add the enricher to newEnrichers.
+type enricher interface {
+	// Name identifies the enricher and prefixes its metadata keys.
+	Name() string
+	// Match reports whether the enricher knows how to handle u.
+	Match(u *url.URL) bool
+	Enrich(client *http.Client, u *url.URL) (map[string]string, error)
+}
+
+func newEnrichers() []enricher {
+	return []enricher{
+		pageEnricher{},
+		youtubeEnricher{apiKey: os.Getenv("YOUTUBE_API_KEY")},
+		githubEnricher{api: envOr("BMARK_GITHUB_API", "https://api.github.com"), token: os.Getenv("GITHUB_TOKEN")},
+		twitterEnricher{},
+	}
+}
+
+// enrichCommand stores metadata for the selected bookmarks: what the
+// page itself says (title, description, canonical URL and icon) and
+// site-specific details. Bookmarks already enriched by an enricher are
+// skipped unless --force is given. Pages are fetched concurrently, but
+// requests to one host are spaced out by --per-host-delay.
+func enrichCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("enrich", flag.ExitOnError)
+	tag := fs.String("tag", "", "only enrich bookmarks with these comma-separated tags")
+	domain := fs.String("domain", "", "only enrich bookmarks on this domain or its subdomains")
+	query := fs.String("query", "", "only enrich bookmarks matching this query, as for list -q")
+	force := fs.Bool("force", false, "fetch again even if metadata was stored before")
+	concurrency := fs.Int("concurrency", 8, "pages fetched at the same time")
+	delay := fs.Duration("per-host-delay", time.Second, "minimum time between requests to the same host")
+	fs.Parse(args)
+
+	var bookmarks []Bookmark
+	var err error
+	if fs.NArg() > 0 {
+		bookmarks, err = selectBookmarks(db, fs.Args(), "")
+	} else {
+		filter := bookmarkFilter{Tags: splitTags(*tag), Domain: strings.ToLower(strings.TrimSpace(*domain)), Query: *query}
+		err = forEachBookmark(db, filter, func(b Bookmark) error {
+			bookmarks = append(bookmarks, b)
+			return nil
+		})
+	}
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+
+	done, err := enrichedSources(db)
+	if err != nil {
+		log.Fatalf("Failed to read metadata: %v", err)
+	}
+	icons, err := loadFavicons(db)
+	if err != nil {
+		log.Fatalf("Failed to read favicons: %v", err)
+	}
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+
+	var tasks []enrichTask
+	for _, b := range bookmarks {
+		u, err := url.Parse(b.URI)
+		if err != nil {
+			continue
+		}
+		for _, e := range newEnrichers() {
+			if e.Match(u) && (!done[b.ID][e.Name()] || *force) {
+				tasks = append(tasks, enrichTask{bookmark: b, url: u, enricher: e})
+			}
+		}
+	}
+	if len(tasks) == 0 {
+		fmt.Println("Nothing to enrich.")
+		return
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second, Transport: newHostLimiter(http.DefaultTransport, *delay)}
+	results := make(chan enrichResult)
+	queue := make(chan enrichTask)
+	var wg sync.WaitGroup
+	for range max(*concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				values, err := t.enricher.Enrich(client, t.url)
+				results <- enrichResult{enrichTask: t, values: values, err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, t := range tasks {
+			queue <- t
+		}
+		close(queue)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results are stored here rather than by the workers, as the
+	// database has a single connection.
+	n, enriched, titled, failed := 0, 0, 0, 0
+	for r := range results {
+		n++
+		b, name := r.bookmark, r.enricher.Name()
+		if r.err != nil {
+			log.Printf("Error: [%d/%d] %s: %s: %v", n, len(tasks), name, b.URI, r.err)
+			failed++
+			continue
+		}
+		if err := storeMetadata(db, b.ID, name, r.values); err != nil {
+			log.Fatalf("Failed to store metadata for %s: %v", b.URI, err)
+		}
+		if name == "page" {
+			filled, err := applyPageInfo(db, b, r.values, icons, locked[b.ID])
+			if err != nil {
+				log.Fatalf("Failed to update %s: %v", b.URI, err)
+			}
+			if filled {
+				titled++
+			}
+		}
+		enriched++
+		fmt.Printf("[%d/%d] %s: %s\n", n, len(tasks), b.URI, formatMetadata(name, r.values))
+	}
+
+	fmt.Printf("Enriched %d bookmarks", enriched)
+	if titled > 0 {
+		fmt.Printf(", filled in %d title(s)", titled)
+	}
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+}
+
+type enrichTask struct {
+	bookmark Bookmark
+	url      *url.URL
+	enricher enricher
+}
+
+type enrichResult struct {
+	enrichTask
+	values map[string]string
+	err    error
+}
+
+// applyPageInfo gives an untitled bookmark the title of its page, unless
+// it is locked, and records the icon of a host that has none yet. It
+// reports whether the title was filled in.
+func applyPageInfo(db *sql.DB, b Bookmark, values map[string]string, icons map[string]favicon, locked bool) (bool, error) {
+	host := urlHost(b.URI)
+	_, hasIcon := icons[host]
+	setTitle := b.Title == "" && values["title"] != "" && !locked
+	if !setTitle && (hasIcon || values["icon"] == "") {
+		return false, nil
+	}
+	err := inTagTx(db, false, func(tx *sql.Tx) error {
+		if !hasIcon && values["icon"] != "" {
+			if err := storeFavicon(tx, b.URI, values["icon"], ""); err != nil {
+				return err
+			}
+			icons[host] = favicon{IconURI: values["icon"]}
+		}
+		if !setTitle {
+			return nil
+		}
+		if err := saveRevision(tx, b.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE bookmarks SET title = ?, updated_at = ? WHERE id = ?", values["title"], time.Now().Unix(), b.ID)
+		return err
+	})
+	return setTitle && err == nil, err
+}
+
+// hostLimiter is a RoundTripper that spaces out requests to each host by
+// at least delay, so fetching many bookmarks of one site stays polite.
+type hostLimiter struct {
+	next  http.RoundTripper
+	delay time.Duration
+	mu    sync.Mutex
+	slots map[string]time.Time
+}
+
+func newHostLimiter(next http.RoundTripper, delay time.Duration) *hostLimiter {
+	return &hostLimiter{next: next, delay: delay, slots: make(map[string]time.Time)}
+}
+
+func (l *hostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	l.mu.Lock()
+	at := time.Now()
+	if slot := l.slots[host]; slot.After(at) {
+		at = slot
+	}
+	l.slots[host] = at.Add(l.delay)
+	l.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(at)):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return l.next.RoundTrip(req)
+}
+
+// enrichedSources returns, per bookmark ID, the enrichers that already
+// stored metadata for it.
+func enrichedSources(db *sql.DB) (map[int64]map[string]bool, error) {
+	done := make(map[int64]map[string]bool)
+	err := queryEach(db, "SELECT DISTINCT bookmark_id, source FROM metadata", func(rows *sql.Rows) error {
+		var id int64
+		var source string
+		if err := rows.Scan(&id, &source); err != nil {
+			return err
+		}
+		if done[id] == nil {
+			done[id] = make(map[string]bool)
+		}
+		done[id][source] = true
+		return nil
+	})
+	return done, err
+}
+
+// storeMetadata replaces everything source stored for a bookmark.
+func storeMetadata(db *sql.DB, bookmarkID int64, source string, values map[string]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM metadata WHERE bookmark_id = ? AND source = ?", bookmarkID, source); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		_, err := tx.Exec("INSERT OR REPLACE INTO metadata (bookmark_id, key, value, source, fetched_at) VALUES (?, ?, ?, ?, ?)",
+			bookmarkID, source+"."+key, value, source, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func formatMetadata(source string, values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s.%s=%s", source, key, truncate(strings.Join(strings.Fields(values[key]), " "), titleWidth)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func getJSON(client *http.Client, uri string, header http.Header, result any) error {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// oEmbed is the subset of an oEmbed response the enrichers use.
+type oEmbed struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	AuthorURL    string `json:"author_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	HTML         string `json:"html"`
+}
+
+// pageEnricher reads the head of any web page. Besides being stored as
+// metadata, its title fills in missing bookmark titles and its icon the
+// favicon of the host.
+type pageEnricher struct{}
+
+func (pageEnricher) Name() string { return "page" }
+
+func (pageEnricher) Match(u *url.URL) bool {
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+func (pageEnricher) Enrich(client *http.Client, u *url.URL) (map[string]string, error) {
+	info, err := fetchPageInfo(client, u.String())
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{"title": info.Title, "description": info.Description, "icon": info.Icon}
+	if info.Canonical != u.String() {
+		values["canonical"] = info.Canonical
+	}
+	return values, nil
+}
+
+// youtubeEnricher uses YouTube's oEmbed endpoint for the channel. The
+// duration is only in the Data API, which needs $YOUTUBE_API_KEY.
+type youtubeEnricher struct {
+	apiKey string
+}
+
+func (youtubeEnricher) Name() string { return "youtube" }
+
+func (youtubeEnricher) Match(u *url.URL) bool {
+	return youtubeVideoID(u) != ""
+}
+
+func (e youtubeEnricher) Enrich(client *http.Client, u *url.URL) (map[string]string, error) {
+	var embed oEmbed
+	endpoint := "https://www.youtube.com/oembed?" + url.Values{"url": {u.String()}, "format": {"json"}}.Encode()
+	if err := getJSON(client, endpoint, nil, &embed); err != nil {
+		return nil, err
+	}
+	values := map[string]string{
+		"title":     embed.Title,
+		"channel":   embed.AuthorName,
+		"thumbnail": embed.ThumbnailURL,
+	}
+	if e.apiKey == "" {
+		return values, nil
+	}
+
+	var videos struct {
+		Items []struct {
+			ContentDetails struct {
+				Duration string `json:"duration"`
+			} `json:"contentDetails"`
+		} `json:"items"`
+	}
+	params := url.Values{"part": {"contentDetails"}, "id": {youtubeVideoID(u)}, "key": {e.apiKey}}
+	if err := getJSON(client, "https://www.googleapis.com/youtube/v3/videos?"+params.Encode(), nil, &videos); err != nil {
+		return nil, err
+	}
+	if len(videos.Items) > 0 {
+		values["duration"] = isoDuration(videos.Items[0].ContentDetails.Duration)
+	}
+	return values, nil
+}
+
+func youtubeVideoID(u *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	switch host {
+	case "youtu.be":
+		return strings.Trim(u.Path, "/")
+	case "youtube.com", "m.youtube.com", "music.youtube.com":
+		if u.Path == "/watch" {
+			return u.Query().Get("v")
+		}
+		if id, ok := strings.CutPrefix(u.Path, "/shorts/"); ok {
+			return strings.Trim(id, "/")
+		}
+	}
+	return ""
+}
+
+var isoDurationPattern = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// isoDuration turns an ISO 8601 duration such as PT1H2M3S into 1:02:03.
+func isoDuration(s string) string {
+	m := isoDurationPattern.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	var parts [3]int
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(m[i+1])
+	}
+	if parts[0] > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", parts[0], parts[1], parts[2])
+	}
+	return fmt.Sprintf("%d:%02d", parts[1], parts[2])
+}
+
+// githubEnricher reads repository details from the GitHub REST API.
+// Anonymous requests are limited to 60 an hour; $GITHUB_TOKEN raises that.
+type githubEnricher struct {
+	api   string
+	token string
+}
+
+func (githubEnricher) Name() string { return "github" }
+
+func (githubEnricher) Match(u *url.URL) bool {
+	_, _, ok := githubRepo(u)
+	return ok
+}
+
+func (e githubEnricher) Enrich(client *http.Client, u *url.URL) (map[string]string, error) {
+	owner, repo, _ := githubRepo(u)
+	header := http.Header{}
+	if e.token != "" {
+		header.Set("Authorization", "Bearer "+e.token)
+	}
+	var result struct {
+		Description string `json:"description"`
+		Stars       int    `json:"stargazers_count"`
+		Language    string `json:"language"`
+		Archived    bool   `json:"archived"`
+		License     *struct {
+			SPDXID string `json:"spdx_id"`
+		} `json:"license"`
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/%s", strings.TrimSuffix(e.api, "/"), url.PathEscape(owner), url.PathEscape(repo))
+	if err := getJSON(client, endpoint, header, &result); err != nil {
+		return nil, err
+	}
+	values := map[string]string{
+		"description": result.Description,
+		"stars":       strconv.Itoa(result.Stars),
+		"language":    result.Language,
+	}
+	if result.Archived {
+		values["archived"] = "true"
+	}
+	if result.License != nil && result.License.SPDXID != "NOASSERTION" {
+		values["license"] = result.License.SPDXID
+	}
+	return values, nil
+}
+
+// githubRepo extracts owner and repository from github.com/OWNER/REPO
+// URLs, including links to files or issues inside the repository.
+func githubRepo(u *url.URL) (string, string, bool) {
+	if strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") != "github.com" {
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	switch parts[0] {
+	case "orgs", "users", "settings", "topics", "marketplace", "sponsors", "features", "about":
+		return "", "", false
+	}
+	return parts[0], strings.TrimSuffix(parts[1], ".git"), true
+}
+
+// twitterEnricher uses the publish.twitter.com oEmbed endpoint, which
+// still serves x.com and twitter.com status links without a token.
+type twitterEnricher struct{}
+
+func (twitterEnricher) Name() string { return "twitter" }
+
+func (twitterEnricher) Match(u *url.URL) bool {
+	switch strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") {
+	case "twitter.com", "x.com", "mobile.twitter.com":
+		return strings.Contains(u.Path, "/status/")
+	}
+	return false
+}
+
+func (twitterEnricher) Enrich(client *http.Client, u *url.URL) (map[string]string, error) {
+	var embed oEmbed
+	endpoint := "https://publish.twitter.com/oembed?" + url.Values{"url": {u.String()}, "omit_script": {"true"}}.Encode()
+	if err := getJSON(client, endpoint, nil, &embed); err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"author": embed.AuthorName,
+		"text":   tweetText(embed.HTML),
+	}, nil
+}
+
+// tweetText returns the text of the <p> inside an embedded tweet.
+func tweetText(fragment string) string {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var text strings.Builder
+	inParagraph := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(text.String())
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "p":
+				inParagraph = true
+			case "br":
+				text.WriteString("\n")
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "p" {
+				return strings.TrimSpace(text.String())
+			}
+		case html.TextToken:
+			if inParagraph {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
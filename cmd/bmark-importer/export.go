@@ -0,0 +1,741 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// exportOptions carries the format-specific flags of the export command.
+type exportOptions struct {
+	Delimiter rune
+	Columns   []string
+	GroupBy   string
+	Filter    bookmarkFilter
+	Template  *template.Template
+	// Fields selects the JSON keys to write; nil writes all of them.
+	Fields []string
+}
+
+// bookmarkFilter restricts which bookmarks forEachBookmark returns. The
+// zero value returns every bookmark in id order.
+type bookmarkFilter struct {
+	// Tags must all be present; ExcludeTags must all be absent.
+	Tags        []string
+	ExcludeTags []string
+	// Since and Until bound the creation time; Until is exclusive. Zero
+	// means unbounded.
+	Since  int64
+	Until  int64
+	Domain string
+	// Unpushed leaves out bookmarks already pushed to this service and
+	// not changed since.
+	Unpushed string
+	// Untagged keeps only bookmarks without any tag.
+	Untagged bool
+	Starred  bool
+	Unread   bool
+	// HideArchived leaves out archived bookmarks, which list and search
+	// do unless asked for all of them.
+	HideArchived bool
+	// MinRating keeps bookmarks rated at least this; unrated ones count
+	// as 0.
+	MinRating int
+	// Trashed returns the bookmarks in the trash instead of the others.
+	Trashed bool
+	// Limit and Offset page the results; a Limit of 0 means all.
+	Limit       int
+	Offset      int
+	NewestFirst bool
+	// Sort is one of the bookmarkOrders keys; NewestFirst is the same as
+	// "created".
+	Sort string
+	// Regex is an RE2 pattern the URL, title or note must match.
+	Regex string
+	// Query is a boolean query as described in query.go.
+	Query string
+	// Match is an FTS5 query; matches are ordered by rank unless Sort
+	// says otherwise. With MatchContent it is run against the text of
+	// archived pages instead of the title, note and URL.
+	Match        string
+	MatchContent bool
+	// Public leaves out private bookmarks and WithoutNotes blanks notes,
+	// which is what share-oriented formats do by default.
+	Public       bool
+	WithoutNotes bool
+	// FlatTags splits hierarchical tags into their levels, so lang/go
+	// becomes lang and go, for tools without nested tags.
+	FlatTags bool
+}
+
+// shareFormats are meant to be published or handed to other people, so
+// notes and private bookmarks stay out of them unless asked for.
+var shareFormats = map[string]bool{
+	"markdown": true,
+	"webapp":   true,
+	"atom":     true,
+	"cheat":    true,
+}
+
+var bookmarkOrders = map[string]string{
+	"":        "b.id",
+	"created": "b.created_at DESC, b.id DESC",
+	"updated": "b.updated_at DESC, b.id DESC",
+	"title":   "COALESCE(NULLIF(b.title, ''), b.url) COLLATE NOCASE, b.id",
+	"rank":    "m.score, b.id",
+	"visits":  "b.visit_count DESC, COALESCE(b.last_visited_at, 0) DESC, b.id",
+	"random":  "RANDOM()",
+}
+
+// exporters write every bookmark in the database to w and return how many
+// were written.
+var exporters = map[string]func(db *sql.DB, w io.Writer, opts exportOptions) (int, error){
+	"html":     writeNetscape,
+	"json":     writeJSON,
+	"ndjson":   writeNDJSON,
+	"csv":      writeCSV,
+	"markdown": writeMarkdown,
+	"org":      writeOrg,
+	"xbel":     writeXBEL,
+	"webapp":   writeWebapp,
+	"atom":     writeAtom,
+	"template": writeTemplate,
+	"cheat":    writeCheat,
+}
+
+var exportExtensions = map[string]string{
+	"html":     ".html",
+	"json":     ".json",
+	"ndjson":   ".ndjson",
+	"csv":      ".csv",
+	"markdown": ".md",
+	"org":      ".org",
+	"xbel":     ".xbel",
+	"webapp":   ".html",
+	"atom":     ".atom",
+	"cheat":    ".txt",
+}
+
+// exportTargets are destinations other than a single file, selected by
+// the first argument of the export command.
+var exportTargets = map[string]func(db *sql.DB, args []string){
+	"site":     exportSite,
+	"pinboard": exportPinboard,
+	"linkding": exportLinkding,
+}
+
+func exportBookmarks(db *sql.DB, args []string) {
+	if len(args) > 0 {
+		if target, ok := exportTargets[args[0]]; ok {
+			target(db, args[1:])
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "html", "output format: html, json, ndjson, csv, markdown, org, xbel, webapp, atom or cheat")
+	compress := fs.Bool("compress", false, "gzip the output (implied by a .gz file name)")
+	encrypt := fs.String("encrypt", "", "encrypt the export for age:RECIPIENT (or recipients file) or gpg:KEY_ID")
+	var encryptTo []string
+	fs.Func("encrypt-to", "encrypt the export with age for this recipient or recipients file (repeatable)", func(s string) error {
+		encryptTo = append(encryptTo, s)
+		return nil
+	})
+	delimiter := fs.String("delimiter", ",", "CSV field delimiter (use '\\t' for tabs)")
+	columns := fs.String("columns", strings.Join(defaultCSVColumns, ","), "comma-separated CSV columns: "+strings.Join(csvColumnNames(), ", "))
+	fields := fs.String("fields", "", "comma-separated fields for csv, json and ndjson (csv: same as --columns); naming note keeps notes in share formats")
+	includeNotes := fs.Bool("include-notes", false, "keep notes in share formats (markdown, webapp, atom, cheat)")
+	includePrivate := fs.Bool("include-private", false, "keep private bookmarks in share formats")
+	groupBy := fs.String("group-by", "tag", "Markdown grouping: tag, domain or date")
+	tag := fs.String("tag", "", "only export bookmarks with these comma-separated tags")
+	excludeTags := fs.String("exclude-tag", "", "comma-separated tags whose bookmarks are left out")
+	since := fs.String("since", "", "only export bookmarks added on or after this date (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "only export bookmarks added on or before this date (YYYY-MM-DD or RFC 3339)")
+	domain := fs.String("domain", "", "only export bookmarks on this domain or its subdomains")
+	limit := fs.Int("limit", 0, "export at most this many bookmarks (atom defaults to 50)")
+	splitBy := fs.String("split-by", "", "write one file per tag into the output directory (tag)")
+	templateFile := fs.String("template", "", "render bookmarks with this Go text/template instead of a built-in format")
+	tagPaths := fs.String("tag-paths", "preserve", "hierarchical tags such as lang/go: preserve, or flatten into lang and go")
+	fs.Parse(args)
+
+	if *templateFile != "" {
+		*format = "template"
+	}
+	if *encrypt != "" && len(encryptTo) > 0 {
+		log.Fatalf("Use either --encrypt or --encrypt-to, not both")
+	}
+
+	write, ok := exporters[*format]
+	if !ok {
+		log.Fatalf("Unknown export format: %s", *format)
+	}
+
+	opts := exportOptions{
+		Columns: splitTags(*columns),
+		GroupBy: *groupBy,
+		Filter: bookmarkFilter{
+			Tags:        splitTags(*tag),
+			ExcludeTags: splitTags(*excludeTags),
+			Domain:      strings.ToLower(strings.TrimSpace(*domain)),
+			Limit:       *limit,
+		},
+	}
+	if *fields != "" {
+		opts.Fields = splitTags(*fields)
+		switch *format {
+		case "csv":
+			opts.Columns = opts.Fields
+		case "json", "ndjson":
+			if err := validateJSONFields(opts.Fields); err != nil {
+				log.Fatalf("Invalid --fields: %v", err)
+			}
+		default:
+			if !shareFormats[*format] {
+				log.Fatalf("--fields works with csv, json, ndjson and share formats, not %s", *format)
+			}
+		}
+	}
+	if shareFormats[*format] {
+		opts.Filter.Public = !*includePrivate
+		opts.Filter.WithoutNotes = !*includeNotes && !slices.Contains(opts.Fields, "note")
+	}
+	var err error
+	if opts.Filter.Since, err = parseDateFlag(*since, false); err != nil {
+		log.Fatalf("Invalid --since: %v", err)
+	}
+	if opts.Filter.Until, err = parseDateFlag(*until, true); err != nil {
+		log.Fatalf("Invalid --until: %v", err)
+	}
+	if *delimiter == `\t` {
+		*delimiter = "\t"
+	}
+	if r := []rune(*delimiter); len(r) == 1 {
+		opts.Delimiter = r[0]
+	} else {
+		log.Fatalf("The delimiter must be a single character, got %q", *delimiter)
+	}
+	switch *tagPaths {
+	case "preserve":
+	case "flatten":
+		opts.Filter.FlatTags = true
+	default:
+		log.Fatalf("Unknown --tag-paths %s, use preserve or flatten", *tagPaths)
+	}
+	if *format == "markdown" && *groupBy != "tag" && *groupBy != "domain" && *groupBy != "date" {
+		log.Fatalf("Unknown --group-by %s, use tag, domain or date", *groupBy)
+	}
+	if *format == "csv" {
+		if err := validateCSVColumns(opts.Columns); err != nil {
+			log.Fatalf("Invalid --columns or --fields: %v", err)
+		}
+	}
+
+	ext := exportExtensions[*format]
+	if *templateFile != "" {
+		tmpl, err := parseExportTemplate(*templateFile)
+		if err != nil {
+			log.Fatalf("Failed to parse template: %v", err)
+		}
+		opts.Template = tmpl
+		ext = templateExtension(*templateFile)
+	}
+
+	output := outputOptions{Compress: *compress, Encrypt: *encrypt, EncryptTo: encryptTo}
+	output.Sync = backupFormats[*format] || output.Encrypt != "" || len(output.EncryptTo) > 0
+
+	if externalIDFormats[*format] {
+		if err := assignExternalIDs(db); err != nil {
+			log.Fatalf("Failed to assign external IDs: %v", err)
+		}
+	}
+
+	if *splitBy != "" {
+		if *splitBy != "tag" {
+			log.Fatalf("Unknown --split-by %s, use tag", *splitBy)
+		}
+		if fs.NArg() < 1 {
+			fmt.Println("Usage: importer-exporter export --split-by tag [--format FORMAT] DIR")
+			os.Exit(1)
+		}
+		splitExport(db, fs.Arg(0), ext, write, opts, output)
+		return
+	}
+
+	outputFile := "exported_bookmarks" + ext
+	if fs.NArg() > 0 {
+		outputFile = fs.Arg(0)
+		name := outputFile
+		if isEncrypted(name) {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		output.Compress = output.Compress || strings.HasSuffix(name, ".gz")
+	} else {
+		outputFile += output.suffix()
+	}
+
+	// "-" writes to stdout for piping; the summary then goes to stderr so
+	// it does not end up in the data.
+	report := os.Stdout
+	if outputFile == "-" {
+		report = os.Stderr
+	}
+
+	bookmarkCount, err := writeExport(db, outputFile, output, write, opts)
+	if err != nil {
+		log.Fatalf("Failed to export bookmarks to %s: %v", outputFile, err)
+	}
+
+	if bookmarkCount == 0 {
+		fmt.Fprintln(report, "No bookmarks found in database.")
+	} else {
+		fmt.Fprintf(report, "Exported %d bookmarks to: %s\n", bookmarkCount, outputFile)
+	}
+}
+
+// outputOptions describe how export files are compressed and encrypted.
+type outputOptions struct {
+	Compress  bool
+	Encrypt   string
+	EncryptTo []string
+	// Sync flushes the file to disk before it replaces the old one.
+	Sync bool
+}
+
+// backupFormats hold everything needed to restore the database, so they
+// are synced to disk like encrypted exports.
+var backupFormats = map[string]bool{
+	"html":   true,
+	"json":   true,
+	"ndjson": true,
+	"xbel":   true,
+}
+
+// suffix is appended to default file names.
+func (o outputOptions) suffix() string {
+	s := ""
+	if o.Compress {
+		s += ".gz"
+	}
+	if o.Encrypt != "" {
+		s += encryptedExtension(o.Encrypt)
+	} else if len(o.EncryptTo) > 0 {
+		s += ".age"
+	}
+	return s
+}
+
+// writeExport runs write into path, or stdout for "-", through the
+// compression and encryption output asks for.
+func writeExport(db *sql.DB, path string, output outputOptions, write func(*sql.DB, io.Writer, exportOptions) (int, error), opts exportOptions) (int, error) {
+	var file io.Writer = os.Stdout
+	var atomic *atomicFile
+	if path != "-" {
+		var err error
+		if atomic, err = createAtomic(path); err != nil {
+			return 0, err
+		}
+		defer atomic.Abort()
+		file = atomic
+	}
+
+	var out io.WriteCloser
+	var err error
+	if len(output.EncryptTo) > 0 {
+		out, err = ageEncryptingWriter(file, output.EncryptTo)
+	} else {
+		out, err = encryptingWriter(file, output.Encrypt)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to set up encryption: %w", err)
+	}
+
+	// Compression comes before encryption, which leaves nothing to
+	// compress.
+	var w io.WriteCloser = out
+	if output.Compress {
+		w = gzip.NewWriter(out)
+	}
+
+	count, err := write(db, w, opts)
+	if err != nil {
+		return count, err
+	}
+	if output.Compress {
+		if err := w.Close(); err != nil {
+			return count, err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return count, err
+	}
+	if atomic != nil {
+		return count, atomic.Commit(output.Sync)
+	}
+	return count, nil
+}
+
+// splitExport writes one file per tag into dir, named after the tag, on
+// top of any filters already given. Untagged bookmarks are left out.
+func splitExport(db *sql.DB, dir, ext string, write func(*sql.DB, io.Writer, exportOptions) (int, error), opts exportOptions, output outputOptions) {
+	rows, err := db.Query(`SELECT DISTINCT t.tag FROM tags t
+		JOIN bookmark_tags bt ON bt.tag_id = t.id ORDER BY t.tag`)
+	if err != nil {
+		log.Fatalf("Failed to read tags: %v", err)
+	}
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			log.Fatalf("Failed to read tags: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	rows.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", dir, err)
+	}
+
+	files := tagFileNames(tags)
+	written, total := 0, 0
+	for _, tag := range tags {
+		tagOpts := opts
+		tagOpts.Filter.Tags = append(append([]string{}, opts.Filter.Tags...), tag)
+		path := filepath.Join(dir, files[tag]+ext+output.suffix())
+
+		count, err := writeExport(db, path, output, write, tagOpts)
+		if err != nil {
+			log.Fatalf("Failed to export %s: %v", path, err)
+		}
+		// Other filters can leave a tag without bookmarks; no empty files.
+		if count == 0 {
+			os.Remove(path)
+			continue
+		}
+		written++
+		total += count
+	}
+
+	if written == 0 {
+		fmt.Println("No tagged bookmarks found in database.")
+		return
+	}
+	fmt.Printf("Exported %d bookmarks into %d files in: %s\n", total, written, dir)
+}
+
+// forEachBookmark streams the bookmarks matching filter with their tags,
+// in id order unless the filter asks for another. The database
+// allows a single connection, which the query holds until it returns, so
+// fn must not run queries of its own.
+func forEachBookmark(db *sql.DB, filter bookmarkFilter, fn func(Bookmark) error) error {
+	query, args, err := bookmarkSQL(filter)
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Bookmark
+		var tags string
+		err := rows.Scan(&b.ID, &b.URI, &b.Title, &b.Note, &b.CreatedAt, &b.UpdatedAt,
+			&b.Private, &b.Unread, &b.Starred, &b.Archived, &b.Rating, &b.Visits, &b.DeletedAt, &b.LastVisit, &b.Keyword, &b.FolderID, &b.ExternalID, &tags)
+		if err != nil {
+			log.Printf("Row error during export: %v", err)
+			continue
+		}
+		b.Tags = splitTags(tags)
+		if filter.FlatTags {
+			b.Tags = flattenTags(b.Tags)
+		}
+		if filter.WithoutNotes {
+			b.Note = ""
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// bookmarkSQL builds the query forEachBookmark runs for filter.
+func bookmarkSQL(filter bookmarkFilter) (string, []any, error) {
+	where := []string{"b.deleted_at IS NULL"}
+	if filter.Trashed {
+		where[0] = "b.deleted_at IS NOT NULL"
+	}
+	var args []any
+	for _, tag := range filter.Tags {
+		where = append(where, tagCondition)
+		args = append(args, tag)
+	}
+	for _, tag := range filter.ExcludeTags {
+		where = append(where, "NOT "+tagCondition)
+		args = append(args, tag)
+	}
+	if filter.Query != "" {
+		query, err := compileQuery(filter.Query)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid query: %w", err)
+		}
+		where = append(where, query.Where)
+		args = append(args, query.Args...)
+		if query.Archived {
+			filter.HideArchived = false
+		}
+	}
+	if filter.Since > 0 {
+		where = append(where, "b.created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Until > 0 {
+		where = append(where, "b.created_at < ?")
+		args = append(args, filter.Until)
+	}
+	if filter.Unpushed != "" {
+		where = append(where, `NOT EXISTS (SELECT 1 FROM push_state p
+			WHERE p.service = ? AND p.bookmark_id = b.id AND p.updated_at >= b.updated_at)`)
+		args = append(args, filter.Unpushed)
+	}
+	if filter.Domain != "" {
+		where = append(where, "(url_host(b.url) = ? OR url_host(b.url) LIKE ?)")
+		args = append(args, filter.Domain, "%."+filter.Domain)
+	}
+	if filter.Public {
+		where = append(where, "b.private = 0")
+	}
+	if filter.Starred {
+		where = append(where, "b.starred = 1")
+	}
+	if filter.Unread {
+		where = append(where, "b.unread = 1")
+	}
+	if filter.MinRating > 0 {
+		where = append(where, "COALESCE(b.rating, 0) >= ?")
+		args = append(args, filter.MinRating)
+	}
+	if filter.HideArchived {
+		where = append(where, "b.archived = 0")
+	}
+	if filter.Regex != "" {
+		where = append(where, "(b.url REGEXP ? OR COALESCE(b.title, '') REGEXP ? OR COALESCE(b.note, '') REGEXP ?)")
+		args = append(args, filter.Regex, filter.Regex, filter.Regex)
+	}
+	if filter.Untagged {
+		where = append(where, "NOT EXISTS (SELECT 1 FROM bookmark_tags u WHERE u.bookmark_id = b.id)")
+	}
+
+	from := ""
+	if filter.Match != "" && filter.MatchContent {
+		from = `
+		JOIN (SELECT rowid AS id, rank AS score FROM page_texts_fts
+			WHERE page_texts_fts MATCH ?) m ON m.id = b.id`
+		args = append([]any{filter.Match}, args...)
+		if filter.Sort == "" {
+			filter.Sort = "rank"
+		}
+	} else if filter.Match != "" {
+		from = `
+		JOIN (SELECT rowid AS id, rank AS score FROM bookmarks_fts
+			WHERE bookmarks_fts MATCH ? AND rank MATCH 'bm25(` + searchWeights + `)') m ON m.id = b.id`
+		args = append([]any{filter.Match}, args...)
+		if filter.Sort == "" {
+			filter.Sort = "rank"
+		}
+	}
+
+	query := `
+		SELECT b.id, b.url, COALESCE(b.title, ''), COALESCE(b.note, ''), b.created_at, b.updated_at,
+			b.private, b.unread, b.starred, b.archived, COALESCE(b.rating, 0), b.visit_count, COALESCE(b.deleted_at, 0), COALESCE(b.last_visited_at, 0), COALESCE(b.keyword, ''), COALESCE(b.folder_id, 0),
+			COALESCE(b.external_id, ''),
+			COALESCE(GROUP_CONCAT(t.tag, ','), '') AS tags
+		FROM bookmarks b` + from + `
+		LEFT JOIN bookmark_tags bt ON b.id = bt.bookmark_id
+		LEFT JOIN tags t ON bt.tag_id = t.id`
+	query += " WHERE " + strings.Join(where, " AND ")
+	query += " GROUP BY b.id"
+	order, ok := bookmarkOrders[filter.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown sort order: %s", filter.Sort)
+	}
+	if filter.NewestFirst {
+		order = bookmarkOrders["created"]
+	}
+	query += " ORDER BY " + order
+	if filter.Limit > 0 || filter.Offset > 0 {
+		// SQLite has no OFFSET without LIMIT; -1 is no limit.
+		limit := filter.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, filter.Offset)
+	}
+
+	return query, args, nil
+}
+
+// countBookmarks counts the bookmarks matching filter, paging aside.
+func countBookmarks(db *sql.DB, filter bookmarkFilter) (int, error) {
+	filter.Limit, filter.Offset = 0, 0
+	query, args, err := bookmarkSQL(filter)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM ("+query+")", args...).Scan(&n)
+	return n, err
+}
+
+// writeNetscape writes a Netscape bookmark file. Bookmarks in the folders
+// table are nested in <H3> folders the way browsers export them; without
+// folders the file is streamed.
+func writeNetscape(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	icons, err := loadFavicons(db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load favicons: %w", err)
+	}
+	folders, err := loadFolders(db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load folders: %w", err)
+	}
+
+	fmt.Fprintln(out, `<!DOCTYPE NETSCAPE-Bookmark-file-1>`)
+	fmt.Fprintln(out, ``)
+	fmt.Fprintln(out, `<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">`)
+	fmt.Fprintln(out, `<TITLE>Bookmarks</TITLE>`)
+	fmt.Fprintln(out, `<H1>Bookmarks</H1>`)
+	fmt.Fprintln(out, `<DL><p>`)
+
+	bookmarkCount := 0
+	byFolder := make(map[int64][]Bookmark)
+	err = forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		bookmarkCount++
+		if _, ok := folders[b.FolderID]; ok {
+			byFolder[b.FolderID] = append(byFolder[b.FolderID], b)
+			return nil
+		}
+		return writeNetscapeBookmark(out, b, icons, "")
+	})
+	if err != nil {
+		return bookmarkCount, err
+	}
+	if len(byFolder) > 0 {
+		if err := writeNetscapeFolder(out, 0, 0, folders, folderChildren(folders), byFolder, icons); err != nil {
+			return bookmarkCount, err
+		}
+	}
+
+	_, err = fmt.Fprintln(out, `</DL><p>`)
+	return bookmarkCount, err
+}
+
+// writeNetscapeFolder writes the subfolders of folder id that contain any
+// bookmarks, each as an <H3> followed by its own <DL>.
+func writeNetscapeFolder(out io.Writer, id int64, depth int, folders map[int64]folder, children map[int64][]int64, bookmarks map[int64][]Bookmark, icons map[string]favicon) error {
+	indent := strings.Repeat("    ", depth)
+	for _, child := range children[id] {
+		if !folderHasBookmarks(child, children, bookmarks) {
+			continue
+		}
+		fmt.Fprintf(out, "%s<DT><H3>%s</H3>\n", indent, html.EscapeString(folders[child].Name))
+		fmt.Fprintf(out, "%s<DL><p>\n", indent)
+		for _, b := range bookmarks[child] {
+			if err := writeNetscapeBookmark(out, b, icons, indent+"    "); err != nil {
+				return err
+			}
+		}
+		if err := writeNetscapeFolder(out, child, depth+1, folders, children, bookmarks, icons); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "%s</DL><p>\n", indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// folderHasBookmarks keeps filtered exports from filling up with empty
+// folders.
+func folderHasBookmarks(id int64, children map[int64][]int64, bookmarks map[int64][]Bookmark) bool {
+	if len(bookmarks[id]) > 0 {
+		return true
+	}
+	for _, child := range children[id] {
+		if folderHasBookmarks(child, children, bookmarks) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeNetscapeBookmark(out io.Writer, b Bookmark, icons map[string]favicon, indent string) error {
+	attr := fmt.Sprintf(`HREF="%s" ADD_DATE="%d" LAST_MODIFIED="%d"`, html.EscapeString(b.URI), b.CreatedAt, b.UpdatedAt)
+	if len(b.Tags) > 0 {
+		attr += fmt.Sprintf(` TAGS="%s"`, html.EscapeString(strings.Join(b.Tags, ",")))
+	}
+	if b.LastVisit > 0 {
+		attr += fmt.Sprintf(` LAST_VISIT="%d"`, b.LastVisit)
+	}
+	if b.Keyword != "" {
+		attr += fmt.Sprintf(` SHORTCUTURL="%s"`, html.EscapeString(b.Keyword))
+	}
+	if b.Private {
+		attr += ` PRIVATE="1"`
+	}
+	if b.Unread {
+		attr += ` TOREAD="1"`
+	}
+	if b.Starred {
+		attr += ` STARRED="1"`
+	}
+	if b.Archived {
+		attr += ` ARCHIVED="1"`
+	}
+	if icon, ok := icons[urlHost(b.URI)]; ok {
+		attr += icon.attrs()
+	}
+	fmt.Fprintf(out, `%s<DT><A %s>%s</A>`, indent, attr, html.EscapeString(b.Title))
+
+	if b.Note != "" {
+		fmt.Fprintf(out, `<DD>%s`, html.EscapeString(b.Note))
+	}
+	_, err := fmt.Fprintln(out, "")
+	return err
+}
+
+// parseDateFlag accepts a date or an RFC 3339 timestamp. A bare date used
+// as an upper bound covers the whole day, so the next midnight is
+// returned for it.
+func parseDateFlag(s string, endOfDay bool) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if endOfDay {
+			return t.Unix() + 1, nil
+		}
+		return t.Unix(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not YYYY-MM-DD or RFC 3339", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.Unix(), nil
+}
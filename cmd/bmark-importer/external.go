@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// externalIDFormats are the export formats meant to be imported again.
+// Bookmarks get a stable external ID before they are written, so that a
+// later import updates the original rows even if their URLs were edited.
+var externalIDFormats = map[string]bool{
+	"json":   true,
+	"ndjson": true,
+}
+
+// assignExternalIDs gives every bookmark without an external ID a random
+// one. IDs are never changed once assigned. An ID is bookkeeping, not an
+// edit, so locked bookmarks get one too.
+func assignExternalIDs(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := overrideLocks(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE bookmarks SET external_id = lower(hex(randomblob(16))) WHERE external_id IS NULL"); err != nil {
+		return err
+	}
+	if err := restoreLocks(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateByExternalID overwrites the bookmark carrying job.ExternalID with
+// the imported fields and clears its tags, which the worker inserts again.
+// found is false when no bookmark has that ID yet.
+func updateByExternalID(tx *sql.Tx, job Job, folderID sql.NullInt64) (id int64, found bool, err error) {
+	err = tx.QueryRow("SELECT id FROM bookmarks WHERE external_id = ?", job.ExternalID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up external ID %s: %w", job.ExternalID, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE bookmarks SET url = ?, title = ?, note = ?, created_at = ?, updated_at = ?, private = ?,
+			unread = ?, starred = ?, archived = ?, rating = ?, deleted_at = NULL, last_visited_at = ?, keyword = ?, folder_id = COALESCE(?, folder_id)
+		WHERE id = ?`,
+		job.URI, job.Title, job.Note, job.CreatedAt, job.UpdatedAt, job.Private, job.Unread, job.Starred, job.Archived,
+		sql.NullInt64{Int64: int64(job.Rating), Valid: job.Rating > 0},
+		sql.NullInt64{Int64: job.LastVisit, Valid: job.LastVisit > 0}, nullIfEmpty(job.Keyword), folderID, id)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to update bookmark %d: %w", id, err)
+	}
+	if _, err := tx.Exec("DELETE FROM bookmark_tags WHERE bookmark_id = ?", id); err != nil {
+		return 0, false, fmt.Errorf("failed to clear tags of bookmark %d: %w", id, err)
+	}
+	return id, true, nil
+}
+
+// parseJSON reads a bmark JSON export. Elements are decoded one at a time,
+// so large files are not held in memory.
+func parseJSON(input io.Reader, jobs chan<- Job) error {
+	dec := json.NewDecoder(input)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("not a bmark JSON export: expected an array")
+	}
+
+	now := time.Now().Unix()
+	for dec.More() {
+		var b jsonBookmark
+		if err := dec.Decode(&b); err != nil {
+			return fmt.Errorf("failed to read JSON bookmark: %w", err)
+		}
+		if b.URL == "" {
+			continue
+		}
+		createdAt := parseTime(b.CreatedAt, now)
+		jobs <- Job{
+			URI:        b.URL,
+			Title:      b.Title,
+			Note:       b.Note,
+			CreatedAt:  createdAt,
+			UpdatedAt:  parseTime(b.UpdatedAt, createdAt),
+			Tags:       b.Tags,
+			Private:    b.Private,
+			Unread:     b.Unread,
+			Starred:    b.Starred,
+			Archived:   b.Archived,
+			Rating:     b.Rating,
+			LastVisit:  parseTime(b.LastVisitedAt, 0),
+			Keyword:    b.Keyword,
+			ExternalID: b.ExternalID,
+		}
+	}
+	return nil
+}
+
+func parseTime(s string, defaultValue int64) int64 {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Unix()
+	}
+	return defaultValue
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Favicons are stored once per host rather than per bookmark: browsers
+// fetch them per site, and it keeps the table small for large imports.
+type favicon struct {
+	IconURI string
+	MIME    string
+	Data    []byte
+}
+
+func urlHost(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// parseDataURI decodes the base64 data: URIs Firefox writes into ICON.
+func parseDataURI(s string) (string, []byte, error) {
+	rest, ok := strings.CutPrefix(s, "data:")
+	if !ok {
+		return "", nil, fmt.Errorf("not a data URI")
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, fmt.Errorf("malformed data URI")
+	}
+	mime, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !isBase64 {
+		decoded, err := url.PathUnescape(data)
+		return mime, []byte(decoded), err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	return mime, decoded, err
+}
+
+func storeFavicon(tx *sql.Tx, uri, iconURI, icon string) error {
+	host := urlHost(uri)
+	if host == "" || (iconURI == "" && icon == "") {
+		return nil
+	}
+
+	// The icon is cosmetic, so a broken one is dropped rather than
+	// costing the bookmark.
+	var mime string
+	var data []byte
+	if icon != "" {
+		var err error
+		if mime, data, err = parseDataURI(icon); err != nil {
+			log.Printf("Ignoring invalid ICON for %s: %v", uri, err)
+			mime, data = "", nil
+			if iconURI == "" {
+				return nil
+			}
+		}
+	}
+
+	return upsertFavicon(tx, host, iconURI, mime, data)
+}
+
+// upsertFavicon stores what is known about the icon of host, keeping
+// earlier values for what is empty.
+func upsertFavicon(tx *sql.Tx, host, iconURI, mime string, data []byte) error {
+	_, err := tx.Exec(`
+		INSERT INTO favicons (host, icon_uri, mime, data, fetched_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (host) DO UPDATE SET
+			icon_uri = COALESCE(NULLIF(excluded.icon_uri, ''), icon_uri),
+			mime = COALESCE(excluded.mime, mime),
+			data = COALESCE(excluded.data, data),
+			fetched_at = excluded.fetched_at`,
+		host, iconURI, nullIfEmpty(mime), data, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to store favicon for %s: %w", host, err)
+	}
+	return nil
+}
+
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func loadFavicons(db *sql.DB) (map[string]favicon, error) {
+	rows, err := db.Query("SELECT host, COALESCE(icon_uri, ''), COALESCE(mime, ''), data FROM favicons")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	icons := make(map[string]favicon)
+	for rows.Next() {
+		var host string
+		var f favicon
+		if err := rows.Scan(&host, &f.IconURI, &f.MIME, &f.Data); err != nil {
+			return nil, err
+		}
+		icons[host] = f
+	}
+	return icons, rows.Err()
+}
+
+// dataURI returns the icon as a data: URI, or its URL when only that is
+// known.
+func (f favicon) dataURI() string {
+	if len(f.Data) == 0 {
+		return f.IconURI
+	}
+	mime := f.MIME
+	if mime == "" {
+		mime = "image/png"
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(f.Data)
+}
+
+// attrs renders the ICON_URI and ICON attributes of a Netscape anchor.
+func (f favicon) attrs() string {
+	var attr string
+	if f.IconURI != "" {
+		attr += fmt.Sprintf(` ICON_URI="%s"`, html.EscapeString(f.IconURI))
+	}
+	if len(f.Data) > 0 {
+		attr += fmt.Sprintf(` ICON="%s"`, f.dataURI())
+	}
+	return attr
+}
+
+// maxFaviconSize bounds the icons favicons fetch stores.
+const maxFaviconSize = 256 << 10
+
+const faviconsUsage = "Usage: importer-exporter favicons fetch [--ttl 720h] [--concurrency 8] [--force] [QUERY...]"
+
+type faviconFetch struct {
+	host    string
+	page    string
+	iconURI string
+	mime    string
+	data    []byte
+	err     error
+}
+
+// faviconsCommand keeps the favicons table filled. The subcommand fetch
+// looks up the icon of every host among the matching bookmarks that has
+// none yet, or whose icon is older than --ttl, first in the page of one
+// of its bookmarks and then at /favicon.ico. Hosts without an icon are
+// not asked again until the TTL has passed.
+func faviconsCommand(db *sql.DB, args []string) {
+	if len(args) < 1 || args[0] != "fetch" {
+		fmt.Println(faviconsUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("favicons fetch", flag.ExitOnError)
+	ttl := fs.Duration("ttl", 30*24*time.Hour, "fetch icons again after this long")
+	concurrency := fs.Int("concurrency", 8, "hosts fetched at the same time")
+	force := fs.Bool("force", false, "fetch every icon again, however recent")
+	words := parseInterspersed(fs, args[1:])
+
+	filter := bookmarkFilter{Query: strings.Join(words, " ")}
+	if filter.Query != "" {
+		if _, err := compileQuery(filter.Query); err != nil {
+			log.Fatalf("Invalid query: %v", err)
+		}
+	}
+	fetched := make(map[string]int64)
+	err := queryEach(db, "SELECT host, fetched_at FROM favicons", func(rows *sql.Rows) error {
+		var host string
+		var at int64
+		err := rows.Scan(&host, &at)
+		fetched[host] = at
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to read favicons: %v", err)
+	}
+	icons, err := loadFavicons(db)
+	if err != nil {
+		log.Fatalf("Failed to read favicons: %v", err)
+	}
+
+	stale := time.Now().Add(-*ttl).Unix()
+	var hosts []faviconFetch
+	seen := make(map[string]bool)
+	err = forEachBookmark(db, filter, func(b Bookmark) error {
+		host := urlHost(b.URI)
+		if host == "" || seen[host] || !strings.HasPrefix(b.URI, "http://") && !strings.HasPrefix(b.URI, "https://") {
+			return nil
+		}
+		seen[host] = true
+		if at, ok := fetched[host]; ok && at > stale && !*force {
+			return nil
+		}
+		hosts = append(hosts, faviconFetch{host: host, page: b.URI, iconURI: icons[host].IconURI})
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(hosts) == 0 {
+		fmt.Println("All favicons are up to date.")
+		return
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	queue := make(chan faviconFetch)
+	results := make(chan faviconFetch)
+	var wg sync.WaitGroup
+	for range max(*concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range queue {
+				results <- fetchFavicon(client, f)
+			}
+		}()
+	}
+	go func() {
+		for _, f := range hosts {
+			queue <- f
+		}
+		close(queue)
+		wg.Wait()
+		close(results)
+	}()
+
+	n, found := 0, 0
+	for f := range results {
+		n++
+		// A host without an icon is stored too, so it waits for the TTL.
+		err := inTagTx(db, false, func(tx *sql.Tx) error {
+			return upsertFavicon(tx, f.host, f.iconURI, f.mime, f.data)
+		})
+		if err != nil {
+			log.Fatalf("Failed to store favicon: %v", err)
+		}
+		if f.err != nil {
+			fmt.Printf("[%d/%d] %s: %v\n", n, len(hosts), f.host, f.err)
+			continue
+		}
+		found++
+		fmt.Printf("[%d/%d] %s: %s, %d bytes\n", n, len(hosts), f.host, f.mime, len(f.data))
+	}
+	fmt.Printf("Fetched %d of %d favicon(s)\n", found, len(hosts))
+}
+
+// fetchFavicon downloads the icon of f.host: the one the page declares,
+// the one known from before, or /favicon.ico, whichever answers first
+// with an image.
+func fetchFavicon(client *http.Client, f faviconFetch) faviconFetch {
+	var candidates []string
+	if info, err := fetchPageInfo(client, f.page); err == nil && info.Icon != "" {
+		candidates = append(candidates, info.Icon)
+	}
+	if f.iconURI != "" && !slices.Contains(candidates, f.iconURI) {
+		candidates = append(candidates, f.iconURI)
+	}
+	if u, err := url.Parse(f.page); err == nil {
+		fallback := u.Scheme + "://" + u.Host + "/favicon.ico"
+		if !slices.Contains(candidates, fallback) {
+			candidates = append(candidates, fallback)
+		}
+	}
+
+	f.err = fmt.Errorf("no icon found")
+	for _, uri := range candidates {
+		mime, data, err := downloadIcon(client, uri)
+		if err != nil {
+			f.err = err
+			continue
+		}
+		f.iconURI, f.mime, f.data, f.err = uri, mime, data, nil
+		break
+	}
+	return f
+}
+
+func downloadIcon(client *http.Client, uri string) (string, []byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		return parseDataURI(uri)
+	}
+	resp, err := client.Get(uri)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status %s for %s", resp.Status, uri)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) > maxFaviconSize {
+		return "", nil, fmt.Errorf("icon at %s is larger than %d KiB", uri, maxFaviconSize>>10)
+	}
+	// Servers often send icons as text/plain or octet-stream.
+	mime, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	mime = strings.TrimSpace(strings.ToLower(mime))
+	if !strings.HasPrefix(mime, "image/") {
+		mime = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mime, "image/") || len(data) == 0 {
+		return "", nil, fmt.Errorf("%s is not an image", uri)
+	}
+	return mime, data, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+const folderUsage = "Usage: importer-exporter folder list | create PATH | move ID|URL... PATH [--force]"
+
+// folderCommand manages the folders table that --folders table imports
+// fill. Paths are folder names joined by "/", like a/b/c; moving to "/"
+// takes bookmarks out of their folder.
+func folderCommand(db *sql.DB, args []string) {
+	if len(args) < 1 {
+		fmt.Println(folderUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("folder "+args[0], flag.ExitOnError)
+	force := fs.Bool("force", false, "move locked bookmarks too")
+	names := parseInterspersed(fs, args[1:])
+
+	switch args[0] {
+	case "list":
+		listFolders(db)
+	case "create":
+		if len(names) != 1 || len(splitFolderPath(names[0])) == 0 {
+			fmt.Println(folderUsage)
+			os.Exit(1)
+		}
+		path := splitFolderPath(names[0])
+		err := inTagTx(db, false, func(tx *sql.Tx) error {
+			_, err := ensureFolder(tx, path)
+			return err
+		})
+		if err != nil {
+			log.Fatalf("Failed to create folder: %v", err)
+		}
+		fmt.Printf("Created folder %s\n", strings.Join(path, "/"))
+	case "move":
+		if len(names) < 2 {
+			fmt.Println(folderUsage)
+			os.Exit(1)
+		}
+		keys, path := names[:len(names)-1], splitFolderPath(names[len(names)-1])
+
+		// Bookmarks are resolved before the transaction, which needs the
+		// only connection.
+		var ids []int64
+		for _, key := range keys {
+			id, err := findBookmarkID(db, key)
+			if err != nil {
+				log.Fatalf("Failed to find bookmark %s: %v", key, err)
+			}
+			ids = append(ids, id)
+		}
+		err := inTagTx(db, *force, func(tx *sql.Tx) error {
+			folderID, err := ensureFolder(tx, path)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if _, err := tx.Exec("UPDATE bookmarks SET folder_id = ? WHERE id = ?", folderID, id); err != nil {
+					return fmt.Errorf("failed to move bookmark %d: %w", id, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Failed to move bookmarks: %v", err)
+		}
+		fmt.Printf("Moved %d bookmark(s) to /%s\n", len(ids), strings.Join(path, "/"))
+	default:
+		fmt.Printf("Unknown folder command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// listFolders prints the folder tree with the number of bookmarks
+// directly in each folder.
+func listFolders(db *sql.DB) {
+	folders, err := loadFolders(db)
+	if err != nil {
+		log.Fatalf("Failed to load folders: %v", err)
+	}
+	counts := make(map[int64]int)
+	err = queryEach(db, "SELECT COALESCE(folder_id, 0), COUNT(*) FROM bookmarks WHERE deleted_at IS NULL GROUP BY 1", func(rows *sql.Rows) error {
+		var id int64
+		var n int
+		err := rows.Scan(&id, &n)
+		counts[id] = n
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to count bookmarks: %v", err)
+	}
+
+	children := folderChildren(folders)
+	var walk func(id int64, depth int)
+	walk = func(id int64, depth int) {
+		for _, child := range children[id] {
+			fmt.Printf("%5d  %s%s\n", counts[child], strings.Repeat("  ", depth), folders[child].Name)
+			walk(child, depth+1)
+		}
+	}
+	walk(0, 0)
+	fmt.Printf("%5d  (no folder)\n", counts[0])
+}
+
+func splitFolderPath(s string) []string {
+	var path []string
+	for _, name := range strings.Split(s, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			path = append(path, name)
+		}
+	}
+	return path
+}
+
+// ensureFolder returns the id of the folder at path, creating missing
+// levels. An empty path means "no folder".
+func ensureFolder(tx *sql.Tx, path []string) (sql.NullInt64, error) {
+	var parent sql.NullInt64
+	for _, name := range path {
+		var id int64
+		err := tx.QueryRow("SELECT id FROM folders WHERE name = ? AND parent_id IS ?", name, parent).Scan(&id)
+		if err == sql.ErrNoRows {
+			res, err := tx.Exec("INSERT INTO folders (name, parent_id) VALUES (?, ?)", name, parent)
+			if err != nil {
+				return sql.NullInt64{}, fmt.Errorf("failed to create folder %s: %w", name, err)
+			}
+			if id, err = res.LastInsertId(); err != nil {
+				return sql.NullInt64{}, fmt.Errorf("failed to get folder ID for %s: %w", name, err)
+			}
+		} else if err != nil {
+			return sql.NullInt64{}, fmt.Errorf("failed to query folder %s: %w", name, err)
+		}
+		parent = sql.NullInt64{Int64: id, Valid: true}
+	}
+	return parent, nil
+}
+
+type folder struct {
+	Name     string
+	ParentID int64
+}
+
+// loadFolders returns every folder by id. Top-level folders have a
+// ParentID of 0.
+func loadFolders(db *sql.DB) (map[int64]folder, error) {
+	rows, err := db.Query("SELECT id, name, COALESCE(parent_id, 0) FROM folders")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := make(map[int64]folder)
+	for rows.Next() {
+		var id int64
+		var f folder
+		if err := rows.Scan(&id, &f.Name, &f.ParentID); err != nil {
+			return nil, err
+		}
+		folders[id] = f
+	}
+	return folders, rows.Err()
+}
+
+// folderChildren returns the subfolders of every folder in creation
+// order. The top level is under 0.
+func folderChildren(folders map[int64]folder) map[int64][]int64 {
+	children := make(map[int64][]int64)
+	for id, f := range folders {
+		children[f.ParentID] = append(children[f.ParentID], id)
+	}
+	for _, ids := range children {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return children
+}
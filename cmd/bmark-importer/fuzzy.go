@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore reports whether the letters and digits of query appear in
+// text in order, ignoring case, and how well: consecutive letters and
+// letters at the start of a word score extra, gaps cost a little. Higher
+// is better.
+func fuzzyScore(query, text string) (int, bool) {
+	var q []rune
+	for _, r := range strings.ToLower(query) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			q = append(q, r)
+		}
+	}
+	if len(q) == 0 {
+		return 0, false
+	}
+
+	t := []rune(strings.ToLower(text))
+	score, qi, last := 0, 0, -1
+	for i, r := range t {
+		if qi == len(q) {
+			break
+		}
+		if r != q[qi] {
+			continue
+		}
+		score += 1
+		if last == i-1 {
+			score += 3
+		} else if last >= 0 {
+			score -= min(i-last-1, 3)
+		}
+		if i == 0 || !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1]) {
+			score += 2
+		}
+		last = i
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+// fuzzyTitleScore scores a title against the words of a fuzzy search.
+// Every word has to match, either with fuzzyScore or, so that swapped and
+// mistyped letters are forgiven too, by sharing enough trigrams with one
+// of the title's words.
+func fuzzyTitleScore(words []string, title string) (int, bool) {
+	titleWords := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	total := 0
+	for _, word := range words {
+		best, found := fuzzyScore(word, title)
+		for _, tw := range titleWords {
+			if sim := trigramSimilarity(strings.ToLower(word), tw); sim >= 0.4 {
+				best = max(best, int(sim*float64(4*len([]rune(word)))))
+				found = true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// trigramSimilarity is the share of trigrams two words have in common,
+// from 0 to 1. Words are padded so their first and last letters count.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+func trigrams(word string) map[string]bool {
+	r := []rune("  " + word + " ")
+	set := make(map[string]bool)
+	for i := 0; i+3 <= len(r); i++ {
+		set[string(r[i:i+3])] = true
+	}
+	return set
+}
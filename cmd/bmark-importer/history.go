@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Before an edit changes a bookmark, its URL, title, note and tags are
+// copied to bookmark_revisions. history shows what each edit changed, and
+// revert puts an old revision back (recording the current state first, so
+// a revert can itself be reverted). Revisions are taken by the commands
+// rather than by triggers, which could not tell tags linked by an import
+// apart from an edit.
+
+const revisionsSchema = `CREATE TABLE IF NOT EXISTS bookmark_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bookmark_id INTEGER NOT NULL REFERENCES bookmarks(id) ON DELETE CASCADE,
+	at INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	title TEXT NOT NULL,
+	note TEXT NOT NULL,
+	tags TEXT NOT NULL
+);`
+
+// revisionTags lists the tags of bookmark b in a stable order.
+const revisionTags = `COALESCE((SELECT GROUP_CONCAT(tag, ',') FROM (SELECT t.tag FROM bookmark_tags bt
+	JOIN tags t ON t.id = bt.tag_id WHERE bt.bookmark_id = b.id ORDER BY t.tag)), '')`
+
+type revision struct {
+	ID    int64
+	At    int64
+	URL   string
+	Title string
+	Note  string
+	Tags  string
+}
+
+// saveRevision records the current state of a bookmark.
+func saveRevision(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec(`INSERT INTO bookmark_revisions (bookmark_id, at, url, title, note, tags)
+		SELECT b.id, ?, b.url, COALESCE(b.title, ''), COALESCE(b.note, ''), `+revisionTags+`
+		FROM bookmarks b WHERE b.id = ?`, time.Now().Unix(), id)
+	if err != nil {
+		return fmt.Errorf("failed to save revision of bookmark %d: %w", id, err)
+	}
+	return nil
+}
+
+func currentRevision(db *sql.DB, id int64) (revision, error) {
+	var r revision
+	err := db.QueryRow(`SELECT b.updated_at, b.url, COALESCE(b.title, ''), COALESCE(b.note, ''), `+revisionTags+`
+		FROM bookmarks b WHERE b.id = ?`, id).Scan(&r.At, &r.URL, &r.Title, &r.Note, &r.Tags)
+	return r, err
+}
+
+// historyCommand lists the revisions of a bookmark, oldest first, with
+// the fields the following edit changed.
+func historyCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	keys := parseInterspersed(fs, args)
+	if len(keys) != 1 {
+		fmt.Println("Usage: importer-exporter history ID|URL")
+		os.Exit(1)
+	}
+
+	id := mustFindBookmark(db, keys[0])
+	var revisions []revision
+	err := queryEach(db, "SELECT id, at, url, title, note, tags FROM bookmark_revisions WHERE bookmark_id = ? ORDER BY id", func(rows *sql.Rows) error {
+		var r revision
+		err := rows.Scan(&r.ID, &r.At, &r.URL, &r.Title, &r.Note, &r.Tags)
+		revisions = append(revisions, r)
+		return err
+	}, id)
+	if err != nil {
+		log.Fatalf("Failed to read history of %s: %v", keys[0], err)
+	}
+	current, err := currentRevision(db, id)
+	if err != nil {
+		log.Fatalf("Failed to read bookmark %s: %v", keys[0], err)
+	}
+	if len(revisions) == 0 {
+		fmt.Printf("%s has not been edited.\n", current.URL)
+		return
+	}
+
+	for i, r := range revisions {
+		next := current
+		if i+1 < len(revisions) {
+			next = revisions[i+1]
+		}
+		fmt.Printf("%d  %s\n", r.ID, time.Unix(r.At, 0).Format("2006-01-02 15:04"))
+		changed := false
+		for _, field := range []struct{ name, from, to string }{
+			{"url", r.URL, next.URL},
+			{"title", r.Title, next.Title},
+			{"tags", r.Tags, next.Tags},
+			{"note", r.Note, next.Note},
+		} {
+			if field.from != field.to {
+				fmt.Printf("    %-6s %q -> %q\n", field.name+":", truncate(field.from, 60), truncate(field.to, 60))
+				changed = true
+			}
+		}
+		if !changed {
+			fmt.Println("    unchanged")
+		}
+	}
+}
+
+// revertCommand restores the URL, title, note and tags of a revision.
+func revertCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("revert", flag.ExitOnError)
+	to := fs.Int64("to", 0, "revision to restore, as listed by history")
+	force := fs.Bool("force", false, "revert the bookmark even if it is locked")
+	keys := parseInterspersed(fs, args)
+	if len(keys) != 1 || *to == 0 {
+		fmt.Println("Usage: importer-exporter revert ID|URL --to REVISION [--force]")
+		os.Exit(1)
+	}
+
+	id := mustFindBookmark(db, keys[0])
+	var r revision
+	err := db.QueryRow("SELECT url, title, note, tags FROM bookmark_revisions WHERE id = ? AND bookmark_id = ?", *to, id).
+		Scan(&r.URL, &r.Title, &r.Note, &r.Tags)
+	if err == sql.ErrNoRows {
+		fmt.Printf("%s has no revision %d\n", keys[0], *to)
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalf("Failed to read revision %d: %v", *to, err)
+	}
+
+	err = inTagTx(db, *force, func(tx *sql.Tx) error {
+		if err := saveRevision(tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE bookmarks SET url = ?, title = ?, note = ?, updated_at = ? WHERE id = ?",
+			r.URL, r.Title, r.Note, time.Now().Unix(), id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM bookmark_tags WHERE bookmark_id = ?", id); err != nil {
+			return err
+		}
+		return linkTags(tx, id, splitTags(r.Tags))
+	})
+	if err != nil {
+		log.Fatalf("Failed to revert %s: %v", keys[0], err)
+	}
+	fmt.Printf("Reverted %s to revision %d\n", keys[0], *to)
+}
+
+func mustFindBookmark(db *sql.DB, key string) int64 {
+	id, err := findBookmarkID(db, key)
+	if err == sql.ErrNoRows {
+		fmt.Printf("No bookmark matches %s\n", key)
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalf("Failed to find bookmark %s: %v", key, err)
+	}
+	return id
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jsonBookmark is the exported JSON shape of a bookmark. Timestamps are
+// RFC 3339 so consumers do not need to know they are stored as Unix time.
+type jsonBookmark struct {
+	ID            int64    `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	Note          string   `json:"note"`
+	Tags          []string `json:"tags"`
+	CreatedAt     string   `json:"created_at"`
+	UpdatedAt     string   `json:"updated_at"`
+	LastVisitedAt string   `json:"last_visited_at,omitempty"`
+	Keyword       string   `json:"keyword,omitempty"`
+	Private       bool     `json:"private"`
+	Unread        bool     `json:"unread"`
+	Starred       bool     `json:"starred"`
+	Archived      bool     `json:"archived"`
+	Rating        int      `json:"rating,omitempty"`
+	ExternalID    string   `json:"external_id,omitempty"`
+}
+
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+func newJSONBookmark(b Bookmark) jsonBookmark {
+	jb := jsonBookmark{
+		ID:         b.ID,
+		URL:        b.URI,
+		Title:      b.Title,
+		Note:       b.Note,
+		Tags:       b.Tags,
+		CreatedAt:  formatTime(b.CreatedAt),
+		UpdatedAt:  formatTime(b.UpdatedAt),
+		Keyword:    b.Keyword,
+		Private:    b.Private,
+		Unread:     b.Unread,
+		Starred:    b.Starred,
+		Archived:   b.Archived,
+		Rating:     b.Rating,
+		ExternalID: b.ExternalID,
+	}
+	if jb.Tags == nil {
+		jb.Tags = []string{}
+	}
+	if b.LastVisit > 0 {
+		jb.LastVisitedAt = formatTime(b.LastVisit)
+	}
+	return jb
+}
+
+// jsonFieldNames lists the keys of jsonBookmark in declaration order.
+func jsonFieldNames() []string {
+	t := reflect.TypeFor[jsonBookmark]()
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i], _, _ = strings.Cut(t.Field(i).Tag.Get("json"), ",")
+	}
+	return names
+}
+
+func validateJSONFields(fields []string) error {
+	names := jsonFieldNames()
+	for _, field := range fields {
+		if !slices.Contains(names, field) {
+			return fmt.Errorf("unknown field %q, available: %s", field, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// jsonSubset is a bookmark reduced to the chosen fields, written in the
+// order they were asked for.
+type jsonSubset struct {
+	fields []string
+	values map[string]json.RawMessage
+}
+
+func newJSONValue(b Bookmark, fields []string) (any, error) {
+	jb := newJSONBookmark(b)
+	if fields == nil {
+		return jb, nil
+	}
+	data, err := json.Marshal(jb)
+	if err != nil {
+		return nil, err
+	}
+	subset := jsonSubset{fields: fields}
+	if err := json.Unmarshal(data, &subset.values); err != nil {
+		return nil, err
+	}
+	return subset, nil
+}
+
+// emptyJSONValue is written for an omitempty field that was left out, so
+// a chosen key is always present with a value of its usual type: 0 for
+// the rating, and null for a missing timestamp, keyword or external ID,
+// where an empty string would read as a value.
+func emptyJSONValue(field string) json.RawMessage {
+	t := reflect.TypeFor[jsonBookmark]()
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key != field {
+			continue
+		}
+		switch typ := t.Field(i).Type; typ.Kind() {
+		case reflect.String:
+		case reflect.Slice:
+			return json.RawMessage("[]")
+		default:
+			value, _ := json.Marshal(reflect.Zero(typ).Interface())
+			return value
+		}
+	}
+	return json.RawMessage("null")
+}
+
+func (s jsonSubset) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range s.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, ok := s.values[field]
+		if !ok {
+			value = emptyJSONValue(field)
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeJSON writes a JSON array of bookmarks. Elements are encoded one at
+// a time, so the result set is never held in memory as a whole.
+func writeJSON(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	if _, err := io.WriteString(out, "["); err != nil {
+		return 0, err
+	}
+
+	bookmarkCount := 0
+	err := forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		value, err := newJSONValue(b, opts.Fields)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(value, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if bookmarkCount == 0 {
+			sep = "\n  "
+		}
+		if _, err := io.WriteString(out, sep); err != nil {
+			return err
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+		bookmarkCount++
+		return nil
+	})
+	if err != nil {
+		return bookmarkCount, err
+	}
+
+	_, err = io.WriteString(out, "\n]\n")
+	return bookmarkCount, err
+}
+
+// writeNDJSON writes one compact JSON object per line, holding nothing
+// but the current bookmark in memory, so huge databases can be piped
+// into jq.
+func writeNDJSON(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	enc := json.NewEncoder(out)
+	bookmarkCount := 0
+	err := forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		bookmarkCount++
+		value, err := newJSONValue(b, opts.Fields)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(value)
+	})
+	return bookmarkCount, err
+}
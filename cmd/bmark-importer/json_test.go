@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSubsetEmptyFields(t *testing.T) {
+	value, err := newJSONValue(Bookmark{ID: 1, URI: "https://example.com/"},
+		[]string{"id", "rating", "last_visited_at", "keyword", "tags", "starred"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":1,"rating":0,"last_visited_at":null,"keyword":null,"tags":[],"starred":false}`
+	if string(data) != want {
+		t.Errorf("got %s\nwant %s", data, want)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Keywords work like Firefox keyword bookmarks: bmark open gh opens the
+// bookmark whose keyword is gh. They are unique, so a keyword always
+// opens the same bookmark.
+
+const keywordIndex = `CREATE UNIQUE INDEX IF NOT EXISTS idx_keyword ON bookmarks (keyword)
+	WHERE keyword IS NOT NULL AND keyword != '';`
+
+// uniqueKeywords creates the unique keyword index. Databases from before
+// it may use a keyword more than once; the oldest bookmark keeps it and
+// the others lose it, locked or not.
+func uniqueKeywords(db *sql.DB) error {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_keyword'").Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := overrideLocks(tx); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE bookmarks SET keyword = NULL
+		WHERE keyword != '' AND id NOT IN (SELECT MIN(id) FROM bookmarks WHERE keyword != '' GROUP BY keyword)`)
+	if err != nil {
+		return fmt.Errorf("failed to clear duplicate keywords: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Cleared %d duplicate keyword(s); keywords are unique now", n)
+	}
+	if _, err := tx.Exec(keywordIndex); err != nil {
+		return fmt.Errorf("failed to create keyword index: %w", err)
+	}
+	if err := restoreLocks(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// claimKeyword returns keyword unless another bookmark already has it, in
+// which case the import keeps going without it. The bookmark being
+// imported is recognised by its URL or external ID.
+func claimKeyword(tx *sql.Tx, job Job) (string, error) {
+	if job.Keyword == "" {
+		return "", nil
+	}
+	var owner string
+	err := tx.QueryRow(`SELECT url FROM bookmarks WHERE keyword = ? AND url != ?
+		AND (? = '' OR COALESCE(external_id, '') != ?)`, job.Keyword, job.URI, job.ExternalID, job.ExternalID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return job.Keyword, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check keyword %s: %w", job.Keyword, err)
+	}
+	log.Printf("Keyword %s already opens %s, not setting it on %s", job.Keyword, owner, job.URI)
+	return "", nil
+}
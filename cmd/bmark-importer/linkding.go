@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// linkding instances are usually self-hosted, so requests are only spaced
+// out a little.
+const linkdingInterval = 100 * time.Millisecond
+
+type linkdingBookmark struct {
+	URL      string   `json:"url"`
+	Title    string   `json:"title"`
+	Notes    string   `json:"notes"`
+	Unread   bool     `json:"unread"`
+	Shared   *bool    `json:"shared,omitempty"`
+	TagNames []string `json:"tag_names"`
+}
+
+type linkdingClient struct {
+	http  *http.Client
+	base  string
+	token string
+}
+
+// exportLinkding creates or updates bookmarks on a linkding server. Each
+// URL is looked up first, so bookmarks already on the server are updated
+// in place instead of duplicated.
+func exportLinkding(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("export linkding", flag.ExitOnError)
+	server := fs.String("url", os.Getenv("LINKDING_URL"), "linkding base URL (default $LINKDING_URL)")
+	token := fs.String("token", os.Getenv("LINKDING_TOKEN"), "REST API token (default $LINKDING_TOKEN)")
+	tag := fs.String("tag", "", "only push bookmarks with this tag")
+	fs.Parse(args)
+
+	if *server == "" || *token == "" {
+		fmt.Println("Usage: importer-exporter export linkding --url URL --token TOKEN [--tag TAG]")
+		os.Exit(1)
+	}
+
+	c := &linkdingClient{
+		http:  &http.Client{Timeout: 30 * time.Second},
+		base:  strings.TrimSuffix(*server, "/") + "/api/bookmarks/",
+		token: *token,
+	}
+	pushBookmarks(db, "linkding", bookmarkFilter{Tags: splitTags(*tag)}, linkdingInterval, c.push)
+}
+
+func (c *linkdingClient) push(b Bookmark) error {
+	var check struct {
+		Bookmark *struct {
+			ID int64 `json:"id"`
+		} `json:"bookmark"`
+	}
+	if err := c.do("GET", "check/?url="+url.QueryEscape(b.URI), nil, &check); err != nil {
+		return err
+	}
+
+	body := linkdingBookmark{
+		URL:      b.URI,
+		Title:    b.Title,
+		Notes:    b.Note,
+		Unread:   b.Unread,
+		TagNames: b.Tags,
+	}
+	if body.TagNames == nil {
+		body.TagNames = []string{}
+	}
+	if b.Private {
+		shared := false
+		body.Shared = &shared
+	}
+
+	if check.Bookmark != nil {
+		return c.do("PATCH", fmt.Sprintf("%d/", check.Bookmark.ID), body, nil)
+	}
+	return c.do("POST", "", body, nil)
+}
+
+func (c *linkdingClient) do(method, path string, body, result any) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.base+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return errRateLimited
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: unexpected status %s", method, req.URL.Path, resp.Status)
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+	}
+	return nil
+}
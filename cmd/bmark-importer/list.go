@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// listCommand prints matching bookmarks as aligned ID, title, URL and tag
+// columns, one bookmark per line.
+func listCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	tag := fs.String("tag", "", "only list bookmarks with these comma-separated tags")
+	untagged := fs.Bool("untagged", false, "only list bookmarks without tags")
+	starred := fs.Bool("starred", false, "only list starred bookmarks")
+	unread := fs.Bool("unread", false, "only list bookmarks not read yet")
+	minRating := fs.Int("min-rating", 0, "only list bookmarks rated at least this (1-5)")
+	all := fs.Bool("all", false, "list archived bookmarks too")
+	domain := fs.String("domain", "", "only list bookmarks on this domain or its subdomains")
+	since := fs.String("since", "", "only list bookmarks created on or after this date (YYYY-MM-DD)")
+	limit := fs.Int("limit", 0, "list at most this many bookmarks")
+	sortBy := fs.String("sort", "", "order: created or updated (newest first), title or visits")
+	var query string
+	fs.StringVar(&query, "query", "", `boolean query such as "(go AND cli) NOT archived domain:github.com"`)
+	fs.StringVar(&query, "q", "", "short for --query")
+	fs.Parse(args)
+
+	if _, ok := bookmarkOrders[*sortBy]; !ok {
+		log.Fatalf("Unknown sort order: %s", *sortBy)
+	}
+	filter := bookmarkFilter{
+		Tags:         splitTags(*tag),
+		Untagged:     *untagged,
+		Starred:      *starred,
+		Unread:       *unread,
+		HideArchived: !*all,
+		MinRating:    *minRating,
+		Domain:       strings.ToLower(strings.TrimSpace(*domain)),
+		Limit:        *limit,
+		Sort:         *sortBy,
+		Query:        query,
+	}
+	var err error
+	if filter.Since, err = parseDateFlag(*since, false); err != nil {
+		log.Fatalf("Invalid --since: %v", err)
+	}
+	if query != "" {
+		if _, err := compileQuery(query); err != nil {
+			log.Fatalf("Invalid --query: %v", err)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	count := 0
+	err = forEachBookmark(db, filter, func(b Bookmark) error {
+		count++
+		title := strings.Join(strings.Fields(b.Title), " ")
+		if title == "" {
+			title = "-"
+		}
+		_, err := fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", b.ID, truncate(title, titleWidth), b.URI, strings.Join(b.Tags, ","))
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to list bookmarks: %v", err)
+	}
+	tw.Flush()
+	if count == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+}
+
+// frequentCommand lists the bookmarks opened most often with bmark open.
+func frequentCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("frequent", flag.ExitOnError)
+	limit := fs.Int("limit", 10, "list at most this many bookmarks")
+	fs.Parse(args)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	count := 0
+	filter := bookmarkFilter{HideArchived: true, Sort: "visits", Limit: *limit}
+	err := forEachBookmark(db, filter, func(b Bookmark) error {
+		if b.Visits == 0 {
+			return nil
+		}
+		count++
+		title := strings.Join(strings.Fields(b.Title), " ")
+		if title == "" {
+			title = "-"
+		}
+		_, err := fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", b.Visits, b.ID, truncate(title, titleWidth), b.URI)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to list bookmarks: %v", err)
+	}
+	tw.Flush()
+	if count == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks opened yet, use bmark open.")
+		os.Exit(1)
+	}
+}
+
+// domainsCommand counts bookmarks per host, most bookmarked first. A
+// leading "www." is ignored, like list --domain does for subdomains of
+// the host it is given. The newest bookmark of each host shows which
+// services have not been saved from in a long time.
+func domainsCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("domains", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "show at most this many hosts")
+	all := fs.Bool("all", false, "count archived bookmarks too")
+	byName := fs.Bool("by-name", false, "sort hosts alphabetically")
+	fs.Parse(args)
+
+	order := "n DESC, host"
+	if *byName {
+		order = "host"
+	}
+	query := `SELECT host, COUNT(*) AS n, MAX(created_at) FROM (
+		SELECT CASE WHEN url_host(url) LIKE 'www.%' THEN substr(url_host(url), 5) ELSE url_host(url) END AS host, created_at
+		FROM bookmarks WHERE deleted_at IS NULL AND (? OR archived = 0))
+		WHERE host != '' GROUP BY host ORDER BY ` + order
+	queryArgs := []any{*all}
+	if *limit > 0 {
+		query += " LIMIT ?"
+		queryArgs = append(queryArgs, *limit)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	count := 0
+	err := queryEach(db, query, func(rows *sql.Rows) error {
+		var host string
+		var n int
+		var newest int64
+		if err := rows.Scan(&host, &n, &newest); err != nil {
+			return err
+		}
+		count++
+		_, err := fmt.Fprintf(tw, "%d\t%s\tnewest %s\n", n, host, time.Unix(newest, 0).Format("2006-01-02"))
+		return err
+	}, queryArgs...)
+	if err != nil {
+		log.Fatalf("Failed to count domains: %v", err)
+	}
+	tw.Flush()
+	if count == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+}
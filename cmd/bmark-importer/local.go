@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// localDatabaseName is the per-project database used with --local. It is
+// meant to be committed next to the code it collects links for.
+const localDatabaseName = ".bmark.db"
+
+// findLocalDatabase returns the nearest .bmark.db in the working
+// directory or one of its parents, like git finds its repository. When
+// there is none, a new one is placed in the working directory.
+func findLocalDatabase() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		path := filepath.Join(dir, localDatabaseName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if filepath.Dir(dir) == dir {
+			return filepath.Join(cwd, localDatabaseName), nil
+		}
+	}
+}
+
+// syncLocal copies bookmarks between the project database db and the
+// global one: pull brings global bookmarks into the project, push sends
+// project bookmarks to the global database. External IDs are carried
+// along, so copying again updates the earlier copies.
+func syncLocal(db *sql.DB, direction string, args []string) {
+	fs := flag.NewFlagSet(direction, flag.ExitOnError)
+	tag := fs.String("tag", "", "only copy bookmarks with these comma-separated tags")
+	fs.Parse(args)
+
+	globalFile, err := globalDatabasePath()
+	if err != nil {
+		log.Fatalf("Cannot find user home directory: %v", err)
+	}
+	if direction == "pull" {
+		if _, err := os.Stat(globalFile); err != nil {
+			log.Fatalf("No global database to pull from: %v", err)
+		}
+	} else if err := os.MkdirAll(filepath.Dir(globalFile), 0o755); err != nil {
+		log.Fatalf("Failed to create %s: %v", filepath.Dir(globalFile), err)
+	}
+	global, err := openDatabase(globalFile)
+	if err != nil {
+		log.Fatalf("Failed to open global database: %v", err)
+	}
+	defer global.Close()
+
+	src, dst := global, db
+	if direction == "push" {
+		src, dst = db, global
+	}
+
+	if err := assignExternalIDs(src); err != nil {
+		log.Fatalf("Failed to assign external IDs: %v", err)
+	}
+	var jobs []Job
+	err = forEachBookmark(src, bookmarkFilter{Tags: splitTags(*tag)}, func(b Bookmark) error {
+		jobs = append(jobs, Job{
+			URI:        b.URI,
+			Title:      b.Title,
+			Note:       b.Note,
+			CreatedAt:  b.CreatedAt,
+			UpdatedAt:  b.UpdatedAt,
+			Tags:       b.Tags,
+			Private:    b.Private,
+			Unread:     b.Unread,
+			Starred:    b.Starred,
+			Archived:   b.Archived,
+			Rating:     b.Rating,
+			LastVisit:  b.LastVisit,
+			Keyword:    b.Keyword,
+			ExternalID: b.ExternalID,
+		})
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+
+	runImport(dst, func(out chan<- Job) error {
+		for _, job := range jobs {
+			out <- job
+		}
+		return nil
+	})
+	if direction == "push" {
+		fmt.Printf("Pushed to %s\n", globalFile)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Locked bookmarks are guarded by triggers, so the shell script, imports
+// and any other client are all refused the same way. A writer that really
+// means it (bmark -f/--force) inserts a row into lock_override inside its
+// transaction; other connections never see that row. Re-adding a tag a
+// locked bookmark already has is not a change, so re-imports still work.
+
+const lockOverrideSchema = `CREATE TABLE IF NOT EXISTS lock_override (active INTEGER);`
+
+const lockedMessage = "bookmark is locked, use --force or bmark unlock"
+
+var lockTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS locked_bookmarks_update
+		BEFORE UPDATE ON bookmarks
+		WHEN OLD.locked = 1 AND NEW.locked = 1 AND NOT EXISTS (SELECT 1 FROM lock_override)
+		BEGIN SELECT RAISE(ABORT, '` + lockedMessage + `'); END;`,
+	`CREATE TRIGGER IF NOT EXISTS locked_bookmarks_delete
+		BEFORE DELETE ON bookmarks
+		WHEN OLD.locked = 1 AND NOT EXISTS (SELECT 1 FROM lock_override)
+		BEGIN SELECT RAISE(ABORT, '` + lockedMessage + `'); END;`,
+	`CREATE TRIGGER IF NOT EXISTS locked_bookmark_tags_insert
+		BEFORE INSERT ON bookmark_tags
+		WHEN (SELECT locked FROM bookmarks WHERE id = NEW.bookmark_id) = 1
+			AND NOT EXISTS (SELECT 1 FROM bookmark_tags WHERE bookmark_id = NEW.bookmark_id AND tag_id = NEW.tag_id)
+			AND NOT EXISTS (SELECT 1 FROM lock_override)
+		BEGIN SELECT RAISE(ABORT, '` + lockedMessage + `'); END;`,
+	`CREATE TRIGGER IF NOT EXISTS locked_bookmark_tags_delete
+		BEFORE DELETE ON bookmark_tags
+		WHEN (SELECT locked FROM bookmarks WHERE id = OLD.bookmark_id) = 1
+			AND NOT EXISTS (SELECT 1 FROM lock_override)
+		BEGIN SELECT RAISE(ABORT, '` + lockedMessage + `'); END;`,
+}
+
+// overrideLocks lets the rest of tx change locked bookmarks. restoreLocks
+// removes the override again before the commit.
+func overrideLocks(tx *sql.Tx) error {
+	if _, err := tx.Exec("INSERT INTO lock_override (active) VALUES (1)"); err != nil {
+		return fmt.Errorf("failed to override lock: %w", err)
+	}
+	return nil
+}
+
+func restoreLocks(tx *sql.Tx) error {
+	if _, err := tx.Exec("DELETE FROM lock_override"); err != nil {
+		return fmt.Errorf("failed to restore lock: %w", err)
+	}
+	return nil
+}
+
+// lockCommand sets or clears the locked flag of the bookmarks given by ID
+// or URL. Unlocking is always allowed, as is locking an unlocked bookmark.
+func lockCommand(db *sql.DB, args []string, locked bool) {
+	name := "unlock"
+	if locked {
+		name = "lock"
+	}
+	if len(args) < 1 {
+		fmt.Printf("Usage: importer-exporter %s ID|URL...\n", name)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, arg := range args {
+		query := "UPDATE bookmarks SET locked = ? WHERE url = ?"
+		var key any = arg
+		if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			query = "UPDATE bookmarks SET locked = ? WHERE id = ?"
+			key = id
+		}
+
+		res, err := db.Exec(query, locked, key)
+		if err != nil {
+			log.Fatalf("Failed to %s %s: %v", name, arg, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			fmt.Printf("No bookmark matches %s\n", arg)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s %sed\n", arg, name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
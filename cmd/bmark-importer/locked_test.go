@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestExportLockedBookmarkAsJSON(t *testing.T) {
+	db, err := openDatabase(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO bookmarks (url, title, created_at, updated_at, locked)
+		VALUES ('https://example.com/', 'Example', 1, 1, 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assignExternalIDs(db); err != nil {
+		t.Fatalf("assignExternalIDs with a locked bookmark: %v", err)
+	}
+	var out bytes.Buffer
+	n, err := writeJSON(db, &out, exportOptions{})
+	if err != nil || n != 1 {
+		t.Fatalf("writeJSON = %d, %v; want 1 bookmark", n, err)
+	}
+
+	var exported []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &exported); err != nil {
+		t.Fatalf("export is not JSON: %v\n%s", err, out.String())
+	}
+	if id, _ := exported[0]["external_id"].(string); id == "" {
+		t.Errorf("locked bookmark exported without an external ID: %s", out.String())
+	}
+
+	// The lock still holds for edits once the IDs are assigned.
+	if _, err := db.Exec("UPDATE bookmarks SET title = 'Changed'"); err == nil {
+		t.Error("editing a locked bookmark succeeded after the export")
+	}
+}
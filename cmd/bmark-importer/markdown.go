@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, "*", `\*`, "_", `\_`, "`", "\\`")
+
+// groupBookmarks sorts bookmarks into named groups by tag, domain or
+// creation month. A bookmark with several tags appears in each of them.
+// Groups are ordered by name, except dates, which are newest first.
+func groupBookmarks(db *sql.DB, by string, filter bookmarkFilter) ([]string, map[string][]Bookmark, int, error) {
+	groups := make(map[string][]Bookmark)
+	count := 0
+	err := forEachBookmark(db, filter, func(b Bookmark) error {
+		count++
+		switch by {
+		case "domain":
+			host := urlHost(b.URI)
+			if host == "" {
+				host = "(no domain)"
+			}
+			groups[host] = append(groups[host], b)
+		case "date":
+			month := time.Unix(b.CreatedAt, 0).UTC().Format("2006-01")
+			groups[month] = append(groups[month], b)
+		default:
+			if len(b.Tags) == 0 {
+				groups["Untagged"] = append(groups["Untagged"], b)
+			}
+			for _, tag := range b.Tags {
+				groups[tag] = append(groups[tag], b)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, count, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	if by == "date" {
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	} else {
+		sort.Strings(names)
+	}
+	return names, groups, count, nil
+}
+
+// writeMarkdown writes one H2 per group with a bulleted list of
+// "[title](url) — note" entries, ready to paste into a notes system.
+func writeMarkdown(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	names, groups, count, err := groupBookmarks(db, opts.GroupBy, opts.Filter)
+	if err != nil {
+		return count, err
+	}
+
+	fmt.Fprintln(out, "# Bookmarks")
+	for _, name := range names {
+		fmt.Fprintf(out, "\n## %s\n\n", markdownEscaper.Replace(name))
+		for _, b := range groups[name] {
+			title := b.Title
+			if title == "" {
+				title = b.URI
+			}
+			line := fmt.Sprintf("- [%s](%s)", markdownEscaper.Replace(title), markdownURL(b.URI))
+			if b.Note != "" {
+				line += " — " + strings.Join(strings.Fields(b.Note), " ")
+			}
+			if _, err := fmt.Fprintln(out, line); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// markdownURL keeps parentheses and spaces in URLs from ending the link.
+func markdownURL(uri string) string {
+	return strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(uri)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrateCommand looks for the bookmarks of other managers, shows what
+// each of them would add, and imports the chosen ones in one go. Sources
+// are read concurrently and merged before anything is written, so a page
+// bookmarked in two browsers ends up as one bookmark with the tags of both.
+func migrateCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "import every detected source without asking")
+	dryRun := fs.Bool("dry-run", false, "only show what would be imported")
+	fs.Parse(args)
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatalf("Cannot find user home directory: %v", err)
+	}
+	sources := detectMigrationSources(homeDir)
+	if len(sources) == 0 {
+		fmt.Println("No other bookmark managers found.")
+		return
+	}
+
+	existing, err := existingURLKeys(db)
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+
+	fmt.Println("Found:")
+	jobs, errs := readSources(sources)
+	for i, source := range sources {
+		if errs[i] != nil {
+			fmt.Printf("  %d) %s (%s): %v\n", i+1, source.Name, source.Path, errs[i])
+			continue
+		}
+		added := 0
+		for _, job := range jobs[i] {
+			if _, ok := existing[urlKey(job.URI)]; !ok {
+				added++
+			}
+		}
+		fmt.Printf("  %d) %s (%s): %d bookmarks, %d new\n", i+1, source.Name, source.Path, len(jobs[i]), added)
+	}
+	if *dryRun {
+		return
+	}
+
+	selected := make([]bool, len(sources))
+	for i := range selected {
+		selected[i] = true
+	}
+	if !*yes {
+		fmt.Fprint(os.Stderr, "Import which sources? [all, none or numbers like 1,3] (all) ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if selected, err = parseSelection(answer, len(sources)); err != nil {
+			log.Fatalf("Invalid selection: %v", err)
+		}
+	}
+
+	var names []string
+	var chosen [][]Job
+	for i, ok := range selected {
+		if ok && len(jobs[i]) > 0 {
+			names = append(names, sources[i].Name)
+			chosen = append(chosen, jobs[i])
+		}
+	}
+	if len(chosen) == 0 {
+		fmt.Println("Nothing imported.")
+		return
+	}
+	importStaged(db, names, chosen)
+}
+
+func detectMigrationSources(home string) []importSource {
+	var sources []importSource
+
+	for _, pattern := range []string{
+		filepath.Join(home, ".mozilla", "firefox", "*", "places.sqlite"),
+		filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox", "*", "places.sqlite"),
+		filepath.Join(home, "Library", "Application Support", "Firefox", "Profiles", "*", "places.sqlite"),
+	} {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			profile := filepath.Base(filepath.Dir(path))
+			sources = append(sources, importSource{
+				Name: "Firefox " + profile,
+				Path: path,
+				Read: func() ([]Job, error) { return readFirefoxPlaces(path) },
+			})
+		}
+	}
+
+	for _, browser := range []struct{ name, dir string }{
+		{"Chrome", filepath.Join(home, ".config", "google-chrome")},
+		{"Chromium", filepath.Join(home, ".config", "chromium")},
+		{"Brave", filepath.Join(home, ".config", "BraveSoftware", "Brave-Browser")},
+		{"Chrome", filepath.Join(home, "Library", "Application Support", "Google", "Chrome")},
+	} {
+		paths, _ := filepath.Glob(filepath.Join(browser.dir, "*", "Bookmarks"))
+		for _, path := range paths {
+			profile := filepath.Base(filepath.Dir(path))
+			sources = append(sources, importSource{
+				Name: browser.name + " " + profile,
+				Path: path,
+				Read: func() ([]Job, error) { return readChromeBookmarks(path) },
+			})
+		}
+	}
+
+	buku := filepath.Join(envOr("XDG_DATA_HOME", filepath.Join(home, ".local", "share")), "buku", "bookmarks.db")
+	if fileExists(buku) {
+		sources = append(sources, importSource{
+			Name: "buku",
+			Path: buku,
+			Read: func() ([]Job, error) { return readBuku(buku) },
+		})
+	}
+
+	shiori := filepath.Join(envOr("SHIORI_DIR", filepath.Join(home, ".local", "share", "shiori")), "shiori.db")
+	if fileExists(shiori) {
+		sources = append(sources, importSource{
+			Name: "Shiori",
+			Path: shiori,
+			Read: func() ([]Job, error) { return readShiori(shiori) },
+		})
+	}
+
+	if token := os.Getenv("PINBOARD_TOKEN"); token != "" {
+		sources = append(sources, importSource{
+			Name: "Pinboard",
+			Path: "$PINBOARD_TOKEN",
+			Read: func() ([]Job, error) {
+				return readPinboard(&http.Client{Timeout: time.Minute}, "https://api.pinboard.in/v1", token)
+			},
+		})
+	}
+
+	return sources
+}
+
+// readBuku reads a buku database, whose tags are stored as one
+// comma-separated string with leading and trailing commas.
+func readBuku(path string) ([]Job, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	now := time.Now().Unix()
+	var jobs []Job
+	err = queryEach(db, "SELECT URL, COALESCE(metadata, ''), COALESCE(tags, ''), COALESCE(desc, '') FROM bookmarks ORDER BY id", func(rows *sql.Rows) error {
+		var job Job
+		var tags string
+		if err := rows.Scan(&job.URI, &job.Title, &tags, &job.Note); err != nil {
+			return err
+		}
+		job.Tags = splitTags(tags)
+		job.CreatedAt, job.UpdatedAt = now, now
+		jobs = append(jobs, job)
+		return nil
+	})
+	return jobs, err
+}
+
+// readShiori reads the SQLite database of a Shiori installation.
+func readShiori(path string) ([]Job, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tags := make(map[int64][]string)
+	err = queryEach(db, "SELECT bt.bookmark_id, t.name FROM bookmark_tag bt JOIN tag t ON bt.tag_id = t.id", func(rows *sql.Rows) error {
+		var id int64
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		tags[id] = append(tags[id], tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	var jobs []Job
+	err = queryEach(db, "SELECT id, url, COALESCE(title, ''), COALESCE(excerpt, ''), COALESCE(modified, ''), COALESCE(public, 0) FROM bookmark ORDER BY id", func(rows *sql.Rows) error {
+		var id int64
+		var job Job
+		var modified string
+		var public int
+		if err := rows.Scan(&id, &job.URI, &job.Title, &job.Note, &modified, &public); err != nil {
+			return err
+		}
+		job.Tags = tags[id]
+		job.Private = public == 0
+		job.CreatedAt = parseZoteroDate(modified, now)
+		job.UpdatedAt = job.CreatedAt
+		jobs = append(jobs, job)
+		return nil
+	})
+	return jobs, err
+}
+
+// readPinboard downloads all bookmarks of a Pinboard account.
+func readPinboard(client *http.Client, api, token string) ([]Job, error) {
+	params := url.Values{"auth_token": {token}, "format": {"json"}}
+	resp, err := client.Get(strings.TrimSuffix(api, "/") + "/posts/all?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pinboard returned %s", resp.Status)
+	}
+
+	var posts []struct {
+		Href        string `json:"href"`
+		Description string `json:"description"`
+		Extended    string `json:"extended"`
+		Tags        string `json:"tags"`
+		Time        string `json:"time"`
+		Shared      string `json:"shared"`
+		ToRead      string `json:"toread"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&posts); err != nil {
+		return nil, fmt.Errorf("failed to parse pinboard response: %w", err)
+	}
+
+	now := time.Now().Unix()
+	jobs := make([]Job, 0, len(posts))
+	for _, post := range posts {
+		createdAt := parseTime(post.Time, now)
+		jobs = append(jobs, Job{
+			URI:       post.Href,
+			Title:     post.Description,
+			Note:      post.Extended,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+			Tags:      strings.Fields(post.Tags),
+			Private:   post.Shared == "no",
+			Unread:    post.ToRead == "yes",
+		})
+	}
+	return jobs, nil
+}
+
+func parseSelection(answer string, n int) ([]bool, error) {
+	selected := make([]bool, n)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	switch answer {
+	case "", "all", "a", "y", "yes":
+		for i := range selected {
+			selected[i] = true
+		}
+		return selected, nil
+	case "none", "n", "no":
+		return selected, nil
+	}
+	for _, field := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' }) {
+		i, err := strconv.Atoi(field)
+		if err != nil || i < 1 || i > n {
+			return nil, fmt.Errorf("%q is not a source number", field)
+		}
+		selected[i-1] = true
+	}
+	return selected, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// netscapeParser walks a Netscape bookmark file token by token. Nothing
+// but the bookmark being built and the folder stack is kept in memory, so
+// exports of any size are parsed in constant memory.
+type netscapeParser struct {
+	opts htmlOptions
+	jobs chan<- Job
+	now  int64
+
+	// folders holds one entry per open <DL>, named after the <H3> that
+	// precedes it. The outermost <DL> has no heading.
+	folders []string
+	heading strings.Builder
+	inH3    bool
+	pending *string
+
+	current  *Job
+	title    strings.Builder
+	note     strings.Builder
+	inAnchor bool
+	inNote   bool
+	// afterBreak swallows the line break that usually follows a <br>, so
+	// it does not turn into an empty line.
+	afterBreak bool
+}
+
+func parseNetscape(r io.Reader, jobs chan<- Job, opts htmlOptions) error {
+	p := &netscapeParser{opts: opts, jobs: jobs, now: time.Now().Unix()}
+	z := html.NewTokenizer(r)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				p.flush()
+				return nil
+			}
+			return z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			p.startTag(z, string(name), hasAttr)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			p.endTag(string(name))
+		case html.TextToken:
+			p.text(string(z.Text()))
+		}
+	}
+}
+
+func (p *netscapeParser) startTag(z *html.Tokenizer, name string, hasAttr bool) {
+	switch name {
+	case "a":
+		// Bookmarks follow a <DT>; a link in a note is part of its text.
+		if p.inNote {
+			return
+		}
+		p.closeAnchor(true)
+		p.flush()
+		p.startBookmark(z, hasAttr)
+	case "dt":
+		p.closeAnchor(true)
+		p.flush()
+	case "dd":
+		p.closeAnchor(true)
+		p.inNote = p.current != nil
+	case "dl":
+		p.closeAnchor(true)
+		p.flush()
+		name := ""
+		if p.pending != nil {
+			name = strings.ReplaceAll(*p.pending, "/", "-")
+			p.pending = nil
+		}
+		p.folders = append(p.folders, name)
+	case "h3":
+		p.closeAnchor(true)
+		p.flush()
+		p.inH3 = true
+		p.heading.Reset()
+	case "br", "p":
+		// A note runs until the next <DT> or <DL>; line breaks and
+		// paragraphs inside it are kept, other inline markup is reduced
+		// to its text.
+		if p.inNote {
+			p.note.WriteString("\n")
+			if name == "p" {
+				p.note.WriteString("\n")
+			}
+			p.afterBreak = true
+		}
+	}
+}
+
+func (p *netscapeParser) endTag(name string) {
+	switch name {
+	case "a":
+		p.closeAnchor(false)
+	case "h3":
+		if p.inH3 {
+			p.inH3 = false
+			heading := strings.Join(strings.Fields(p.heading.String()), " ")
+			p.pending = &heading
+		}
+	case "dl":
+		p.closeAnchor(true)
+		p.flush()
+		if len(p.folders) > 0 {
+			p.folders = p.folders[:len(p.folders)-1]
+		}
+	}
+}
+
+func (p *netscapeParser) text(s string) {
+	switch {
+	case p.inAnchor:
+		p.title.WriteString(s)
+	case p.inH3:
+		p.heading.WriteString(s)
+	case p.inNote:
+		if p.afterBreak {
+			s = strings.TrimPrefix(strings.TrimPrefix(s, "\r"), "\n")
+			p.afterBreak = false
+		}
+		p.note.WriteString(s)
+	}
+}
+
+func (p *netscapeParser) startBookmark(z *html.Tokenizer, hasAttr bool) {
+	attrs := make(map[string]string)
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		attrs[string(key)] = string(val)
+	}
+
+	uri := strings.TrimSpace(attrs["href"])
+	if uri == "" {
+		return
+	}
+
+	createdAt := parseUnix(attrs["add_date"], p.now)
+	job := &Job{
+		URI:       uri,
+		CreatedAt: createdAt,
+		UpdatedAt: parseUnix(attrs["last_modified"], createdAt),
+		Tags:      splitTags(attrs["tags"]),
+		IconURI:   strings.TrimSpace(attrs["icon_uri"]),
+		Icon:      strings.TrimSpace(attrs["icon"]),
+		Private:   attrs["private"] == "1",
+		Unread:    attrs["toread"] == "1",
+		Starred:   attrs["starred"] == "1",
+		Archived:  attrs["archived"] == "1",
+		LastVisit: parseUnix(attrs["last_visit"], 0),
+		Keyword:   strings.TrimSpace(attrs["shortcuturl"]),
+	}
+
+	if path := p.folderPath(); len(path) > 0 {
+		switch p.opts.Folders {
+		case "tags":
+			job.Tags = append(job.Tags, strings.Join(path, "/"))
+		case "table":
+			job.Folder = path
+		}
+	}
+
+	p.current = job
+	p.inAnchor = true
+	p.title.Reset()
+	p.note.Reset()
+}
+
+// closeAnchor ends the title of the current bookmark. implicit is set when
+// the anchor is closed by something other than </A>, which means the file
+// was malformed and the bookmark is counted as recovered.
+func (p *netscapeParser) closeAnchor(implicit bool) {
+	if !p.inAnchor {
+		return
+	}
+	p.inAnchor = false
+	if p.current == nil {
+		return
+	}
+	p.current.Title = strings.Join(strings.Fields(p.title.String()), " ")
+	if implicit {
+		p.current.Recovered = true
+	}
+}
+
+func (p *netscapeParser) flush() {
+	p.inNote = false
+	if p.current == nil {
+		return
+	}
+	p.current.Note = cleanNote(p.note.String())
+	p.jobs <- *p.current
+	p.current = nil
+}
+
+// cleanNote trims every line of a note and collapses runs of blank lines
+// into one, so paragraphs survive but the indentation of the file does
+// not.
+func cleanNote(note string) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(strings.ReplaceAll(note, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func (p *netscapeParser) folderPath() []string {
+	var path []string
+	for _, name := range p.folders {
+		if name != "" {
+			path = append(path, name)
+		}
+	}
+	return path
+}
+
+func parseUnix(s string, defaultValue int64) int64 {
+	if timestamp, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+		return timestamp
+	}
+	return defaultValue
+}
+
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func parseNetscapeFile(t *testing.T, path string, opts htmlOptions) []Job {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	jobs := make(chan Job)
+	done := make(chan error, 1)
+	go func() {
+		done <- parseNetscape(f, jobs, opts)
+		close(jobs)
+	}()
+	var parsed []Job
+	for job := range jobs {
+		parsed = append(parsed, job)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("parseNetscape(%s): %v", path, err)
+	}
+	return parsed
+}
+
+func TestParseNetscapePinboard(t *testing.T) {
+	jobs := parseNetscapeFile(t, "testdata/pinboard.html", htmlOptions{Folders: "ignore"})
+
+	want := []struct {
+		uri, title, note string
+		tags             []string
+		private, unread  bool
+	}{
+		{"https://go.dev/doc/effective_go", "Effective Go",
+			"Idiomatic Go, straight from the source.\nRead the section on interfaces again.", []string{"go", "docs"}, false, true},
+		{"https://example.com/tom-and-jerry", `Tom & Jerry's "best" episodes`,
+			"Ranked <by me> — not by the studio.", nil, true, false},
+		// The link in the note is text of the note, not a bookmark.
+		{"https://www.sqlite.org/lang.html", "SQL As Understood By SQLite",
+			"See the WITH clause for recursive queries.", []string{"sqlite"}, false, false},
+		{"https://git-scm.com/book/en/v2", "Pro Git", "", []string{"git"}, false, false},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("got %d bookmarks, want %d: %+v", len(jobs), len(want), jobs)
+	}
+	for i, w := range want {
+		job := jobs[i]
+		if job.URI != w.uri || job.Title != w.title || job.Note != w.note {
+			t.Errorf("bookmark %d = %q, %q, %q; want %q, %q, %q", i, job.URI, job.Title, job.Note, w.uri, w.title, w.note)
+		}
+		if !slices.Equal(job.Tags, w.tags) || job.Private != w.private || job.Unread != w.unread {
+			t.Errorf("bookmark %d: tags %q, private %v, unread %v; want %q, %v, %v",
+				i, job.Tags, job.Private, job.Unread, w.tags, w.private, w.unread)
+		}
+		if job.Recovered {
+			t.Errorf("bookmark %d is marked recovered", i)
+		}
+	}
+}
+
+func TestParseNetscapeFirefox(t *testing.T) {
+	jobs := parseNetscapeFile(t, "testdata/firefox.html", htmlOptions{Folders: "tags"})
+
+	want := []struct {
+		uri, title, note string
+		tags             []string
+	}{
+		{"https://www.rfc-editor.org/rfc/rfc3339", "RFC 3339: Date and Time on the Internet",
+			"Timestamps\nas profiles of ISO 8601.\n\nSection 5.6 has the grammar.", []string{"Reading"}},
+		{"https://en.wikipedia.org/wiki/Unix_philosophy", "Unix philosophy",
+			"Do one thing and do it well, as Doug McIlroy put it.\nWrite programs to work together.", []string{"Reading"}},
+		{"https://developer.mozilla.org/", "MDN Web Docs", "", nil},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("got %d bookmarks, want %d: %+v", len(jobs), len(want), jobs)
+	}
+	for i, w := range want {
+		job := jobs[i]
+		if job.URI != w.uri || job.Title != w.title || job.Note != w.note || !slices.Equal(job.Tags, w.tags) {
+			t.Errorf("bookmark %d = %q, %q, %q, %q; want %q, %q, %q, %q",
+				i, job.URI, job.Title, job.Note, job.Tags, w.uri, w.title, w.note, w.tags)
+		}
+	}
+	if jobs[0].Keyword != "rfc3339" || jobs[0].UpdatedAt != 1693612800 {
+		t.Errorf("bookmark 0: keyword %q, updated %d; want rfc3339, 1693612800", jobs[0].Keyword, jobs[0].UpdatedAt)
+	}
+}
+
+func TestCleanNote(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"  one\r\n  two  ", "one\ntwo"},
+		{"one\n\n\n\ntwo", "one\n\ntwo"},
+		{"\n\n  \n", ""},
+	} {
+		if got := cleanNote(tt.in); got != tt.want {
+			t.Errorf("cleanNote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// trackingParams are query parameters added by analytics and ad
+// platforms. They never change which page a URL points to.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// urlKey reduces a URL to what decides whether two bookmarks are the same
+// page: http and https, a leading "www.", default ports, a trailing slash,
+// in-page anchors, tracking parameters and the order of the remaining
+// query parameters are all ignored. Fragments that look like client-side
+// routes ("#/inbox", "#!page") are kept. Anything that does not parse as
+// an absolute URL is its own key.
+func urlKey(uri string) string {
+	uri = strings.TrimSpace(uri)
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	host = strings.TrimPrefix(host, "www.")
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "https" {
+		scheme = "http"
+	}
+
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+
+	var params []string
+	for name, values := range u.Query() {
+		if isTrackingParam(name) {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	sort.Strings(params)
+
+	key := scheme + "://" + host + path
+	if len(params) > 0 {
+		key += "?" + strings.Join(params, "&")
+	}
+	if strings.HasPrefix(u.Fragment, "/") || strings.HasPrefix(u.Fragment, "!") {
+		key += "#" + u.Fragment
+	}
+	return key
+}
+
+// canonicalOptions picks the steps canonicalURL applies to a URL before
+// it is saved. Unlike urlKey it only drops what cannot change the page,
+// so the saved URL still works.
+type canonicalOptions struct {
+	Tracking bool // drop tracking parameters
+	Host     bool // lowercase the host
+	Port     bool // drop :80 and :443 where they are the scheme's default
+	Fragment bool // drop in-page anchors; client-side routes are kept
+}
+
+// canonicalization is read from $BMARK_CANONICALIZE when bmark-importer
+// starts.
+var canonicalization = canonicalOptions{Tracking: true, Host: true, Port: true}
+
+// parseCanonicalization reads a comma-separated list of the steps
+// tracking, host, port and fragment. "none" turns canonicalization off
+// and an empty value keeps the default.
+func parseCanonicalization(value string) (canonicalOptions, error) {
+	if strings.TrimSpace(value) == "" {
+		return canonicalization, nil
+	}
+	var opts canonicalOptions
+	for _, step := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(step)) {
+		case "tracking":
+			opts.Tracking = true
+		case "host":
+			opts.Host = true
+		case "port":
+			opts.Port = true
+		case "fragment":
+			opts.Fragment = true
+		case "none", "":
+		default:
+			return opts, fmt.Errorf("unknown canonicalization step %q, use tracking, host, port, fragment or none", step)
+		}
+	}
+	return opts, nil
+}
+
+// canonicalURL applies opts to uri. A URL that does not parse, or that
+// no step changes, is returned as given apart from surrounding spaces.
+func canonicalURL(uri string, opts canonicalOptions) string {
+	uri = strings.TrimSpace(uri)
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+
+	changed := false
+	if opts.Host && u.Host != strings.ToLower(u.Host) {
+		u.Host = strings.ToLower(u.Host)
+		changed = true
+	}
+	if opts.Port {
+		if port := u.Port(); u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443" {
+			u.Host = strings.TrimSuffix(u.Host, ":"+port)
+			changed = true
+		}
+	}
+	if opts.Tracking && u.RawQuery != "" {
+		var kept []string
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			name, _, _ := strings.Cut(param, "=")
+			if unescaped, err := url.QueryUnescape(name); err == nil && isTrackingParam(unescaped) {
+				continue
+			}
+			kept = append(kept, param)
+		}
+		if query := strings.Join(kept, "&"); query != u.RawQuery {
+			u.RawQuery = query
+			changed = true
+		}
+	}
+	if opts.Fragment && u.Fragment != "" && !strings.HasPrefix(u.Fragment, "/") && !strings.HasPrefix(u.Fragment, "!") {
+		u.Fragment, u.RawFragment = "", ""
+		changed = true
+	}
+	if !changed {
+		return uri
+	}
+	return u.String()
+}
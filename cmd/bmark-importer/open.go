@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openCommand opens a bookmark in the browser and counts the visit. The
+// argument is tried as an ID, a keyword and an exact URL before it is
+// matched fuzzily against titles; when several titles match equally well
+// the candidates are listed instead. --next-unread opens the oldest unread
+// bookmark and marks it read, which works through a reading list one
+// bookmark at a time. --archived opens the Internet Archive snapshot
+// stored by "archive-org save", for pages that are no longer online.
+func openCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("open", flag.ExitOnError)
+	printOnly := fs.Bool("print", false, "print the URL instead of opening it")
+	nextUnread := fs.Bool("next-unread", false, "open the oldest unread bookmark and mark it read")
+	archived := fs.Bool("archived", false, "open the archive.org snapshot instead of the page")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 && !*nextUnread {
+		fmt.Println("Usage: importer-exporter open [--print] [--archived] ID|KEYWORD|URL|TITLE... | --next-unread")
+		os.Exit(1)
+	}
+	query := strings.Join(fs.Args(), " ")
+
+	var b *Bookmark
+	var candidates []Bookmark
+	var err error
+	if *nextUnread {
+		err = forEachBookmark(db, bookmarkFilter{Unread: true, Limit: 1}, func(next Bookmark) error {
+			b = &next
+			return nil
+		})
+		if err == nil && b == nil {
+			fmt.Println("Nothing left to read.")
+			return
+		}
+	} else {
+		b, candidates, err = resolveBookmark(db, query)
+	}
+	if err != nil {
+		log.Fatalf("Failed to find bookmark: %v", err)
+	}
+	if b == nil {
+		if len(candidates) == 0 {
+			fmt.Printf("No bookmark matches %s\n", query)
+		} else {
+			fmt.Printf("%s matches several bookmarks:\n", query)
+			for _, c := range candidates {
+				fmt.Printf("  %d\t%s\t%s\n", c.ID, c.Title, c.URI)
+			}
+		}
+		os.Exit(1)
+	}
+
+	uri := b.URI
+	if *archived {
+		var snapshot sql.NullString
+		if err := db.QueryRow("SELECT snapshot_url FROM bookmarks WHERE id = ?", b.ID).Scan(&snapshot); err != nil {
+			log.Fatalf("Failed to read snapshot: %v", err)
+		}
+		if !snapshot.Valid {
+			fmt.Printf("No snapshot of %s, see bmark archive-org save\n", b.URI)
+			os.Exit(1)
+		}
+		uri = snapshot.String
+	}
+	if *printOnly {
+		fmt.Println(uri)
+	} else if err := openURL(uri); err != nil {
+		log.Fatalf("Failed to open %s: %v", uri, err)
+	}
+	if err := recordVisit(db, b.ID, *nextUnread); err != nil {
+		log.Fatalf("Failed to record visit: %v", err)
+	}
+}
+
+// resolveBookmark returns the bookmark query refers to, or the equally
+// good fuzzy matches when it is ambiguous.
+func resolveBookmark(db *sql.DB, query string) (*Bookmark, []Bookmark, error) {
+	id, idErr := strconv.ParseInt(query, 10, 64)
+
+	var bookmarks []Bookmark
+	err := forEachBookmark(db, bookmarkFilter{}, func(b Bookmark) error {
+		bookmarks = append(bookmarks, b)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, exact := range []func(b Bookmark) bool{
+		func(b Bookmark) bool { return idErr == nil && b.ID == id },
+		func(b Bookmark) bool { return b.Keyword != "" && b.Keyword == query },
+		func(b Bookmark) bool { return b.URI == query },
+	} {
+		for _, b := range bookmarks {
+			if exact(b) {
+				return &b, nil, nil
+			}
+		}
+	}
+
+	best := 0
+	var matches []Bookmark
+	for _, b := range bookmarks {
+		score, ok := fuzzyScore(query, b.Title)
+		if !ok {
+			continue
+		}
+		switch {
+		case len(matches) == 0 || score > best:
+			best = score
+			matches = []Bookmark{b}
+		case score == best:
+			matches = append(matches, b)
+		}
+	}
+	if len(matches) == 1 {
+		return &matches[0], nil, nil
+	}
+	return nil, matches, nil
+}
+
+// openURL hands uri to the desktop's default handler, or to $BROWSER when
+// it is set.
+func openURL(uri string) error {
+	var cmd *exec.Cmd
+	switch browser := os.Getenv("BROWSER"); {
+	case browser != "":
+		cmd = exec.Command(browser, uri)
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("open", uri)
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", uri)
+	default:
+		cmd = exec.Command("xdg-open", uri)
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// recordVisit counts a visit and, with markRead, clears the unread flag.
+// Visiting is not editing, so it is allowed on locked bookmarks.
+func recordVisit(db *sql.DB, id int64, markRead bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := overrideLocks(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE bookmarks SET visit_count = visit_count + 1, last_visited_at = ?,
+		unread = CASE WHEN ? THEN 0 ELSE unread END WHERE id = ?`, time.Now().Unix(), markRead, id)
+	if err != nil {
+		return err
+	}
+	if err := restoreLocks(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const orgTimestampLayout = "2006-01-02 Mon 15:04"
+
+// Org tags may only contain letters, digits, '_', '@', '#' and '%'.
+var orgTagInvalid = regexp.MustCompile(`[^\p{L}\p{N}_@#%]+`)
+
+var orgLinkEscaper = strings.NewReplacer("[", "{", "]", "}")
+
+// writeOrg writes one top-level heading per bookmark, linking to it and
+// carrying its tags. Timestamps go into a :PROPERTIES: drawer as inactive
+// org timestamps and the note becomes the body of the entry.
+func writeOrg(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	fmt.Fprintln(out, "#+TITLE: Bookmarks")
+
+	count := 0
+	err := forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		count++
+		title := b.Title
+		if title == "" {
+			title = b.URI
+		}
+		heading := fmt.Sprintf("\n* [[%s][%s]]", orgLinkEscaper.Replace(b.URI), orgLinkEscaper.Replace(title))
+		if tags := orgTags(b.Tags); tags != "" {
+			heading += " " + tags
+		}
+		fmt.Fprintln(out, heading)
+		fmt.Fprintln(out, ":PROPERTIES:")
+		fmt.Fprintf(out, ":CREATED: %s\n", orgTimestamp(b.CreatedAt))
+		fmt.Fprintf(out, ":UPDATED: %s\n", orgTimestamp(b.UpdatedAt))
+		_, err := fmt.Fprintln(out, ":END:")
+
+		// Indenting the note keeps lines starting with '*' from being
+		// read as headings.
+		for _, line := range strings.Split(b.Note, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				_, err = fmt.Fprintf(out, "  %s\n", line)
+			}
+		}
+		return err
+	})
+	return count, err
+}
+
+func orgTags(tags []string) string {
+	var names []string
+	for _, tag := range tags {
+		if tag = strings.Trim(orgTagInvalid.ReplaceAllString(tag, "_"), "_"); tag != "" {
+			names = append(names, tag)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return ":" + strings.Join(names, ":") + ":"
+}
+
+func orgTimestamp(unix int64) string {
+	return "[" + time.Unix(unix, 0).Format(orgTimestampLayout) + "]"
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// The readable text of archived pages is kept in page_texts, one row per
+// bookmark, for "search --content". It is taken from the archive.org
+// snapshot rather than the live page, so it is the page as it was saved.
+
+const pageTextsSchema = `CREATE TABLE IF NOT EXISTS page_texts (
+	bookmark_id INTEGER PRIMARY KEY,
+	text TEXT NOT NULL,
+	snapshot_url TEXT NOT NULL,
+	indexed_at INTEGER NOT NULL,
+	FOREIGN KEY (bookmark_id) REFERENCES bookmarks(id) ON DELETE CASCADE
+);`
+
+const pageTextSearchSchema = `CREATE VIRTUAL TABLE IF NOT EXISTS page_texts_fts USING fts5(
+	text,
+	content='page_texts', content_rowid='bookmark_id',
+	tokenize='unicode61 remove_diacritics 2'
+);`
+
+var pageTextSearchTriggers = []ftsTrigger{
+	{"page_texts_fts_insert", `CREATE TRIGGER IF NOT EXISTS page_texts_fts_insert
+		AFTER INSERT ON page_texts BEGIN
+		INSERT INTO page_texts_fts (rowid, text) VALUES (NEW.bookmark_id, NEW.text);
+		END;`},
+	{"page_texts_fts_delete", `CREATE TRIGGER IF NOT EXISTS page_texts_fts_delete
+		AFTER DELETE ON page_texts BEGIN
+		INSERT INTO page_texts_fts (page_texts_fts, rowid, text) VALUES ('delete', OLD.bookmark_id, OLD.text);
+		END;`},
+	{"page_texts_fts_update", `CREATE TRIGGER IF NOT EXISTS page_texts_fts_update
+		AFTER UPDATE OF text ON page_texts BEGIN
+		INSERT INTO page_texts_fts (page_texts_fts, rowid, text) VALUES ('delete', OLD.bookmark_id, OLD.text);
+		INSERT INTO page_texts_fts (rowid, text) VALUES (NEW.bookmark_id, NEW.text);
+		END;`},
+}
+
+// skippedElements hold no readable text.
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true,
+}
+
+// extractText returns the visible text of an HTML page with runs of
+// whitespace collapsed.
+func extractText(page string) string {
+	z := html.NewTokenizer(strings.NewReader(page))
+	skipping := ""
+	var words []string
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(words, " ")
+		case html.StartTagToken:
+			if name, _ := z.TagName(); skipping == "" && skippedElements[string(name)] {
+				skipping = string(name)
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == skipping {
+				skipping = ""
+			}
+		case html.TextToken:
+			if skipping == "" {
+				words = append(words, strings.Fields(string(z.Text()))...)
+			}
+		}
+	}
+}
+
+var waybackTimestamp = regexp.MustCompile(`/web/(\d+)[a-z]*_?/`)
+
+// rawSnapshotURL turns a Wayback Machine snapshot URL into the one that
+// serves the page as captured, without the archive's toolbar and with
+// its links left alone.
+func rawSnapshotURL(snapshot string) string {
+	m := waybackTimestamp.FindStringSubmatchIndex(snapshot)
+	if m == nil {
+		return snapshot
+	}
+	return snapshot[:m[0]] + "/web/" + snapshot[m[2]:m[3]] + "id_/" + snapshot[m[1]:]
+}
+
+// minHashedWords keeps near-empty pages, such as cookie walls and pages
+// that need JavaScript, from all counting as the same content.
+const minHashedWords = 50
+
+// contentHash identifies the text of a page regardless of case and
+// spacing, or is empty when there is too little text to go by.
+func contentHash(text string) string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) < minHashedWords {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(words, " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentHashes returns the content hash of every indexed page, first
+// hashing the texts stored without one.
+func contentHashes(db *sql.DB) (map[int64]string, error) {
+	hashes := make(map[int64]string)
+	missing := make(map[int64]string)
+	err := queryEach(db, "SELECT bookmark_id, COALESCE(content_hash, ''), content_hash IS NULL, text FROM page_texts", func(rows *sql.Rows) error {
+		var id int64
+		var hash, text string
+		var unhashed bool
+		if err := rows.Scan(&id, &hash, &unhashed, &text); err != nil {
+			return err
+		}
+		if unhashed {
+			hash = contentHash(text)
+			missing[id] = hash
+		}
+		if hash != "" {
+			hashes[id] = hash
+		}
+		return nil
+	})
+	if err != nil || len(missing) == 0 {
+		return hashes, err
+	}
+	err = inTagTx(db, false, func(tx *sql.Tx) error {
+		for id, hash := range missing {
+			if _, err := tx.Exec("UPDATE page_texts SET content_hash = ? WHERE bookmark_id = ?", hash, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+// indexSnapshot fetches an archived page and stores its text and content
+// hash for the bookmark.
+func indexSnapshot(db *sql.DB, client *http.Client, id int64, snapshot string) error {
+	page, _, err := fetchHTML(client, rawSnapshotURL(snapshot))
+	if err != nil {
+		return err
+	}
+	text := extractText(page)
+	// An upsert rather than INSERT OR REPLACE, whose implicit delete would
+	// not reach the search index.
+	_, err = db.Exec(`INSERT INTO page_texts (bookmark_id, text, snapshot_url, indexed_at, content_hash) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (bookmark_id) DO UPDATE SET text = excluded.text, snapshot_url = excluded.snapshot_url,
+		indexed_at = excluded.indexed_at, content_hash = excluded.content_hash`,
+		id, text, snapshot, time.Now().Unix(), contentHash(text))
+	return err
+}
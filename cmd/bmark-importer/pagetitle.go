@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// pageInfo is what add and enrich take from the page a bookmark points
+// at. Canonical and Icon are absolute URLs.
+type pageInfo struct {
+	Title       string
+	Description string
+	Canonical   string
+	Icon        string
+}
+
+// maxPageSize bounds how much of a page is read.
+const maxPageSize = 1 << 20
+
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([a-z0-9_.:-]+)`)
+
+// fetchPageInfo reads the head of an HTML page (see pageInfo).
+func fetchPageInfo(client *http.Client, uri string) (pageInfo, error) {
+	page, base, err := fetchHTML(client, uri)
+	if err != nil {
+		return pageInfo{}, err
+	}
+	info := parsePageInfo(page)
+	info.Canonical = resolveHref(base, info.Canonical)
+	info.Icon = resolveHref(base, info.Icon)
+	return info, nil
+}
+
+// fetchHTML reads an HTML page as UTF-8, along with the URL it was read
+// from after redirects. The charset comes from the Content-Type header or
+// a <meta> tag in the first kilobyte, as browsers look for it.
+func fetchHTML(client *http.Client, uri string) (string, *url.URL, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", nil, fmt.Errorf("not an HTML page but %s", mediaType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return "", nil, err
+	}
+
+	charset := params["charset"]
+	if charset == "" {
+		if m := metaCharset.FindSubmatch(body[:min(len(body), 1024)]); m != nil {
+			charset = string(m[1])
+		}
+	}
+	text, err := decodeCharset(body, charset)
+	if err != nil {
+		return "", nil, err
+	}
+	return text, resp.Request.URL, nil
+}
+
+func resolveHref(base *url.URL, href string) string {
+	if href == "" {
+		return ""
+	}
+	u, err := base.Parse(strings.TrimSpace(href))
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+// parsePageInfo takes the <title> and description of a page from its
+// <head>, falling back to the Open Graph tags, along with the canonical
+// link and icon as written in the page.
+func parsePageInfo(page string) pageInfo {
+	var info, og pageInfo
+	z := html.NewTokenizer(strings.NewReader(page))
+	inTitle := false
+	var title strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return finishPageInfo(info, og, title.String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = title.Len() == 0
+			case "body":
+				return finishPageInfo(info, og, title.String())
+			case "link":
+				attrs := tagAttrs(z, hasAttr)
+				rel := strings.Fields(strings.ToLower(attrs["rel"]))
+				switch {
+				case slices.Contains(rel, "canonical"):
+					info.Canonical = attrs["href"]
+				case slices.Contains(rel, "icon") && info.Icon == "":
+					info.Icon = attrs["href"]
+				}
+			case "meta":
+				attrs := tagAttrs(z, hasAttr)
+				switch content := attrs["content"]; {
+				case strings.EqualFold(attrs["name"], "description"):
+					info.Description = content
+				case attrs["property"] == "og:description":
+					og.Description = content
+				case attrs["property"] == "og:title":
+					og.Title = content
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		}
+	}
+}
+
+func tagAttrs(z *html.Tokenizer, hasAttr bool) map[string]string {
+	attrs := make(map[string]string)
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = z.TagAttr()
+		attrs[string(key)] = string(value)
+	}
+	return attrs
+}
+
+func finishPageInfo(info, og pageInfo, title string) pageInfo {
+	info.Title = title
+	if strings.TrimSpace(info.Title) == "" {
+		info.Title = og.Title
+	}
+	if strings.TrimSpace(info.Description) == "" {
+		info.Description = og.Description
+	}
+	info.Title = strings.Join(strings.Fields(info.Title), " ")
+	info.Description = strings.Join(strings.Fields(info.Description), " ")
+	return info
+}
+
+// windows1252 maps the bytes 0x80 to 0x9f, which differ from Latin-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// decodeCharset converts a page to UTF-8. Besides UTF-8 only the Latin-1
+// family is known; like browsers, ISO-8859-1 and ASCII are read as
+// Windows-1252. Without a charset, a page that is not valid UTF-8 is
+// taken to be Windows-1252 too.
+func decodeCharset(body []byte, charset string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "unicode-1-1-utf-8":
+		if utf8.Valid(body) || charset != "" {
+			return string(bytes.ToValidUTF8(body, []byte("�"))), nil
+		}
+	case "iso-8859-1", "iso8859-1", "latin1", "l1", "windows-1252", "cp1252", "us-ascii", "ascii":
+	default:
+		if utf8.Valid(body) {
+			return string(body), nil
+		}
+		return "", fmt.Errorf("unsupported charset %s", charset)
+	}
+
+	var sb strings.Builder
+	for _, c := range body {
+		if c >= 0x80 && c < 0xa0 {
+			sb.WriteRune(windows1252[c-0x80])
+		} else {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String(), nil
+}
+
+// hostTitle is the title of a bookmark whose page could not be read.
+func hostTitle(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return uri
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
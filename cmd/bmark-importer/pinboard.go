@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Pinboard allows one posts/add call every three seconds.
+const pinboardInterval = 3 * time.Second
+
+// exportPinboard mirrors bookmarks to Pinboard through posts/add. Existing
+// Pinboard bookmarks with the same URL are replaced, so bmark stays the
+// source of truth.
+func exportPinboard(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("export pinboard", flag.ExitOnError)
+	token := fs.String("token", os.Getenv("PINBOARD_TOKEN"), "API token as user:TOKEN (default $PINBOARD_TOKEN)")
+	api := fs.String("api", "https://api.pinboard.in/v1", "API base URL")
+	tag := fs.String("tag", "", "only push bookmarks with this tag")
+	fs.Parse(args)
+
+	if *token == "" {
+		fmt.Println("Usage: importer-exporter export pinboard --token user:TOKEN [--tag TAG]")
+		os.Exit(1)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	pushBookmarks(db, "pinboard", bookmarkFilter{Tags: splitTags(*tag)}, pinboardInterval, func(b Bookmark) error {
+		return pinboardAdd(client, *api, *token, b)
+	})
+}
+
+func pinboardAdd(client *http.Client, api, token string, b Bookmark) error {
+	title := b.Title
+	if title == "" {
+		title = b.URI
+	}
+	params := url.Values{
+		"auth_token":  {token},
+		"format":      {"json"},
+		"url":         {b.URI},
+		"description": {title},
+		"extended":    {b.Note},
+		"tags":        {pinboardTags(b.Tags)},
+		"dt":          {formatTime(b.CreatedAt)},
+		"replace":     {"yes"},
+		"shared":      {"yes"},
+		"toread":      {"no"},
+	}
+	if b.Private {
+		params.Set("shared", "no")
+	}
+	if b.Unread {
+		params.Set("toread", "yes")
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(api, "/") + "/posts/add?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return errRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var result struct {
+		ResultCode string `json:"result_code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if result.ResultCode != "done" {
+		return fmt.Errorf("pinboard said: %s", result.ResultCode)
+	}
+	return nil
+}
+
+// pinboardTags joins tags with spaces, which Pinboard uses as separator,
+// so spaces and commas inside a tag become underscores.
+func pinboardTags(tags []string) string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, strings.Join(strings.FieldsFunc(tag, func(r rune) bool {
+			return r == ' ' || r == ','
+		}), "_"))
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Public pages show other people the bookmarks one chose to share, like
+// a public profile on Pinboard, while serve keeps everything else behind
+// a token. A bookmark is public when it was published with "bmark
+// publish", or when one of its tags, or a tag above it, was published with
+// "bmark tag publish"; private bookmarks never are. The pages and their
+// Atom feeds need no token:
+//
+//	/u/USER/               the public bookmarks of USER, newest first
+//	/u/USER/t/TAG          those tagged TAG, or a tag below it
+//	/u/USER/b/ID           one bookmark, as a link to share
+//	/u/USER/feed           Atom feed of /u/USER/
+//	/u/USER/feed/t/TAG     Atom feed of /u/USER/t/TAG
+//
+// The owner of the database serve runs on is USER as given with --owner.
+
+// publicView is what a database shares.
+type publicView struct {
+	tags map[string]bool
+	ids  map[int64]bool
+}
+
+func loadPublicView(db *sql.DB) (publicView, error) {
+	v := publicView{tags: make(map[string]bool), ids: make(map[int64]bool)}
+	err := queryEach(db, "SELECT tag FROM tags WHERE public = 1", func(rows *sql.Rows) error {
+		var tag string
+		err := rows.Scan(&tag)
+		v.tags[tag] = true
+		return err
+	})
+	if err != nil {
+		return v, err
+	}
+	err = queryEach(db, "SELECT id FROM bookmarks WHERE public = 1", func(rows *sql.Rows) error {
+		var id int64
+		err := rows.Scan(&id)
+		v.ids[id] = true
+		return err
+	})
+	return v, err
+}
+
+// tagPublic reports whether tag or a tag above it is published.
+func (v publicView) tagPublic(tag string) bool {
+	for {
+		if v.tags[tag] {
+			return true
+		}
+		i := strings.LastIndex(tag, "/")
+		if i < 0 {
+			return false
+		}
+		tag = tag[:i]
+	}
+}
+
+func (v publicView) shows(b Bookmark) bool {
+	if b.Private {
+		return false
+	}
+	if v.ids[b.ID] {
+		return true
+	}
+	for _, tag := range b.Tags {
+		if v.tagPublic(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicBookmarks returns the public bookmarks of db that filter passes,
+// newest first.
+func publicBookmarks(db *sql.DB, filter bookmarkFilter) ([]Bookmark, error) {
+	v, err := loadPublicView(db)
+	if err != nil {
+		return nil, err
+	}
+	filter.NewestFirst = true
+	var bookmarks []Bookmark
+	err = forEachBookmark(db, filter, func(b Bookmark) error {
+		if v.shows(b) {
+			bookmarks = append(bookmarks, b)
+		}
+		return nil
+	})
+	return bookmarks, err
+}
+
+type publicPage struct {
+	User      string
+	Tag       string
+	Feed      string
+	Bookmarks []Bookmark
+	Tags      []tagCount
+}
+
+var publicTemplate = template.Must(template.New("public").Funcs(template.FuncMap{
+	"pathEscape": url.PathEscape,
+	"date":       func(unix int64) string { return time.Unix(unix, 0).Format("2006-01-02") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Tag}}{{.Tag}} - {{end}}{{.User}}'s bookmarks</title>
+{{if .Feed}}<link rel="alternate" type="application/atom+xml" href="{{.Feed}}">{{end}}
+<style>
+:root { color-scheme: light dark; }
+body { font: 16px/1.5 system-ui, sans-serif; max-width: 50rem; margin: 0 auto; padding: 1rem; }
+a { text-decoration: none; }
+ul.bookmarks { list-style: none; padding: 0; }
+ul.bookmarks li { padding: .6rem 0; border-bottom: 1px solid GrayText; }
+.url, .note, .meta { color: GrayText; font-size: .875rem; overflow-wrap: anywhere; }
+.tag { margin-right: .4rem; font-size: .8rem; }
+</style>
+</head>
+<body>
+<h1><a href="/u/{{pathEscape .User}}/">{{.User}}'s bookmarks</a>{{if .Tag}} tagged {{.Tag}}{{end}}</h1>
+{{if .Tags}}<p class="meta">{{range .Tags}}<a class="tag" href="/u/{{pathEscape $.User}}/t/{{pathEscape .Tag}}">#{{.Tag}}</a> {{end}}</p>{{end}}
+<ul class="bookmarks">
+{{range .Bookmarks}}<li><a href="{{.URI}}">{{or .Title .URI}}</a>
+<div class="url">{{.URI}}</div>
+{{if .Note}}<div class="note">{{.Note}}</div>{{end}}
+<div class="meta">{{date .CreatedAt}} {{range .Tags}}<a class="tag" href="/u/{{pathEscape $.User}}/t/{{pathEscape .}}">#{{.}}</a>{{end}} <a href="/u/{{pathEscape $.User}}/b/{{.ID}}">share</a></div></li>
+{{end}}</ul>
+{{if .Feed}}<p class="meta"><a href="{{.Feed}}">Atom feed</a></p>{{end}}
+</body>
+</html>
+`))
+
+// publicStore returns the database of the user named in the path, or
+// writes a 404 and returns nil.
+func (s *apiServer) publicStore(w http.ResponseWriter, r *http.Request) *sql.DB {
+	name := r.PathValue("user")
+	if name == s.owner {
+		return s.db
+	}
+	id, err := userID(s.db, name)
+	if err == nil && id != 0 {
+		var db *sql.DB
+		if db, err = s.userDatabase(id); err == nil {
+			return db
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to open database of %s: %v", name, err)
+	}
+	http.NotFound(w, r)
+	return nil
+}
+
+func writePublicPage(w http.ResponseWriter, page publicPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if err := publicTemplate.Execute(w, page); err != nil {
+		log.Printf("Failed to write page: %v", err)
+	}
+}
+
+// publicTags counts the public bookmarks of each published tag.
+func publicTags(db *sql.DB, bookmarks []Bookmark) ([]tagCount, error) {
+	v, err := loadPublicView(db)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, b := range bookmarks {
+		for _, tag := range b.Tags {
+			if v.tagPublic(tag) {
+				counts[tag]++
+			}
+		}
+	}
+	tags := make([]tagCount, 0, len(counts))
+	for tag, n := range counts {
+		tags = append(tags, tagCount{Tag: tag, Count: n})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags, nil
+}
+
+// publicList answers the pages and feeds of a user and of their tags.
+func (s *apiServer) publicList(feed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := s.publicStore(w, r)
+		if db == nil {
+			return
+		}
+		user, tag := r.PathValue("user"), r.PathValue("tag")
+		var filter bookmarkFilter
+		if tag != "" {
+			filter.Tags = []string{tag}
+		}
+		bookmarks, err := publicBookmarks(db, filter)
+		if err != nil {
+			log.Printf("Failed to read public bookmarks of %s: %v", user, err)
+			http.Error(w, "failed to read bookmarks", http.StatusInternalServerError)
+			return
+		}
+		if tag != "" && len(bookmarks) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		feedPath := "/u/" + url.PathEscape(user) + "/feed"
+		if tag != "" {
+			feedPath += "/t/" + url.PathEscape(tag)
+		}
+		if feed {
+			atom := atomFeed{
+				ID:     "urn:bmark:user:" + url.PathEscape(user),
+				Title:  user + "'s bookmarks",
+				Author: atomAuthor{Name: user},
+			}
+			if tag != "" {
+				atom.ID += ":tag:" + url.PathEscape(tag)
+				atom.Title += " tagged " + tag
+			}
+			w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+			if err := encodeAtom(w, atom, bookmarks[:min(len(bookmarks), defaultAtomLimit)]); err != nil {
+				log.Printf("Failed to write feed: %v", err)
+			}
+			return
+		}
+		page := publicPage{User: user, Tag: tag, Feed: feedPath, Bookmarks: bookmarks}
+		if tag == "" {
+			if page.Tags, err = publicTags(db, bookmarks); err != nil {
+				log.Printf("Failed to read public tags of %s: %v", user, err)
+			}
+		}
+		writePublicPage(w, page)
+	}
+}
+
+// publicBookmark answers the share page of one public bookmark.
+func (s *apiServer) publicBookmark(w http.ResponseWriter, r *http.Request) {
+	db := s.publicStore(w, r)
+	if db == nil {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	bookmarks, err := publicBookmarks(db, bookmarkFilter{})
+	if err != nil {
+		log.Printf("Failed to read public bookmarks: %v", err)
+		http.Error(w, "failed to read bookmarks", http.StatusInternalServerError)
+		return
+	}
+	for _, b := range bookmarks {
+		if b.ID == id {
+			writePublicPage(w, publicPage{User: r.PathValue("user"), Bookmarks: []Bookmark{b}})
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// listPublic answers GET /public with what the user of the token shares.
+func (s *apiServer) listPublic(w http.ResponseWriter, r *http.Request) {
+	v, err := loadPublicView(store(r))
+	if err != nil {
+		log.Printf("Failed to read public bookmarks: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to read public bookmarks")
+		return
+	}
+	result := struct {
+		Tags      []string `json:"tags"`
+		Bookmarks []int64  `json:"bookmarks"`
+	}{Tags: []string{}, Bookmarks: []int64{}}
+	for tag := range v.tags {
+		result.Tags = append(result.Tags, tag)
+	}
+	for id := range v.ids {
+		result.Bookmarks = append(result.Bookmarks, id)
+	}
+	sort.Strings(result.Tags)
+	sort.Slice(result.Bookmarks, func(i, j int) bool { return result.Bookmarks[i] < result.Bookmarks[j] })
+	writeAPIJSON(w, http.StatusOK, result)
+}
+
+// setPublic answers PUT and DELETE of /public/tags/{tag} and
+// /public/bookmarks/{id}, which publish and unpublish. Like the other
+// statuses, publishing is allowed on locked bookmarks.
+func (s *apiServer) setPublic(w http.ResponseWriter, r *http.Request) {
+	public := r.Method == http.MethodPut
+	query, key := "UPDATE tags SET public = ? WHERE tag = ?", any(r.PathValue("tag"))
+	if r.PathValue("tag") == "" {
+		b := s.lookup(w, r)
+		if b == nil {
+			return
+		}
+		query, key = "UPDATE bookmarks SET public = ? WHERE id = ?", b.ID
+	}
+	var n int64
+	err := s.change(r, func() error {
+		return inTagTx(store(r), true, func(tx *sql.Tx) error {
+			res, err := tx.Exec(query, public, key)
+			if err == nil {
+				n, err = res.RowsAffected()
+			}
+			return err
+		})
+	})
+	if err != nil {
+		log.Printf("Failed to publish %v: %v", key, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to publish")
+		return
+	}
+	if n == 0 {
+		writeAPIError(w, http.StatusNotFound, "no such tag")
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]bool{"public": public})
+}
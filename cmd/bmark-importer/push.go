@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// push_state remembers which version of each bookmark was last pushed to
+// a remote service, so an interrupted push resumes where it stopped and
+// later pushes only send what changed.
+const pushStateSchema = `CREATE TABLE IF NOT EXISTS push_state (
+	service TEXT NOT NULL,
+	bookmark_id INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	pushed_at INTEGER NOT NULL,
+	PRIMARY KEY (service, bookmark_id),
+	FOREIGN KEY (bookmark_id) REFERENCES bookmarks(id) ON DELETE CASCADE
+);`
+
+// errRateLimited is returned by a push function when the service asks
+// the client to slow down; the bookmark is retried after a longer pause.
+var errRateLimited = errors.New("rate limited")
+
+// pushBookmarks sends every bookmark matching filter that service has not
+// seen in its current version, waiting interval between requests. Each
+// successful push is recorded right away, and Ctrl-C stops after the
+// request in flight, so nothing is sent twice on the next run.
+func pushBookmarks(db *sql.DB, service string, filter bookmarkFilter, interval time.Duration, push func(Bookmark) error) {
+	filter.Unpushed = service
+
+	// The pending list is read up front: recording progress needs the
+	// connection the bookmark query would otherwise hold.
+	var pending []Bookmark
+	err := forEachBookmark(db, filter, func(b Bookmark) error {
+		pending = append(pending, b)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(pending) == 0 {
+		fmt.Printf("Nothing to push, %s is up to date.\n", service)
+		return
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+
+	pushed, failed, requests := 0, 0, 0
+	wait := interval
+	for i := 0; i < len(pending); i++ {
+		if requests > 0 {
+			select {
+			case <-stop:
+				fmt.Printf("Interrupted. Pushed %d of %d bookmarks; run again to resume.\n", pushed, len(pending))
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		b := pending[i]
+		requests++
+		err := push(b)
+		if errors.Is(err, errRateLimited) {
+			wait *= 2
+			log.Printf("%s is rate limiting, waiting %s between requests", service, wait)
+			i--
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to push %s: %v", b.URI, err)
+			failed++
+			continue
+		}
+
+		_, err = db.Exec(`INSERT OR REPLACE INTO push_state (service, bookmark_id, updated_at, pushed_at)
+			VALUES (?, ?, ?, ?)`, service, b.ID, b.UpdatedAt, time.Now().Unix())
+		if err != nil {
+			log.Fatalf("Failed to record push of %s: %v", b.URI, err)
+		}
+		pushed++
+		wait = interval
+	}
+
+	fmt.Printf("Pushed %d bookmarks to %s.\n", pushed, service)
+	if failed > 0 {
+		fmt.Printf("%d bookmarks failed and will be retried on the next run.\n", failed)
+		os.Exit(1)
+	}
+}
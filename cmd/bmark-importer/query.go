@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A bookmark query combines terms with AND, OR, NOT and parentheses; terms
+// next to each other must all match, and NOT binds tighter than AND,
+// which binds tighter than OR:
+//
+//	(golang AND cli) NOT archived tag:work domain:github.com
+//
+// A bare word is a tag, except for starred, unread, archived, locked,
+// private and untagged, which are the same as is:starred and so on; write
+// tag:archived for a tag of that name. The key:value terms of
+// assert --query work too, and a leading "-" negates a term. Values with
+// spaces go in double quotes.
+
+// bookmarkQuery is a query compiled to a condition on the bookmarks
+// table, aliased b.
+type bookmarkQuery struct {
+	Where string
+	Args  []any
+	// Archived is set when the query asks about the archive state, which
+	// then overrides HideArchived.
+	Archived bool
+}
+
+// tagCondition matches bookmarks carrying the tag given as argument or a
+// tag below it: "/" separates the levels of hierarchical tags, so lang
+// matches lang/go and lang/go/generics but not language.
+const tagCondition = `b.id IN (SELECT bt.bookmark_id FROM bookmark_tags bt
+	JOIN tags t ON bt.tag_id = t.id, (SELECT ? AS want) w
+	WHERE t.tag = w.want OR substr(t.tag, 1, length(w.want) + 1) = w.want || '/')`
+
+var stateConditions = map[string]string{
+	"starred":  "b.starred = 1",
+	"unread":   "b.unread = 1",
+	"archived": "b.archived = 1",
+	"locked":   "b.locked = 1",
+	"private":  "b.private = 1",
+	"untagged": "NOT EXISTS (SELECT 1 FROM bookmark_tags u WHERE u.bookmark_id = b.id)",
+}
+
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+func (t queryToken) is(op string) bool {
+	return !t.quoted && t.text == op
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	query  bookmarkQuery
+}
+
+func compileQuery(query string) (bookmarkQuery, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return bookmarkQuery{}, err
+	}
+	if len(tokens) == 0 {
+		return bookmarkQuery{}, fmt.Errorf("the query is empty")
+	}
+	p := &queryParser{tokens: tokens}
+	where, err := p.or()
+	if err != nil {
+		return bookmarkQuery{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return bookmarkQuery{}, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	p.query.Where = where
+	return p.query, nil
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	var word strings.Builder
+	quoted, inQuotes, started := false, false, false
+	flush := func() {
+		if started {
+			tokens = append(tokens, queryToken{text: word.String(), quoted: quoted})
+		}
+		word.Reset()
+		quoted, started = false, false
+	}
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			quoted, started = true, true
+		case inQuotes:
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, queryToken{text: string(r)})
+		default:
+			word.WriteRune(r)
+			started = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	flush()
+	return tokens, nil
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) or() (string, error) {
+	left, err := p.and()
+	if err != nil {
+		return "", err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || !t.is("OR") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+}
+
+func (p *queryParser) and() (string, error) {
+	left, err := p.unary()
+	if err != nil {
+		return "", err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.is(")") || t.is("OR") {
+			return left, nil
+		}
+		if t.is("AND") {
+			p.pos++
+		}
+		right, err := p.unary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+}
+
+func (p *queryParser) unary() (string, error) {
+	t, ok := p.peek()
+	if !ok {
+		return "", fmt.Errorf("the query ends too early")
+	}
+	p.pos++
+	switch {
+	case t.is("NOT"):
+		operand, err := p.unary()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + operand, nil
+	case t.is("("):
+		inner, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		if t, ok := p.peek(); !ok || !t.is(")") {
+			return "", fmt.Errorf("missing )")
+		}
+		p.pos++
+		return inner, nil
+	case t.is(")"), t.is("AND"), t.is("OR"):
+		return "", fmt.Errorf("unexpected %q", t.text)
+	case !t.quoted && len(t.text) > 1 && strings.HasPrefix(t.text, "-"):
+		term, err := p.term(queryToken{text: t.text[1:]})
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + term, nil
+	}
+	return p.term(t)
+}
+
+func (p *queryParser) term(t queryToken) (string, error) {
+	key, value, ok := strings.Cut(t.text, ":")
+	if t.quoted || !ok {
+		if condition, state := stateConditions[t.text]; state && !t.quoted {
+			p.query.Archived = p.query.Archived || t.text == "archived"
+			return condition, nil
+		}
+		key, value = "tag", t.text
+	}
+	if value == "" {
+		return "", fmt.Errorf("%q needs a value", t.text)
+	}
+
+	switch key {
+	case "tag":
+		p.query.Args = append(p.query.Args, value)
+		return tagCondition, nil
+	case "domain":
+		value = strings.ToLower(value)
+		p.query.Args = append(p.query.Args, value, "%."+value)
+		return "(url_host(b.url) = ? OR url_host(b.url) LIKE ?)", nil
+	case "since", "until":
+		at, err := parseDateFlag(value, key == "until")
+		if err != nil {
+			return "", err
+		}
+		p.query.Args = append(p.query.Args, at)
+		if key == "since" {
+			return "b.created_at >= ?", nil
+		}
+		return "b.created_at < ?", nil
+	case "is":
+		condition, ok := stateConditions[value]
+		if !ok {
+			return "", fmt.Errorf("unknown state %q, use starred, unread, archived, locked, private or untagged", value)
+		}
+		p.query.Archived = p.query.Archived || value == "archived"
+		return condition, nil
+	default:
+		return "", fmt.Errorf("unknown term %q, use tag, domain, since, until or is", key)
+	}
+}
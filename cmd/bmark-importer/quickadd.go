@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GET /add is what the bookmarklet opens: a plain page load, which cannot
+// carry an Authorization header, so the token comes along as a parameter.
+// It saves the page and answers with a page to tag it on, whose form posts
+// back to /add.
+
+type quickAddPage struct {
+	Message string
+	Error   string
+	ID      int64
+	URL     string
+	Title   string
+	Tags    string
+	Token   string
+}
+
+var quickAddTemplate = template.Must(template.New("add").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Error}}Not saved{{else}}{{.Message}}{{end}} - bmark</title>
+<style>
+:root { color-scheme: light dark; }
+body { font: 16px/1.5 system-ui, sans-serif; max-width: 30rem; margin: 2rem auto; padding: 0 1rem; }
+.url { color: GrayText; font-size: .875rem; overflow-wrap: anywhere; }
+.error { color: #cf222e; }
+form { display: flex; gap: .5rem; }
+input { flex: 1; min-width: 0; }
+input, button { font: inherit; padding: .4rem .6rem; }
+</style>
+</head>
+<body>
+{{if .Error}}<p class="error">{{.Error}}</p>{{else}}<p>{{.Message}}</p>{{end}}
+{{if .ID}}<p><a href="{{.URL}}">{{or .Title .URL}}</a></p>
+<p class="url">{{.URL}}</p>
+<form method="post" action="/add">
+<input type="hidden" name="id" value="{{.ID}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<input name="tags" value="{{.Tags}}" placeholder="Tags, comma separated" aria-label="Tags" autofocus>
+<button>Save tags</button>
+</form>{{end}}
+<p class="url"><a href="/">All bookmarks</a></p>
+</body>
+</html>
+`))
+
+// paramToken returns the token of a quick add request: the token
+// parameter, or the one in the Authorization header.
+func paramToken(r *http.Request) string {
+	if secret := r.FormValue("token"); secret != "" {
+		return secret
+	}
+	secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return secret
+}
+
+func (s *apiServer) writeQuickAddPage(w http.ResponseWriter, status int, page quickAddPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	if err := quickAddTemplate.Execute(w, page); err != nil {
+		log.Printf("Failed to write page: %v", err)
+	}
+}
+
+// quickAdd answers GET /add?url=URL&title=TITLE&token=TOKEN. Like add, it
+// titles a bookmark without a title from its page; a URL that is already
+// saved is not saved again, and its tags can be changed on the page.
+func (s *apiServer) quickAdd(w http.ResponseWriter, r *http.Request) {
+	// Saving is a change, although the bookmarklet has to use GET.
+	r, status, message := s.authorize(r, paramToken(r), "write")
+	if status != 0 {
+		s.writeQuickAddPage(w, status, quickAddPage{Error: "Not saved: " + message + ". Copy the bookmarklet from the web UI again."})
+		return
+	}
+	uri := strings.TrimSpace(r.FormValue("url"))
+	if uri == "" {
+		s.writeQuickAddPage(w, http.StatusBadRequest, quickAddPage{Error: "Missing url."})
+		return
+	}
+	now := time.Now().Unix()
+	job := Job{URI: uri, Title: strings.TrimSpace(r.FormValue("title")), CreatedAt: now, UpdatedAt: now}
+
+	var id int64
+	var saved bool
+	err := s.change(r, func() error {
+		var err error
+		id, saved, err = addBookmark(store(r), job, true)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to add %s: %v", uri, err)
+		s.writeQuickAddPage(w, http.StatusInternalServerError, quickAddPage{Error: "Failed to save " + uri + "."})
+		return
+	}
+	result := "Saved"
+	if saved {
+		result = "Already saved"
+	}
+	s.writeSavedPage(w, store(r), id, paramToken(r), result)
+}
+
+// quickTag answers the form of the page quickAdd shows, replacing the tags
+// of the bookmark.
+func (s *apiServer) quickTag(w http.ResponseWriter, r *http.Request) {
+	secret := paramToken(r)
+	r, status, message := s.authorize(r, secret, "write")
+	if status != 0 {
+		s.writeQuickAddPage(w, status, quickAddPage{Error: "Not saved: " + message + "."})
+		return
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		s.writeQuickAddPage(w, http.StatusBadRequest, quickAddPage{Error: "No such bookmark."})
+		return
+	}
+	tags := splitTags(r.FormValue("tags"))
+	err = s.edit(r, id, []string{"updated_at = ?"}, []any{time.Now().Unix()}, &tags)
+	if errors.Is(err, errBookmarkLocked) {
+		s.writeQuickAddPage(w, http.StatusConflict, quickAddPage{Error: "The bookmark is locked, unlock it to change its tags."})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to tag bookmark %d: %v", id, err)
+		s.writeQuickAddPage(w, http.StatusInternalServerError, quickAddPage{Error: "Failed to save the tags."})
+		return
+	}
+	s.writeSavedPage(w, store(r), id, secret, "Tags saved")
+}
+
+func (s *apiServer) writeSavedPage(w http.ResponseWriter, db *sql.DB, id int64, secret, message string) {
+	bookmarks, err := selectBookmarks(db, []string{strconv.FormatInt(id, 10)}, "")
+	if err != nil {
+		log.Printf("Failed to read bookmark %d: %v", id, err)
+	}
+	if len(bookmarks) == 0 {
+		s.writeQuickAddPage(w, http.StatusNotFound, quickAddPage{Error: "No such bookmark."})
+		return
+	}
+	b := bookmarks[0]
+	s.writeQuickAddPage(w, http.StatusOK, quickAddPage{
+		Message: message,
+		ID:      b.ID,
+		URL:     b.URI,
+		Title:   b.Title,
+		Tags:    strings.Join(b.Tags, ","),
+		Token:   secret,
+	})
+}
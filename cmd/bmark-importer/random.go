@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// randomCommand prints a random bookmark, or opens it with --open. Unlike
+// sample it keeps no record, so the same bookmark can come up again.
+func randomCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("random", flag.ExitOnError)
+	tag := fs.String("tag", "", "pick among bookmarks with these comma-separated tags")
+	domain := fs.String("domain", "", "pick among bookmarks on this domain or its subdomains")
+	unread := fs.Bool("unread", false, "pick among bookmarks not read yet")
+	all := fs.Bool("all", false, "pick among archived bookmarks too")
+	open := fs.Bool("open", false, "open the bookmark in the browser")
+	fs.Parse(args)
+
+	filter := bookmarkFilter{
+		Tags:         splitTags(*tag),
+		Domain:       strings.ToLower(strings.TrimSpace(*domain)),
+		Unread:       *unread,
+		HideArchived: !*all,
+		Sort:         "random",
+		Limit:        1,
+	}
+	var b *Bookmark
+	err := forEachBookmark(db, filter, func(pick Bookmark) error {
+		b = &pick
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to pick a bookmark: %v", err)
+	}
+	if b == nil {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+
+	if !*open {
+		fmt.Printf("%d\t%s\t%s\n", b.ID, strings.Join(strings.Fields(b.Title), " "), b.URI)
+		return
+	}
+	if err := openURL(b.URI); err != nil {
+		log.Fatalf("Failed to open %s: %v", b.URI, err)
+	}
+	if err := recordVisit(db, b.ID, false); err != nil {
+		log.Fatalf("Failed to record visit: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// chromeReadingEntry mirrors Chrome's ReadingListSpecifics as it appears
+// in JSON dumps of the reading list store. Times are in microseconds.
+type chromeReadingEntry struct {
+	URL            string `json:"url"`
+	Title          string `json:"title"`
+	Status         string `json:"status"`
+	CreationTimeUs int64  `json:"creation_time_us"`
+	UpdateTimeUs   int64  `json:"update_time_us"`
+}
+
+// parseChromeReadingList reads Chrome's reading list, which is kept apart
+// from its bookmarks. Two shapes are accepted: the Netscape HTML file
+// Takeout writes, which carries no read state, so new entries are added
+// as unread; and a JSON dump of the reading list store (an array, or an
+// object with an "entries" array), where READ entries are read and UNREAD
+// or UNSEEN ones are not. With JSON the read state of bookmarks imported
+// earlier is updated too, so importing the list again keeps bmark in step.
+func parseChromeReadingList(input io.Reader, jobs chan<- Job) error {
+	r := bufio.NewReader(input)
+	first, err := firstByte(r)
+	if err != nil {
+		return err
+	}
+
+	if first == '<' {
+		marked := make(chan Job)
+		done := make(chan error, 1)
+		go func() {
+			done <- parseNetscape(r, marked, htmlOptions{Folders: "ignore"})
+			close(marked)
+		}()
+		for job := range marked {
+			job.Unread = true
+			jobs <- job
+		}
+		return <-done
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var entries []chromeReadingEntry
+	if first == '{' {
+		var doc struct {
+			Entries []chromeReadingEntry `json:"entries"`
+		}
+		err = json.Unmarshal(data, &doc)
+		entries = doc.Entries
+	} else {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		return fmt.Errorf("not a Chrome reading list: %w", err)
+	}
+
+	now := time.Now().Unix()
+	for _, e := range entries {
+		uri := strings.TrimSpace(e.URL)
+		if uri == "" {
+			continue
+		}
+		createdAt := now
+		if e.CreationTimeUs > 0 {
+			createdAt = e.CreationTimeUs / 1e6
+		}
+		updatedAt := createdAt
+		if e.UpdateTimeUs > 0 {
+			updatedAt = e.UpdateTimeUs / 1e6
+		}
+		jobs <- Job{
+			URI:        uri,
+			Title:      strings.TrimSpace(e.Title),
+			CreatedAt:  createdAt,
+			UpdatedAt:  updatedAt,
+			Unread:     !strings.EqualFold(e.Status, "READ"),
+			SyncUnread: true,
+		}
+	}
+	return nil
+}
+
+// firstByte returns the first byte after any byte order mark and white
+// space without consuming it.
+func firstByte(r *bufio.Reader) (byte, error) {
+	if bom, _ := r.Peek(3); bytes.Equal(bom, []byte("\ufeff")) {
+		r.Discard(3)
+	}
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, fmt.Errorf("empty reading list: %w", err)
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		r.Discard(1)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const reportUsage = "Usage: importer-exporter report untagged | stale [--older-than 1y] [--never-visited] [--all] [--ids]"
+
+// reportCommand lists bookmarks that need attention: untagged ones, and
+// stale ones saved long ago and not opened since. --ids prints only their
+// IDs, one per line, for piping into bulk-edit or rm.
+func reportCommand(db *sql.DB, args []string) {
+	if len(args) < 1 {
+		fmt.Println(reportUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("report "+args[0], flag.ExitOnError)
+	olderThan := fs.String("older-than", "1y", "stale: saved and last opened longer ago than this, like 2y or 90d")
+	neverVisited := fs.Bool("never-visited", false, "stale: only bookmarks never opened with bmark open")
+	all := fs.Bool("all", false, "include archived bookmarks")
+	ids := fs.Bool("ids", false, "print only the IDs")
+	fs.Parse(args[1:])
+
+	filter := bookmarkFilter{HideArchived: !*all}
+	keep := func(Bookmark) bool { return true }
+	switch args[0] {
+	case "untagged":
+		filter.Untagged = true
+	case "stale":
+		age, err := parseAge(*olderThan)
+		if err != nil {
+			log.Fatalf("Invalid --older-than: %v", err)
+		}
+		cutoff := time.Now().Add(-age).Unix()
+		filter.Until = cutoff
+		keep = func(b Bookmark) bool {
+			if *neverVisited {
+				return b.Visits == 0 && b.LastVisit == 0
+			}
+			return b.LastVisit < cutoff
+		}
+	default:
+		fmt.Println(reportUsage)
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	count := 0
+	err := forEachBookmark(db, filter, func(b Bookmark) error {
+		if !keep(b) {
+			return nil
+		}
+		count++
+		if *ids {
+			_, err := fmt.Println(b.ID)
+			return err
+		}
+		title := strings.Join(strings.Fields(b.Title), " ")
+		if title == "" {
+			title = "-"
+		}
+		opened := "never opened"
+		if b.LastVisit > 0 {
+			opened = "opened " + time.Unix(b.LastVisit, 0).Format("2006-01-02")
+		}
+		_, err := fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", b.ID, time.Unix(b.CreatedAt, 0).Format("2006-01-02"),
+			opened, truncate(title, titleWidth), b.URI)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	tw.Flush()
+	if count == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to report.")
+		os.Exit(1)
+	}
+	if !*ids {
+		fmt.Fprintf(os.Stderr, "%d bookmark(s)\n", count)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// retagCommand adds and removes tags on every bookmark matching a query
+// or carrying a tag, in one transaction. Locked bookmarks are left alone
+// unless --force is given, and each changed bookmark gets a revision.
+func retagCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("retag", flag.ExitOnError)
+	query := fs.String("query", "", "boolean query picking the bookmarks, as for list -q")
+	fromTag := fs.String("from-tag", "", "pick the bookmarks with these comma-separated tags")
+	addTags := fs.String("add-tag", "", "comma-separated tags to add")
+	rmTags := fs.String("rm-tag", "", "comma-separated tags to remove")
+	dryRun := fs.Bool("dry-run", false, "only show which bookmarks would change")
+	force := fs.Bool("force", false, "retag locked bookmarks too")
+	fs.Parse(args)
+
+	add, remove := splitTags(*addTags), splitTags(*rmTags)
+	if *query == "" && *fromTag == "" || len(add) == 0 && len(remove) == 0 {
+		fmt.Println("Usage: importer-exporter retag --query QUERY | --from-tag TAGS [--add-tag TAGS] [--rm-tag TAGS] [--dry-run] [--force]")
+		os.Exit(1)
+	}
+	if *query != "" {
+		if _, err := compileQuery(*query); err != nil {
+			log.Fatalf("Invalid --query: %v", err)
+		}
+	}
+
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+	var changed []Bookmark
+	kept := 0
+	err = forEachBookmark(db, bookmarkFilter{Tags: splitTags(*fromTag), Query: *query}, func(b Bookmark) error {
+		if !retagChanges(b.Tags, add, remove) {
+			return nil
+		}
+		if locked[b.ID] && !*force {
+			kept++
+			return nil
+		}
+		changed = append(changed, b)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to find bookmarks: %v", err)
+	}
+	if kept > 0 {
+		fmt.Printf("Keeping %d locked bookmark(s), use --force to retag them too\n", kept)
+	}
+	if len(changed) == 0 {
+		fmt.Println("No bookmarks to retag.")
+		return
+	}
+	if *dryRun {
+		for _, b := range changed {
+			fmt.Printf("%d\t%s\n", b.ID, b.URI)
+		}
+		fmt.Printf("Would retag %d bookmark(s)\n", len(changed))
+		return
+	}
+
+	now := time.Now().Unix()
+	err = inTagTx(db, *force, func(tx *sql.Tx) error {
+		for _, b := range changed {
+			if err := saveRevision(tx, b.ID); err != nil {
+				return err
+			}
+			for _, tag := range remove {
+				_, err := tx.Exec(`DELETE FROM bookmark_tags WHERE bookmark_id = ?
+					AND tag_id IN (SELECT id FROM tags WHERE tag = ?)`, b.ID, tag)
+				if err != nil {
+					return fmt.Errorf("failed to remove tag %s from %s: %w", tag, b.URI, err)
+				}
+			}
+			if err := linkTags(tx, b.ID, add); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE bookmarks SET updated_at = ? WHERE id = ?", now, b.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to retag bookmarks: %v", err)
+	}
+	fmt.Printf("Retagged %d bookmark(s)\n", len(changed))
+}
+
+// retagChanges reports whether removing and then adding tags changes
+// the tags of a bookmark.
+func retagChanges(tags, add, remove []string) bool {
+	for _, tag := range remove {
+		if slices.Contains(tags, tag) && !slices.Contains(add, tag) {
+			return true
+		}
+	}
+	for _, tag := range add {
+		if !slices.Contains(tags, tag) {
+			return true
+		}
+	}
+	return false
+}
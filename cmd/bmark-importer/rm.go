@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// removeCommand moves bookmarks picked by ID, exact URL, tag or domain to
+// the trash, where they stay until trash empty deletes them for good.
+// Locked bookmarks are kept unless --force is given, and nothing is
+// removed before the list has been confirmed.
+func removeCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	tag := fs.String("tag", "", "remove bookmarks with these comma-separated tags")
+	domain := fs.String("domain", "", "remove bookmarks on this domain or its subdomains")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	force := fs.Bool("force", false, "remove locked bookmarks too")
+	fs.Parse(args)
+
+	filter := bookmarkFilter{
+		Tags:   splitTags(*tag),
+		Domain: strings.ToLower(strings.TrimSpace(*domain)),
+	}
+	hasFilter := len(filter.Tags) > 0 || filter.Domain != ""
+	if fs.NArg() == 0 && !hasFilter || fs.NArg() > 0 && hasFilter {
+		fmt.Println("Usage: importer-exporter rm [--yes] [--force] ID|URL... | --tag TAG | --domain DOMAIN")
+		os.Exit(1)
+	}
+
+	var matches []Bookmark
+	var err error
+	if hasFilter {
+		err = forEachBookmark(db, filter, func(b Bookmark) error {
+			matches = append(matches, b)
+			return nil
+		})
+	} else {
+		matches, err = selectBookmarks(db, fs.Args(), "")
+	}
+	if err != nil {
+		log.Fatalf("Failed to find bookmarks: %v", err)
+	}
+
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+	var remove []Bookmark
+	kept := 0
+	for _, b := range matches {
+		if locked[b.ID] && !*force {
+			kept++
+			continue
+		}
+		remove = append(remove, b)
+	}
+	if kept > 0 {
+		fmt.Printf("Keeping %d locked bookmark(s), use --force to remove them too\n", kept)
+	}
+	if len(remove) == 0 {
+		fmt.Println("No bookmarks to remove.")
+		os.Exit(1)
+	}
+
+	for _, b := range remove {
+		fmt.Printf("%d\t%s\n", b.ID, b.URI)
+	}
+	if !*yes && !confirm(fmt.Sprintf("Remove %d bookmark(s)?", len(remove))) {
+		fmt.Println("Nothing removed.")
+		os.Exit(1)
+	}
+
+	if err := trashBookmarks(db, remove, *force); err != nil {
+		log.Fatalf("Failed to remove bookmarks: %v", err)
+	}
+	fmt.Printf("Moved %d bookmark(s) to the trash, undo with: bmark trash restore ID\n", len(remove))
+}
+
+func lockedBookmarkIDs(db *sql.DB) (map[int64]bool, error) {
+	rows, err := db.Query("SELECT id FROM bookmarks WHERE locked = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// trashBookmarks moves bookmarks to the trash. Like deleting, this is
+// refused for locked bookmarks unless overrideLock is set.
+func trashBookmarks(db *sql.DB, bookmarks []Bookmark, overrideLock bool) error {
+	now := time.Now().Unix()
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if overrideLock {
+		if err := overrideLocks(tx); err != nil {
+			return err
+		}
+	}
+	for _, b := range bookmarks {
+		if _, err := tx.Exec("UPDATE bookmarks SET deleted_at = ? WHERE id = ?", now, b.ID); err != nil {
+			return fmt.Errorf("failed to trash %s: %w", b.URI, err)
+		}
+	}
+	if overrideLock {
+		if err := restoreLocks(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from
+// stdin. Anything but y or yes, including end of input, means no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s (y/N) ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Tag rules add tags to bookmarks whose URL matches a pattern, as they
+// are added or imported, and to saved bookmarks on request. A pattern is
+// a glob over the URL without its scheme and a leading "www.", so
+// github.com/* matches https://www.github.com/golang/go; "*" matches any
+// run of characters including "/", and "?" any one character. A pattern
+// with a scheme is matched against the whole URL. Case is ignored.
+
+const tagRulesSchema = `CREATE TABLE IF NOT EXISTS tag_rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	pattern TEXT NOT NULL,
+	tags TEXT NOT NULL
+);`
+
+const ruleUsage = "Usage: importer-exporter rule add PATTERN TAGS [--retroactive] | list | rm ID... | apply [--dry-run] [--force]"
+
+type tagRule struct {
+	ID      int64
+	Pattern string
+	Tags    []string
+}
+
+type tagRules []tagRule
+
+func loadTagRules(db *sql.DB) (tagRules, error) {
+	var rules tagRules
+	err := queryEach(db, "SELECT id, pattern, tags FROM tag_rules ORDER BY id", func(rows *sql.Rows) error {
+		var r tagRule
+		var tags string
+		if err := rows.Scan(&r.ID, &r.Pattern, &tags); err != nil {
+			return err
+		}
+		r.Tags = splitTags(tags)
+		rules = append(rules, r)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag rules: %w", err)
+	}
+	return rules, nil
+}
+
+func (r tagRule) matches(uri string) bool {
+	pattern, target := strings.ToLower(r.Pattern), strings.ToLower(uri)
+	if !strings.Contains(pattern, "://") {
+		if _, rest, ok := strings.Cut(target, "://"); ok {
+			target = rest
+		}
+		target = strings.TrimPrefix(target, "www.")
+	}
+	return globMatch(pattern, target)
+}
+
+// tagsFor returns the tags the rules give uri.
+func (rules tagRules) tagsFor(uri string) []string {
+	var tags []string
+	for _, r := range rules {
+		if r.matches(uri) {
+			for _, tag := range r.Tags {
+				if !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// apply adds the tags of the matching rules to a job.
+func (rules tagRules) apply(job Job) Job {
+	for _, tag := range rules.tagsFor(job.URI) {
+		if !slices.Contains(job.Tags, tag) {
+			job.Tags = append(job.Tags, tag)
+		}
+	}
+	return job
+}
+
+// globMatch reports whether s matches pattern, where "*" matches any
+// string and "?" any one byte.
+func globMatch(pattern, s string) bool {
+	p, i := 0, 0
+	star, mark := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// ruleCommand manages tag rules.
+func ruleCommand(db *sql.DB, args []string) {
+	if len(args) < 1 {
+		fmt.Println(ruleUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("rule "+args[0], flag.ExitOnError)
+	retroactive := fs.Bool("retroactive", false, "also tag the saved bookmarks the new rule matches")
+	dryRun := fs.Bool("dry-run", false, "only show which bookmarks would be tagged")
+	force := fs.Bool("force", false, "tag locked bookmarks too")
+	names := parseInterspersed(fs, args[1:])
+
+	switch args[0] {
+	case "add":
+		if len(names) != 2 || strings.TrimSpace(names[0]) == "" || len(splitTags(names[1])) == 0 {
+			fmt.Println(ruleUsage)
+			os.Exit(1)
+		}
+		rule := tagRule{Pattern: strings.TrimSpace(names[0]), Tags: splitTags(names[1])}
+		res, err := db.Exec("INSERT INTO tag_rules (pattern, tags) VALUES (?, ?)", rule.Pattern, strings.Join(rule.Tags, ","))
+		if err == nil {
+			rule.ID, err = res.LastInsertId()
+		}
+		if err != nil {
+			log.Fatalf("Failed to add rule: %v", err)
+		}
+		fmt.Printf("Added rule %d: %s -> %s\n", rule.ID, rule.Pattern, strings.Join(rule.Tags, ","))
+		if *retroactive {
+			applyTagRules(db, tagRules{rule}, *dryRun, *force)
+		}
+	case "list":
+		rules, err := loadTagRules(db)
+		if err != nil {
+			log.Fatalf("Failed to list rules: %v", err)
+		}
+		if len(rules) == 0 {
+			fmt.Fprintln(os.Stderr, "No rules found.")
+			os.Exit(1)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, r := range rules {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", r.ID, r.Pattern, strings.Join(r.Tags, ","))
+		}
+		tw.Flush()
+	case "rm":
+		if len(names) == 0 {
+			fmt.Println(ruleUsage)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			id, err := strconv.ParseInt(name, 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid rule ID %s", name)
+			}
+			res, err := db.Exec("DELETE FROM tag_rules WHERE id = ?", id)
+			if err != nil {
+				log.Fatalf("Failed to remove rule %d: %v", id, err)
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				fmt.Printf("No rule %d\n", id)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Removed %d rule(s)\n", len(names))
+	case "apply":
+		rules, err := loadTagRules(db)
+		if err != nil {
+			log.Fatalf("Failed to apply rules: %v", err)
+		}
+		if len(rules) == 0 {
+			fmt.Fprintln(os.Stderr, "No rules found.")
+			os.Exit(1)
+		}
+		applyTagRules(db, rules, *dryRun, *force)
+	default:
+		fmt.Printf("Unknown rule command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// applyTagRules adds the tags of rules to the saved bookmarks they match.
+// Like retag, it leaves locked bookmarks alone unless forced and records
+// a revision of each bookmark it changes.
+func applyTagRules(db *sql.DB, rules tagRules, dryRun, force bool) {
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+	type change struct {
+		bookmark Bookmark
+		tags     []string
+	}
+	var changes []change
+	kept := 0
+	err = forEachBookmark(db, bookmarkFilter{}, func(b Bookmark) error {
+		var missing []string
+		for _, tag := range rules.tagsFor(b.URI) {
+			if !slices.Contains(b.Tags, tag) {
+				missing = append(missing, tag)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		if locked[b.ID] && !force {
+			kept++
+			return nil
+		}
+		changes = append(changes, change{b, missing})
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to find bookmarks: %v", err)
+	}
+	if kept > 0 {
+		fmt.Printf("Keeping %d locked bookmark(s), use --force to tag them too\n", kept)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No bookmarks to tag.")
+		return
+	}
+	if dryRun {
+		for _, c := range changes {
+			fmt.Printf("%d\t%s\t+%s\n", c.bookmark.ID, c.bookmark.URI, strings.Join(c.tags, ",+"))
+		}
+		fmt.Printf("Would tag %d bookmark(s)\n", len(changes))
+		return
+	}
+
+	now := time.Now().Unix()
+	err = inTagTx(db, force, func(tx *sql.Tx) error {
+		for _, c := range changes {
+			if err := saveRevision(tx, c.bookmark.ID); err != nil {
+				return err
+			}
+			if err := linkTags(tx, c.bookmark.ID, c.tags); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE bookmarks SET updated_at = ? WHERE id = ?", now, c.bookmark.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to apply rules: %v", err)
+	}
+	fmt.Printf("Tagged %d bookmark(s)\n", len(changes))
+}
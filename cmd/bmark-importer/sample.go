@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+// samples records what "bmark sample" has already handed out, so weekly
+// link roundups do not repeat themselves.
+const samplesSchema = `CREATE TABLE IF NOT EXISTS samples (
+	bookmark_id INTEGER PRIMARY KEY NOT NULL,
+	sampled_at INTEGER NOT NULL,
+	FOREIGN KEY (bookmark_id) REFERENCES bookmarks(id) ON DELETE CASCADE
+);`
+
+// recentBiasHalfLife is the age at which a bookmark is half as likely to
+// be picked as one added today when --recent-bias is set.
+const recentBiasHalfLife = 30 * 24 * time.Hour
+
+// sampleBookmarks prints a random Markdown list of bookmarks that were not
+// sampled before and records them as sampled.
+func sampleBookmarks(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("sample", flag.ExitOnError)
+	tag := fs.String("tag", "", "only sample bookmarks with this tag")
+	n := fs.Int("n", 10, "number of bookmarks to pick")
+	recentBias := fs.Bool("recent-bias", false, "prefer recently added bookmarks")
+	fs.Parse(args)
+
+	sampled := make(map[int64]bool)
+	rows, err := db.Query("SELECT bookmark_id FROM samples")
+	if err != nil {
+		log.Fatalf("Failed to read previous samples: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatalf("Failed to read previous samples: %v", err)
+		}
+		sampled[id] = true
+	}
+	rows.Close()
+
+	// Weighted sampling without replacement (Efraimidis and Spirakis):
+	// every candidate gets the key u^(1/weight) and the largest keys win.
+	type candidate struct {
+		Bookmark
+		key float64
+	}
+	now := time.Now()
+	var candidates []candidate
+	err = forEachBookmark(db, bookmarkFilter{Tags: splitTags(*tag)}, func(b Bookmark) error {
+		if sampled[b.ID] {
+			return nil
+		}
+		weight := 1.0
+		if *recentBias {
+			age := now.Sub(time.Unix(b.CreatedAt, 0))
+			weight = math.Pow(0.5, max(age.Hours(), 0)/recentBiasHalfLife.Hours())
+		}
+		candidates = append(candidates, candidate{b, math.Pow(rand.Float64(), 1/weight)})
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(candidates) == 0 {
+		fmt.Println("No unsampled bookmarks left.")
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].key > candidates[j].key })
+	if len(candidates) > *n {
+		candidates = candidates[:*n]
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	for _, c := range candidates {
+		title := c.Title
+		if title == "" {
+			title = c.URI
+		}
+		line := fmt.Sprintf("- [%s](%s)", markdownEscaper.Replace(title), markdownURL(c.URI))
+		if c.Note != "" {
+			line += " — " + strings.Join(strings.Fields(c.Note), " ")
+		}
+		fmt.Println(line)
+
+		if _, err := tx.Exec("INSERT OR REPLACE INTO samples (bookmark_id, sampled_at) VALUES (?, ?)", c.ID, now.Unix()); err != nil {
+			log.Fatalf("Failed to record sample: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to record samples: %v", err)
+	}
+}
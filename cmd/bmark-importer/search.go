@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// The search index is an external-content FTS5 table over the bookmarks
+// table, kept in sync by triggers so that the shell script's writes are
+// indexed too. A second one covers the text of archived pages (see
+// pagetext.go). FTS5 is only compiled into go-sqlite3 with the
+// sqlite_fts5 build tag. A binary built without it drops the triggers,
+// because they would make every write fail; the next binary that has FTS5
+// recreates them and rebuilds the index.
+
+type ftsTrigger struct{ name, sql string }
+
+type ftsIndex struct {
+	name     string
+	schema   string
+	triggers []ftsTrigger
+}
+
+var searchIndexes = []ftsIndex{
+	{"bookmarks_fts", searchSchema, searchTriggers},
+	{"page_texts_fts", pageTextSearchSchema, pageTextSearchTriggers},
+}
+
+const searchSchema = `CREATE VIRTUAL TABLE IF NOT EXISTS bookmarks_fts USING fts5(
+	title, note, url,
+	content='bookmarks', content_rowid='id',
+	tokenize='unicode61 remove_diacritics 2'
+);`
+
+var searchTriggers = []ftsTrigger{
+	{"bookmarks_fts_insert", `CREATE TRIGGER IF NOT EXISTS bookmarks_fts_insert
+		AFTER INSERT ON bookmarks BEGIN
+		INSERT INTO bookmarks_fts (rowid, title, note, url) VALUES (NEW.id, NEW.title, NEW.note, NEW.url);
+		END;`},
+	{"bookmarks_fts_delete", `CREATE TRIGGER IF NOT EXISTS bookmarks_fts_delete
+		AFTER DELETE ON bookmarks BEGIN
+		INSERT INTO bookmarks_fts (bookmarks_fts, rowid, title, note, url) VALUES ('delete', OLD.id, OLD.title, OLD.note, OLD.url);
+		END;`},
+	{"bookmarks_fts_update", `CREATE TRIGGER IF NOT EXISTS bookmarks_fts_update
+		AFTER UPDATE OF title, note, url ON bookmarks BEGIN
+		INSERT INTO bookmarks_fts (bookmarks_fts, rowid, title, note, url) VALUES ('delete', OLD.id, OLD.title, OLD.note, OLD.url);
+		INSERT INTO bookmarks_fts (rowid, title, note, url) VALUES (NEW.id, NEW.title, NEW.note, NEW.url);
+		END;`},
+}
+
+// searchWeights rank title matches above note matches above URL matches.
+const searchWeights = "10.0, 4.0, 2.0"
+
+func searchAvailable(db *sql.DB) bool {
+	var used bool
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	return err == nil && used
+}
+
+func initializeSearch(db *sql.DB) error {
+	if !searchAvailable(db) {
+		for _, index := range searchIndexes {
+			for _, trigger := range index.triggers {
+				if _, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger.name); err != nil {
+					return fmt.Errorf("failed to drop trigger %s: %w", trigger.name, err)
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, index := range searchIndexes {
+		var missing int
+		err := db.QueryRow("SELECT ? - COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE ?",
+			len(index.triggers), index.name+"_%").Scan(&missing)
+		if err != nil {
+			return fmt.Errorf("failed to check search triggers: %w", err)
+		}
+		if missing == 0 {
+			continue
+		}
+
+		if _, err := db.Exec(index.schema); err != nil {
+			return fmt.Errorf("failed to create search index: %w", err)
+		}
+		for _, trigger := range index.triggers {
+			if _, err := db.Exec(trigger.sql); err != nil {
+				return fmt.Errorf("failed to create trigger %s: %w", trigger.name, err)
+			}
+		}
+		// New index, or one that missed writes while its triggers were gone.
+		if _, err := db.Exec("INSERT INTO " + index.name + " (" + index.name + ") VALUES ('rebuild')"); err != nil {
+			return fmt.Errorf("failed to rebuild search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// searchCommand ranks bookmarks by BM25 over their title, note and URL.
+// Words match as prefixes and must all be present; key:value terms such
+// as tag:go or -tag:old narrow the results like assert --query does.
+// With --content the words are looked up in the text of archived pages
+// rather than in the bookmarks themselves.
+func searchCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "show at most this many results")
+	all := fs.Bool("all", false, "search archived bookmarks too")
+	fuzzy := fs.Bool("fuzzy", false, "match titles loosely, forgiving typos and missing letters")
+	regex := fs.Bool("regex", false, "treat the words as an RE2 pattern for the URL, title and note")
+	content := fs.Bool("content", false, "search the text of archived pages (see archive-org index)")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || *fuzzy && *regex || *content && (*fuzzy || *regex) {
+		fmt.Println("Usage: importer-exporter search [--limit N] [--all] [--fuzzy|--regex|--content] WORD... [tag:TAG]")
+		os.Exit(1)
+	}
+	if !*fuzzy && !*regex && !searchAvailable(db) {
+		log.Fatalf("Full-text search needs bmark-importer built with: go build -tags sqlite_fts5")
+	}
+
+	words, terms := splitSearchArgs(fs.Args())
+	if *content && len(words) == 0 {
+		log.Fatalf("Searching page text needs at least one word")
+	}
+	filter, err := parseFilterQuery(strings.Join(terms, " "))
+	if err != nil {
+		log.Fatalf("Invalid query: %v", err)
+	}
+	filter.HideArchived = !*all
+
+	var results []Bookmark
+	switch {
+	case *fuzzy:
+		results, err = fuzzySearch(db, filter, words, *limit)
+	case *regex:
+		filter.Regex = strings.Join(words, " ")
+		if _, err := regexp.Compile(filter.Regex); err != nil {
+			log.Fatalf("Invalid pattern: %v", err)
+		}
+		filter.Limit = *limit
+		err = forEachBookmark(db, filter, func(b Bookmark) error {
+			results = append(results, b)
+			return nil
+		})
+	default:
+		filter.Match = ftsQuery(words)
+		filter.MatchContent = *content
+		filter.Limit = *limit
+		err = forEachBookmark(db, filter, func(b Bookmark) error {
+			results = append(results, b)
+			return nil
+		})
+	}
+	if err != nil {
+		log.Fatalf("Failed to search bookmarks: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, b := range results {
+		title := strings.Join(strings.Fields(b.Title), " ")
+		if title == "" {
+			title = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", b.ID, truncate(title, titleWidth), b.URI, strings.Join(b.Tags, ","))
+	}
+	tw.Flush()
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+}
+
+// splitSearchArgs separates the words to search for from key:value
+// filter terms.
+func splitSearchArgs(args []string) (words, terms []string) {
+	for _, arg := range args {
+		for _, field := range strings.Fields(arg) {
+			if key, _, ok := strings.Cut(field, ":"); ok && isFilterKey(key) {
+				terms = append(terms, field)
+			} else {
+				words = append(words, field)
+			}
+		}
+	}
+	return words, terms
+}
+
+// fuzzySearch scores the title of every bookmark passing filter, or its
+// URL when it has none, and returns the best matches first. It does not
+// need the search index.
+func fuzzySearch(db *sql.DB, filter bookmarkFilter, words []string, limit int) ([]Bookmark, error) {
+	type scored struct {
+		b     Bookmark
+		score int
+	}
+	var matches []scored
+	err := forEachBookmark(db, filter, func(b Bookmark) error {
+		text := b.Title
+		if strings.TrimSpace(text) == "" {
+			text = b.URI
+		}
+		if score, ok := fuzzyTitleScore(words, text); ok {
+			matches = append(matches, scored{b, score})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	var results []Bookmark
+	for _, m := range matches {
+		if limit > 0 && len(results) == limit {
+			break
+		}
+		results = append(results, m.b)
+	}
+	return results, nil
+}
+
+// patterns caches compiled REGEXP patterns; SQLite calls sqlRegexp once
+// per row with the same pattern.
+var patterns = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+// sqlRegexp implements the REGEXP operator with Go's RE2 syntax.
+func sqlRegexp(pattern, text string) (bool, error) {
+	patterns.Lock()
+	re, ok := patterns.compiled[pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			patterns.Unlock()
+			return false, err
+		}
+		patterns.compiled[pattern] = re
+	}
+	patterns.Unlock()
+	return re.MatchString(text), nil
+}
+
+func isFilterKey(key string) bool {
+	switch key {
+	case "tag", "-tag", "domain", "since", "until":
+		return true
+	}
+	return false
+}
+
+// ftsQuery turns words into an FTS5 query matching each of them as a
+// prefix. Words are quoted, so FTS5 operators and punctuation in them are
+// searched for literally.
+func ftsQuery(words []string) string {
+	var terms []string
+	for _, word := range words {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	if len(terms) == 0 {
+		// Only filter terms were given; every indexed bookmark matches.
+		return ""
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serve exposes the database over HTTP as a small JSON API, so scripts,
+// phones and browser extensions work on the same bookmarks as the command
+// line. Every request needs a token, sent as "Authorization: Bearer
+// TOKEN": the one given to serve, which may do anything, or one made with
+// "bmark token create", which may do what its scopes allow. Each change is
+// an operation of its own, so "bmark undo" takes back the last request.
+// Tokens of users work on the database of their user instead, see
+// users.go. The web front end at / is a page of its own that holds no
+// bookmarks; it asks for a token and then uses the API.
+
+// maxPageLimit bounds the limit parameter of list and search requests.
+const maxPageLimit = 500
+
+//go:embed ui/index.html
+var webUI []byte
+
+type apiServer struct {
+	// db is the database of the owner, which also holds the users and
+	// tokens.
+	db     *sql.DB
+	dbFile string
+	token  string
+	// owner is the name of the owner on public pages.
+	owner string
+	// mu serializes changes, which each open an operation.
+	mu sync.Mutex
+
+	usersMu sync.Mutex
+	userDBs map[int64]*sql.DB
+
+	// webhooks carries deliveries to sendWebhooks, so that a slow
+	// receiver does not hold up requests.
+	webhooks chan []webhookDelivery
+}
+
+// storeKey is the context key of the database a request works on.
+type storeKey struct{}
+
+func withStore(r *http.Request, db *sql.DB) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), storeKey{}, db))
+}
+
+// store returns the database of the user the request was authorized for.
+func store(r *http.Request) *sql.DB {
+	return r.Context().Value(storeKey{}).(*sql.DB)
+}
+
+// userDatabase returns the database of user id, opening it on first use.
+func (s *apiServer) userDatabase(id int64) (*sql.DB, error) {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+	if db, ok := s.userDBs[id]; ok {
+		return db, nil
+	}
+	var name string
+	if err := s.db.QueryRow("SELECT name FROM users WHERE id = ?", id).Scan(&name); err != nil {
+		return nil, fmt.Errorf("failed to read user %d: %w", id, err)
+	}
+	db, err := openDatabase(userDatabasePath(s.dbFile, name))
+	if err != nil {
+		return nil, err
+	}
+	s.userDBs[id] = db
+	return db, nil
+}
+
+func serveCommand(db *sql.DB, dbFile string, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "address to listen on")
+	owner := fs.String("owner", envOr("USER", "owner"), "your name in the address of your public pages, /u/NAME/")
+	token := fs.String("token", os.Getenv("BMARK_TOKEN"), "token with every scope; a random one is made when empty and no token was created ($BMARK_TOKEN)")
+	fs.Parse(args)
+
+	if id, err := userID(db, *owner); err != nil {
+		log.Fatalf("Failed to read users: %v", err)
+	} else if id != 0 {
+		log.Fatalf("There is a user named %s, pass another --owner", *owner)
+	}
+	tokens, err := loadTokens(db)
+	if err != nil {
+		log.Fatalf("Failed to read tokens: %v", err)
+	}
+	if *token == "" && len(tokens) == 0 {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("Failed to make a token: %v", err)
+		}
+		*token = hex.EncodeToString(buf)
+		fmt.Fprintf(os.Stderr, "Token: %s\n", *token)
+		// The fragment stays in the browser, so the token is not logged.
+		fmt.Fprintf(os.Stderr, "Web UI: http://%s/#token=%s\n", *listen, *token)
+	}
+	s := &apiServer{db: db, dbFile: dbFile, token: *token, owner: *owner, userDBs: make(map[int64]*sql.DB),
+		webhooks: make(chan []webhookDelivery, 100)}
+	go s.sendWebhooks()
+	fmt.Fprintf(os.Stderr, "Listening on http://%s\n", *listen)
+	if err := http.ListenAndServe(*listen, s.routes()); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /bookmarks", s.listBookmarks)
+	mux.HandleFunc("POST /bookmarks", s.createBookmark)
+	mux.HandleFunc("GET /bookmarks/{id}", s.getBookmark)
+	mux.HandleFunc("PATCH /bookmarks/{id}", s.updateBookmark)
+	mux.HandleFunc("DELETE /bookmarks/{id}", s.deleteBookmark)
+	mux.HandleFunc("GET /tags", s.listTags)
+	mux.HandleFunc("GET /search", s.search)
+	mux.HandleFunc("GET /public", s.listPublic)
+	mux.HandleFunc("PUT /public/bookmarks/{id}", s.setPublic)
+	mux.HandleFunc("DELETE /public/bookmarks/{id}", s.setPublic)
+	mux.HandleFunc("PUT /public/tags/{tag...}", s.setPublic)
+	mux.HandleFunc("DELETE /public/tags/{tag...}", s.setPublic)
+
+	root := http.NewServeMux()
+	root.HandleFunc("GET /{$}", serveWebUI)
+	root.HandleFunc("GET /add", s.quickAdd)
+	root.HandleFunc("POST /add", s.quickTag)
+	root.HandleFunc("GET /u/{user}/{$}", s.publicList(false))
+	root.HandleFunc("GET /u/{user}/t/{tag...}", s.publicList(false))
+	root.HandleFunc("GET /u/{user}/feed", s.publicList(true))
+	root.HandleFunc("GET /u/{user}/feed/t/{tag...}", s.publicList(true))
+	root.HandleFunc("GET /u/{user}/b/{id}", s.publicBookmark)
+	root.Handle("/", s.authenticate(mux))
+	return root
+}
+
+func serveWebUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; img-src *")
+	w.Write(webUI)
+}
+
+// authorize checks that secret is the token of the server, or a stored
+// token with scope, and returns the request with the database of the
+// token's user. When it is refused, it returns the status and message to
+// answer with instead.
+func (s *apiServer) authorize(r *http.Request, secret, scope string) (*http.Request, int, string) {
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.token)) == 1 {
+		return withStore(r, s.db), 0, ""
+	}
+	t, ok, err := lookupToken(s.db, secret)
+	if err != nil {
+		log.Printf("Failed to read token: %v", err)
+		return r, http.StatusInternalServerError, "failed to read token"
+	}
+	if !ok {
+		return r, http.StatusUnauthorized, "missing or wrong token"
+	}
+	if err := touchToken(s.db, t.ID); err != nil {
+		log.Printf("Failed to record use of token %s: %v", t.Name, err)
+	}
+	if !t.allows(scope) {
+		return r, http.StatusForbidden, fmt.Sprintf("token %s lacks the %s scope", t.Name, scope)
+	}
+	if t.UserID == 0 {
+		return withStore(r, s.db), 0, ""
+	}
+	db, err := s.userDatabase(t.UserID)
+	if err != nil {
+		log.Printf("Failed to open database of token %s: %v", t.Name, err)
+		return r, http.StatusInternalServerError, "failed to open database"
+	}
+	return withStore(r, db), 0, ""
+}
+
+// requestScope is the scope a request needs.
+func requestScope(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return "read"
+	}
+	return "write"
+}
+
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		r, status, message := s.authorize(r, secret, requestScope(r))
+		if status != 0 {
+			writeAPIError(w, status, message)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// change runs fn as an operation named after the request.
+func (s *apiServer) change(r *http.Request, fn func() error) error {
+	db := store(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := beginOperation(db, "serve "+r.Method+" "+r.URL.Path); err != nil {
+		return err
+	}
+	err := fn()
+	if endErr := endOperation(db); endErr != nil && err == nil {
+		err = endErr
+	}
+	if err == nil {
+		err = sealChangelog(db)
+	}
+	if deliveries, webhookErr := takeWebhookEvents(db); webhookErr != nil {
+		log.Printf("Failed to read webhook events: %v", webhookErr)
+	} else if len(deliveries) > 0 {
+		select {
+		case s.webhooks <- deliveries:
+		default:
+			log.Printf("Too many webhook deliveries waiting, dropped %d", len(deliveries))
+		}
+	}
+	return err
+}
+
+// sendWebhooks delivers webhook events in the order of the changes.
+func (s *apiServer) sendWebhooks() {
+	for deliveries := range s.webhooks {
+		sendDeliveries(deliveries)
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
+
+type bookmarkPage struct {
+	Bookmarks []jsonBookmark `json:"bookmarks"`
+	Total     int            `json:"total"`
+	Offset    int            `json:"offset"`
+	Limit     int            `json:"limit"`
+}
+
+// pageParams reads the limit and offset parameters of a list.
+func pageParams(r *http.Request) (bookmarkPage, error) {
+	page := bookmarkPage{Bookmarks: []jsonBookmark{}, Limit: 50}
+	var err error
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if page.Limit, err = strconv.Atoi(raw); err != nil || page.Limit < 0 {
+			return page, fmt.Errorf("invalid limit %q", raw)
+		}
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		if page.Offset, err = strconv.Atoi(raw); err != nil || page.Offset < 0 {
+			return page, fmt.Errorf("invalid offset %q", raw)
+		}
+	}
+	page.Limit = min(page.Limit, maxPageLimit)
+	return page, nil
+}
+
+// paginate cuts the page the limit and offset parameters ask for out of
+// bookmarks, for results ranked outside SQL.
+func paginate(r *http.Request, bookmarks []Bookmark) (bookmarkPage, error) {
+	page, err := pageParams(r)
+	if err != nil {
+		return page, err
+	}
+	page.Total = len(bookmarks)
+	start := min(page.Offset, len(bookmarks))
+	for _, b := range bookmarks[start : start+min(page.Limit, len(bookmarks)-start)] {
+		page.Bookmarks = append(page.Bookmarks, newJSONBookmark(b))
+	}
+	return page, nil
+}
+
+// listBookmarks answers GET /bookmarks. The parameters tag, domain and q
+// (a query as for list -q) filter, as do unread=1 and starred=1; archived
+// bookmarks are left out unless archived=1. sort takes the orders of
+// list --sort.
+func (s *apiServer) listBookmarks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := bookmarkFilter{
+		Tags:         splitTags(q.Get("tag")),
+		Domain:       strings.ToLower(strings.TrimSpace(q.Get("domain"))),
+		Query:        q.Get("q"),
+		Unread:       q.Get("unread") == "1",
+		Starred:      q.Get("starred") == "1",
+		HideArchived: q.Get("archived") != "1",
+		Sort:         q.Get("sort"),
+	}
+	if _, ok := bookmarkOrders[filter.Sort]; !ok || filter.Sort == "rank" {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("unknown sort order %q", filter.Sort))
+		return
+	}
+	if filter.Query != "" {
+		if _, err := compileQuery(filter.Query); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	s.writeBookmarks(w, r, filter)
+}
+
+// writeBookmarks answers with the page of bookmarks matching filter,
+// leaving the paging to SQL.
+func (s *apiServer) writeBookmarks(w http.ResponseWriter, r *http.Request, filter bookmarkFilter) {
+	page, err := pageParams(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if page.Total, err = countBookmarks(store(r), filter); err == nil && page.Limit > 0 {
+		filter.Limit, filter.Offset = page.Limit, page.Offset
+		err = forEachBookmark(store(r), filter, func(b Bookmark) error {
+			page.Bookmarks = append(page.Bookmarks, newJSONBookmark(b))
+			return nil
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to read bookmarks: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to read bookmarks")
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, page)
+}
+
+func writeBookmarkPage(w http.ResponseWriter, r *http.Request, bookmarks []Bookmark) {
+	page, err := paginate(r, bookmarks)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, page)
+}
+
+// search answers GET /search?q=WORDS like the search command: ranked by
+// the search index when there is one, by fuzzy title matching otherwise.
+// unread=1, starred=1 and archived=1 work as for GET /bookmarks.
+func (s *apiServer) search(w http.ResponseWriter, r *http.Request) {
+	words, terms := splitSearchArgs([]string{r.URL.Query().Get("q")})
+	if len(words) == 0 && len(terms) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "missing q")
+		return
+	}
+	filter, err := parseFilterQuery(strings.Join(terms, " "))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Unread = r.URL.Query().Get("unread") == "1"
+	filter.Starred = r.URL.Query().Get("starred") == "1"
+	filter.HideArchived = r.URL.Query().Get("archived") != "1"
+
+	if searchAvailable(store(r)) {
+		filter.Match = ftsQuery(words)
+		s.writeBookmarks(w, r, filter)
+		return
+	}
+	bookmarks, err := fuzzySearch(store(r), filter, words, 0)
+	if err != nil {
+		log.Printf("Failed to search bookmarks: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to search bookmarks")
+		return
+	}
+	writeBookmarkPage(w, r, bookmarks)
+}
+
+// lookup returns the bookmark named by the id path value, or writes a
+// 404 and returns nil.
+func (s *apiServer) lookup(w http.ResponseWriter, r *http.Request) *Bookmark {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "no such bookmark")
+		return nil
+	}
+	bookmarks, err := selectBookmarks(store(r), []string{strconv.FormatInt(id, 10)}, "")
+	if err != nil {
+		log.Printf("Failed to read bookmark %d: %v", id, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to read bookmark")
+		return nil
+	}
+	if len(bookmarks) == 0 {
+		writeAPIError(w, http.StatusNotFound, "no such bookmark")
+		return nil
+	}
+	return &bookmarks[0]
+}
+
+func (s *apiServer) getBookmark(w http.ResponseWriter, r *http.Request) {
+	if b := s.lookup(w, r); b != nil {
+		writeAPIJSON(w, http.StatusOK, newJSONBookmark(*b))
+	}
+}
+
+// bookmarkInput is the body of POST and PATCH requests. Fields left out
+// of a PATCH keep their value; tags given replace all tags.
+type bookmarkInput struct {
+	URL      *string   `json:"url"`
+	Title    *string   `json:"title"`
+	Note     *string   `json:"note"`
+	Tags     *[]string `json:"tags"`
+	Unread   *bool     `json:"unread"`
+	Starred  *bool     `json:"starred"`
+	Private  *bool     `json:"private"`
+	Archived *bool     `json:"archived"`
+}
+
+func decodeBookmarkInput(w http.ResponseWriter, r *http.Request) (bookmarkInput, bool) {
+	var in bookmarkInput
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return in, false
+	}
+	return in, true
+}
+
+// createBookmark answers POST /bookmarks. Like add, it titles a bookmark
+// without a title from its page; a URL that is already saved gets a 409
+// with the ID of the saved bookmark.
+func (s *apiServer) createBookmark(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeBookmarkInput(w, r)
+	if !ok {
+		return
+	}
+	if in.URL == nil || strings.TrimSpace(*in.URL) == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing url")
+		return
+	}
+	now := time.Now().Unix()
+	job := Job{URI: strings.TrimSpace(*in.URL), CreatedAt: now, UpdatedAt: now}
+	if in.Title != nil {
+		job.Title = *in.Title
+	}
+	if in.Note != nil {
+		job.Note = *in.Note
+	}
+	if in.Tags != nil {
+		job.Tags = splitTags(strings.Join(*in.Tags, ","))
+	}
+	job.Unread = in.Unread != nil && *in.Unread
+	job.Starred = in.Starred != nil && *in.Starred
+	job.Private = in.Private != nil && *in.Private
+
+	var id int64
+	var saved bool
+	err := s.change(r, func() error {
+		var err error
+		id, saved, err = addBookmark(store(r), job, true)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to add %s: %v", job.URI, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to add bookmark")
+		return
+	}
+	if saved {
+		writeAPIJSON(w, http.StatusConflict, map[string]any{"error": "already bookmarked", "id": id})
+		return
+	}
+	r.SetPathValue("id", strconv.FormatInt(id, 10))
+	if b := s.lookup(w, r); b != nil {
+		w.Header().Set("Location", fmt.Sprintf("/bookmarks/%d", id))
+		writeAPIJSON(w, http.StatusCreated, newJSONBookmark(*b))
+	}
+}
+
+var errBookmarkLocked = errors.New("bookmark is locked")
+
+// updateBookmark answers PATCH /bookmarks/{id}. Locked bookmarks are
+// refused with a 409.
+func (s *apiServer) updateBookmark(w http.ResponseWriter, r *http.Request) {
+	b := s.lookup(w, r)
+	if b == nil {
+		return
+	}
+	in, ok := decodeBookmarkInput(w, r)
+	if !ok {
+		return
+	}
+	if in.URL != nil && strings.TrimSpace(*in.URL) == "" {
+		writeAPIError(w, http.StatusBadRequest, "url cannot be empty")
+		return
+	}
+
+	columns := []string{"updated_at = ?"}
+	values := []any{time.Now().Unix()}
+	for _, c := range []struct {
+		column string
+		value  *string
+	}{{"url", in.URL}, {"title", in.Title}, {"note", in.Note}} {
+		if c.value != nil {
+			columns = append(columns, c.column+" = ?")
+			values = append(values, strings.TrimSpace(*c.value))
+		}
+	}
+	for _, c := range []struct {
+		column string
+		value  *bool
+	}{{"unread", in.Unread}, {"starred", in.Starred}, {"private", in.Private}, {"archived", in.Archived}} {
+		if c.value != nil {
+			columns = append(columns, c.column+" = ?")
+			values = append(values, *c.value)
+		}
+	}
+
+	err := s.edit(r, b.ID, columns, values, in.Tags)
+	switch {
+	case errors.Is(err, errBookmarkLocked):
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil && strings.Contains(err.Error(), "UNIQUE"):
+		writeAPIError(w, http.StatusConflict, "url is already bookmarked")
+		return
+	case err != nil:
+		log.Printf("Failed to update bookmark %d: %v", b.ID, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to update bookmark")
+		return
+	}
+	if b := s.lookup(w, r); b != nil {
+		writeAPIJSON(w, http.StatusOK, newJSONBookmark(*b))
+	}
+}
+
+// edit sets columns to values and, unless tags is nil, replaces the tags
+// of bookmark id, as one operation. Locked bookmarks are refused with
+// errBookmarkLocked.
+func (s *apiServer) edit(r *http.Request, id int64, columns []string, values []any, tags *[]string) error {
+	return s.change(r, func() error {
+		locked, err := lockedBookmarkIDs(store(r))
+		if err != nil {
+			return err
+		}
+		if locked[id] {
+			return errBookmarkLocked
+		}
+		return inTagTx(store(r), false, func(tx *sql.Tx) error {
+			if err := saveRevision(tx, id); err != nil {
+				return err
+			}
+			_, err := tx.Exec("UPDATE bookmarks SET "+strings.Join(columns, ", ")+" WHERE id = ?", append(values, id)...)
+			if err != nil {
+				return err
+			}
+			if tags == nil {
+				return nil
+			}
+			if _, err := tx.Exec("DELETE FROM bookmark_tags WHERE bookmark_id = ?", id); err != nil {
+				return err
+			}
+			return linkTags(tx, id, splitTags(strings.Join(*tags, ",")))
+		})
+	})
+}
+
+// deleteBookmark answers DELETE /bookmarks/{id} by moving the bookmark to
+// the trash, as rm does.
+func (s *apiServer) deleteBookmark(w http.ResponseWriter, r *http.Request) {
+	b := s.lookup(w, r)
+	if b == nil {
+		return
+	}
+	err := s.change(r, func() error {
+		locked, err := lockedBookmarkIDs(store(r))
+		if err != nil {
+			return err
+		}
+		if locked[b.ID] {
+			return errBookmarkLocked
+		}
+		return trashBookmarks(store(r), []Bookmark{*b}, false)
+	})
+	switch {
+	case errors.Is(err, errBookmarkLocked):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		log.Printf("Failed to trash bookmark %d: %v", b.ID, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to delete bookmark")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// listTags answers GET /tags with every tag in use and its bookmark
+// count, most used first.
+func (s *apiServer) listTags(w http.ResponseWriter, r *http.Request) {
+	tags := []tagCount{}
+	err := queryEach(store(r), `SELECT t.tag, COUNT(*) FROM tags t
+		JOIN bookmark_tags bt ON bt.tag_id = t.id
+		JOIN bookmarks b ON b.id = bt.bookmark_id AND b.deleted_at IS NULL
+		GROUP BY t.tag ORDER BY COUNT(*) DESC, t.tag`, func(rows *sql.Rows) error {
+		var t tagCount
+		err := rows.Scan(&t.Tag, &t.Count)
+		tags = append(tags, t)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to read tags: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to read tags")
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// shortenerHosts are link shorteners whose redirects are followed by
+// --expand. The short link is kept as the "shortlink.url" metadata of the
+// bookmark saved under the final URL.
+var shortenerHosts = map[string]bool{
+	"t.co":        true,
+	"bit.ly":      true,
+	"goo.gl":      true,
+	"tinyurl.com": true,
+	"ow.ly":       true,
+	"buff.ly":     true,
+	"is.gd":       true,
+	"lnkd.in":     true,
+	"rebrand.ly":  true,
+}
+
+func isShortlink(uri string) bool {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return false
+	}
+	return shortenerHosts[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")]
+}
+
+// expandShortlink follows the redirects of a short link and returns where
+// they end. Shorteners that refuse HEAD requests are asked with GET.
+func expandShortlink(client *http.Client, uri string) (string, error) {
+	resp, err := client.Head(uri)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = client.Get(uri)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("%s answered %s", uri, resp.Status)
+	}
+	final := resp.Request.URL
+	if isShortlink(final.String()) {
+		return "", fmt.Errorf("%s does not redirect anywhere", uri)
+	}
+	return final.String(), nil
+}
+
+// expandJob replaces the URL of a job pointing at a shortener with the
+// final one. When that fails the short link is imported as it is.
+func expandJob(client *http.Client, job Job) Job {
+	if !isShortlink(job.URI) {
+		return job
+	}
+	final, err := expandShortlink(client, job.URI)
+	if err != nil {
+		log.Printf("Keeping short link %s: %v", job.URI, err)
+		return job
+	}
+	job.ShortURL, job.URI = job.URI, final
+	return job
+}
+
+// expandShortlinks wraps a parser so that jobs reach the workers with
+// their short links expanded.
+func expandShortlinks(parse func(jobs chan<- Job) error) func(jobs chan<- Job) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	return func(out chan<- Job) error {
+		jobs := make(chan Job, 100)
+		var parseErr error
+		go func() {
+			parseErr = parse(jobs)
+			close(jobs)
+		}()
+		for job := range jobs {
+			out <- expandJob(client, job)
+		}
+		return parseErr
+	}
+}
+
+func storeShortURL(tx *sql.Tx, bookmarkID int64, shortURL string) error {
+	if shortURL == "" {
+		return nil
+	}
+	_, err := tx.Exec("INSERT OR REPLACE INTO metadata (bookmark_id, key, value, source, fetched_at) VALUES (?, 'shortlink.url', ?, 'shortlink', ?)",
+		bookmarkID, shortURL, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to store short link %s: %w", shortURL, err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+type siteTag struct {
+	Name  string
+	File  string
+	Count int
+}
+
+type sitePage struct {
+	Title     string
+	Root      string
+	Tags      []siteTag
+	Bookmarks []Bookmark
+	TagFiles  map[string]string
+	Search    bool
+}
+
+// exportSite renders a small static site into dir: an index of every
+// bookmark, one page per tag, a JSON index for client-side search and a
+// stylesheet that follows the system dark mode.
+func exportSite(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("export site", flag.ExitOnError)
+	title := fs.String("title", "Bookmarks", "site title")
+	includeNotes := fs.Bool("include-notes", false, "show notes on the site")
+	includePrivate := fs.Bool("include-private", false, "publish private bookmarks too")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Println("Usage: importer-exporter export site [--title TITLE] DIR")
+		os.Exit(1)
+	}
+	dir := fs.Arg(0)
+
+	var bookmarks []Bookmark
+	byTag := make(map[string][]Bookmark)
+	err := forEachBookmark(db, bookmarkFilter{NewestFirst: true, Public: !*includePrivate, WithoutNotes: !*includeNotes}, func(b Bookmark) error {
+		bookmarks = append(bookmarks, b)
+		for _, tag := range b.Tags {
+			byTag[tag] = append(byTag[tag], b)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(bookmarks) == 0 {
+		fmt.Println("No bookmarks found in database.")
+		return
+	}
+
+	tags := siteTags(byTag)
+	tagFiles := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		tagFiles[tag.Name] = tag.File
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "tags"), 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", dir, err)
+	}
+
+	files := map[string]sitePage{
+		"index.html": {Title: *title, Tags: tags, Bookmarks: bookmarks, TagFiles: tagFiles, Search: true},
+	}
+	for _, tag := range tags {
+		files[filepath.Join("tags", tag.File)] = sitePage{
+			Title:     *title + " — " + tag.Name,
+			Root:      "../",
+			Bookmarks: byTag[tag.Name],
+			TagFiles:  tagFiles,
+		}
+	}
+	for name, page := range files {
+		if err := writeSitePage(filepath.Join(dir, name), page); err != nil {
+			log.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := writeSiteIndex(filepath.Join(dir, "index.json"), bookmarks, tagFiles); err != nil {
+		log.Fatalf("Failed to write search index: %v", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "style.css"), []byte(webappStyle), false); err != nil {
+		log.Fatalf("Failed to write stylesheet: %v", err)
+	}
+
+	fmt.Printf("Exported %d bookmarks and %d tag pages to: %s\n", len(bookmarks), len(tags), dir)
+}
+
+// siteTags orders tags by name and gives each page a file name.
+func siteTags(byTag map[string][]Bookmark) []siteTag {
+	var tags []siteTag
+	var names []string
+	for name, bookmarks := range byTag {
+		tags = append(tags, siteTag{Name: name, Count: len(bookmarks)})
+		names = append(names, name)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+	files := tagFileNames(names)
+	for i := range tags {
+		tags[i].File = files[tags[i].Name] + ".html"
+	}
+	return tags
+}
+
+// tagFileNames gives each tag a file name without extension that is safe
+// on any file system. Tags that only differ in punctuation or case get a
+// numeric suffix, assigned in name order so the result is stable.
+func tagFileNames(tags []string) map[string]string {
+	sorted := append([]string{}, tags...)
+	sort.Strings(sorted)
+
+	files := make(map[string]string, len(sorted))
+	used := make(map[string]bool)
+	for _, tag := range sorted {
+		slug := strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(tag), "-"), "-")
+		if slug == "" {
+			slug = "tag"
+		}
+		file := slug
+		for n := 2; used[file]; n++ {
+			file = slug + "-" + strconv.Itoa(n)
+		}
+		used[file] = true
+		files[tag] = file
+	}
+	return files
+}
+
+func writeSitePage(path string, page sitePage) error {
+	file, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	if err := siteTemplate.Execute(file, page); err != nil {
+		return err
+	}
+	return file.Commit(false)
+}
+
+// writeSiteIndex writes the search index read by the index page. Tag
+// names are mapped to their page so results can link to them.
+func writeSiteIndex(path string, bookmarks []Bookmark, tagFiles map[string]string) error {
+	entries := make([]jsonBookmark, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		entries = append(entries, newJSONBookmark(b))
+	}
+	data, err := json.Marshal(struct {
+		Tags      map[string]string `json:"tags"`
+		Bookmarks []jsonBookmark    `json:"bookmarks"`
+	}{tagFiles, entries})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, false)
+}
+
+var siteTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.Root}}style.css">
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Root}}<p><a href="{{.Root}}index.html">← All bookmarks</a></p>{{end}}
+{{- if .Search}}
+<input type="search" id="q" placeholder="Search titles, URLs, notes and tags">
+{{- end}}
+{{- if .Tags}}
+<p class="meta">{{range .Tags}}<a class="tag" href="tags/{{.File}}">#{{.Name}} ({{.Count}})</a> {{end}}</p>
+{{- end}}
+<ul class="bookmarks" id="list">
+{{- range .Bookmarks}}
+<li><a href="{{.URI}}">{{if .Title}}{{.Title}}{{else}}{{.URI}}{{end}}</a>
+<div class="url">{{.URI}}</div>
+{{- if .Note}}
+<div class="note">{{.Note}}</div>
+{{- end}}
+<div class="meta">{{range .Tags}}<a class="tag" href="{{$.Root}}tags/{{index $.TagFiles .}}">#{{.}}</a>{{end}}</div></li>
+{{- end}}
+</ul>
+{{- if .Search}}
+<script>
+const q = document.getElementById("q");
+const list = document.getElementById("list");
+let index;
+
+function el(tag, cls, text) {
+  const e = document.createElement(tag);
+  if (cls) e.className = cls;
+  if (text) e.textContent = text;
+  return e;
+}
+
+async function search() {
+  index = index || await (await fetch("index.json")).json();
+  const terms = q.value.toLowerCase().split(/\s+/).filter(Boolean);
+  const shown = index.bookmarks.filter(b => {
+    const hay = [b.title, b.url, b.note, ...b.tags].join(" ").toLowerCase();
+    return terms.every(t => hay.includes(t));
+  });
+  list.replaceChildren(...shown.map(b => {
+    const li = el("li");
+    const a = el("a", "", b.title || b.url);
+    a.href = b.url;
+    li.append(a, el("div", "url", b.url));
+    if (b.note) li.append(el("div", "note", b.note));
+    const meta = el("div", "meta");
+    for (const tag of b.tags) {
+      const t = el("a", "tag", "#" + tag);
+      t.href = "tags/" + index.tags[tag];
+      meta.append(t);
+    }
+    li.append(meta);
+    return li;
+  }));
+}
+
+q.addEventListener("input", search);
+</script>
+{{- end}}
+</body>
+</html>
+`))
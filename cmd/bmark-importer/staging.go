@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// importSource is one input of a multi-source import: a file, a browser
+// profile or another bookmark manager.
+type importSource struct {
+	Name string
+	Path string
+	Read func() ([]Job, error)
+}
+
+// sourceStats describes how one source overlaps with the others and with
+// the database, counted by urlKey.
+type sourceStats struct {
+	Total      int
+	Repeated   int // more than once in this source
+	Shared     int // also in another source of the same run
+	Existing   int // already in the database
+	Contribute int // bookmarks only this source brings in
+}
+
+// readSources reads all sources at once. Each reader has its own file or
+// connection, so they do not contend with each other or the database.
+func readSources(sources []importSource) ([][]Job, []error) {
+	jobs := make([][]Job, len(sources))
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jobs[i], errs[i] = source.Read()
+		}()
+	}
+	wg.Wait()
+	return jobs, errs
+}
+
+// collectJobs runs parse to completion and returns everything it produced,
+// so a file can be staged with the other sources before anything is
+// written.
+func collectJobs(parse func(jobs chan<- Job) error) ([]Job, error) {
+	out := make(chan Job, 100)
+	var err error
+	go func() {
+		err = parse(out)
+		close(out)
+	}()
+
+	var jobs []Job
+	for job := range out {
+		jobs = append(jobs, job)
+	}
+	return jobs, err
+}
+
+// importStaged merges the staged bookmarks of several sources, prints how
+// they overlap and imports the result. Bookmarks matching one already in
+// the database by urlKey are folded into it instead of adding a variant
+// of the same URL.
+func importStaged(db *sql.DB, names []string, staged [][]Job) {
+	existing, err := existingURLKeys(db)
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+
+	merged, stats := mergeJobs(staged, existing)
+	for i, name := range names {
+		s := stats[i]
+		fmt.Printf("%s: %d bookmarks, %d repeated, %d shared with other sources, %d already saved, %d only here\n",
+			name, s.Total, s.Repeated, s.Shared, s.Existing, s.Contribute)
+	}
+
+	runImport(db, func(out chan<- Job) error {
+		for _, job := range merged {
+			out <- job
+		}
+		return nil
+	})
+}
+
+// mergeJobs joins bookmarks that share a urlKey: tags are combined, the
+// oldest creation time wins and the first non-empty title, note and
+// keyword are kept. The URL of a matching database bookmark, or else of
+// the first occurrence, is the one imported. Merged jobs keep the order in
+// which they first appeared.
+func mergeJobs(sources [][]Job, existing map[string]string) ([]Job, []sourceStats) {
+	seenIn := make(map[string]map[int]bool)
+	for i, jobs := range sources {
+		for _, job := range jobs {
+			key := urlKey(job.URI)
+			if seenIn[key] == nil {
+				seenIn[key] = make(map[int]bool)
+			}
+			seenIn[key][i] = true
+		}
+	}
+
+	stats := make([]sourceStats, len(sources))
+	var merged []Job
+	index := make(map[string]int)
+	for i, jobs := range sources {
+		local := make(map[string]bool)
+		for _, job := range jobs {
+			key := urlKey(job.URI)
+			s := &stats[i]
+			s.Total++
+			if local[key] {
+				s.Repeated++
+			} else {
+				local[key] = true
+				_, saved := existing[key]
+				switch {
+				case saved:
+					s.Existing++
+				case len(seenIn[key]) > 1:
+					s.Shared++
+				default:
+					s.Contribute++
+				}
+			}
+
+			n, ok := index[key]
+			if !ok {
+				if uri, saved := existing[key]; saved {
+					job.URI = uri
+				}
+				index[key] = len(merged)
+				merged = append(merged, job)
+				continue
+			}
+			m := &merged[n]
+			m.Tags = append(m.Tags, job.Tags...)
+			if job.CreatedAt > 0 && (m.CreatedAt == 0 || job.CreatedAt < m.CreatedAt) {
+				m.CreatedAt = job.CreatedAt
+			}
+			m.UpdatedAt = max(m.UpdatedAt, job.UpdatedAt)
+			if m.Title == "" {
+				m.Title = job.Title
+			}
+			if m.Note == "" {
+				m.Note = job.Note
+			}
+			if m.Keyword == "" {
+				m.Keyword = job.Keyword
+			}
+			if m.Folder == nil {
+				m.Folder = job.Folder
+			}
+		}
+	}
+	return merged, stats
+}
+
+// existingURLKeys maps the urlKey of every saved bookmark to its URL.
+func existingURLKeys(db *sql.DB) (map[string]string, error) {
+	keys := make(map[string]string)
+	err := queryEach(db, "SELECT url FROM bookmarks WHERE deleted_at IS NULL", func(rows *sql.Rows) error {
+		var uri string
+		if err := rows.Scan(&uri); err != nil {
+			return err
+		}
+		keys[urlKey(uri)] = uri
+		return nil
+	})
+	return keys, err
+}
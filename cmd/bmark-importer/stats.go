@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+type statsCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type bookmarkStats struct {
+	Bookmarks     int          `json:"bookmarks"`
+	Unread        int          `json:"unread"`
+	Archived      int          `json:"archived"`
+	Starred       int          `json:"starred"`
+	Private       int          `json:"private"`
+	Untagged      int          `json:"untagged"`
+	Trashed       int          `json:"trashed"`
+	Tags          int          `json:"tags"`
+	DatabaseBytes int64        `json:"database_bytes"`
+	TopTags       []statsCount `json:"top_tags"`
+	TopDomains    []statsCount `json:"top_domains"`
+	PerMonth      []statsCount `json:"added_per_month"`
+}
+
+// statsCommand summarizes the collection. Trashed bookmarks are only
+// counted in Trashed.
+func statsCommand(db *sql.DB, dbFile string, args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	limit := fs.Int("limit", 10, "number of tags and domains to show")
+	months := fs.Int("months", 12, "number of months of additions to show")
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	fs.Parse(args)
+
+	stats, err := collectStats(db, *limit, *months)
+	if err != nil {
+		log.Fatalf("Failed to collect statistics: %v", err)
+	}
+	stats.DatabaseBytes = fileSize(dbFile) + fileSize(dbFile+"-wal")
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			log.Fatalf("Failed to write statistics: %v", err)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range []struct {
+		name  string
+		value any
+	}{
+		{"Bookmarks", stats.Bookmarks},
+		{"  unread", stats.Unread},
+		{"  archived", stats.Archived},
+		{"  starred", stats.Starred},
+		{"  private", stats.Private},
+		{"  untagged", stats.Untagged},
+		{"In the trash", stats.Trashed},
+		{"Tags", stats.Tags},
+		{"Database", formatBytes(stats.DatabaseBytes)},
+	} {
+		fmt.Fprintf(tw, "%s\t%v\n", row.name, row.value)
+	}
+	tw.Flush()
+	for _, section := range []struct {
+		title  string
+		counts []statsCount
+	}{
+		{"Top tags", stats.TopTags},
+		{"Top domains", stats.TopDomains},
+		{"Added per month", stats.PerMonth},
+	} {
+		if len(section.counts) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", section.title)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range section.counts {
+			fmt.Fprintf(tw, "  %s\t%d\n", c.Name, c.Count)
+		}
+		tw.Flush()
+	}
+}
+
+func collectStats(db *sql.DB, limit, months int) (bookmarkStats, error) {
+	var s bookmarkStats
+	err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(unread), 0), COALESCE(SUM(archived), 0),
+		COALESCE(SUM(starred), 0), COALESCE(SUM(private), 0),
+		COALESCE(SUM(NOT EXISTS (SELECT 1 FROM bookmark_tags bt WHERE bt.bookmark_id = b.id)), 0)
+		FROM bookmarks b WHERE deleted_at IS NULL`).
+		Scan(&s.Bookmarks, &s.Unread, &s.Archived, &s.Starred, &s.Private, &s.Untagged)
+	if err != nil {
+		return s, err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM bookmarks WHERE deleted_at IS NOT NULL").Scan(&s.Trashed); err != nil {
+		return s, err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM tags").Scan(&s.Tags); err != nil {
+		return s, err
+	}
+
+	counts := func(query string, args ...any) ([]statsCount, error) {
+		var result []statsCount
+		err := queryEach(db, query, func(rows *sql.Rows) error {
+			var c statsCount
+			err := rows.Scan(&c.Name, &c.Count)
+			result = append(result, c)
+			return err
+		}, args...)
+		return result, err
+	}
+	if s.TopTags, err = counts(`SELECT t.tag, COUNT(*) AS n FROM bookmark_tags bt
+		JOIN tags t ON t.id = bt.tag_id JOIN bookmarks b ON b.id = bt.bookmark_id
+		WHERE b.deleted_at IS NULL GROUP BY t.id ORDER BY n DESC, t.tag LIMIT ?`, limit); err != nil {
+		return s, err
+	}
+	if s.TopDomains, err = counts(`SELECT url_host(url) AS host, COUNT(*) AS n FROM bookmarks
+		WHERE deleted_at IS NULL AND host != '' GROUP BY host ORDER BY n DESC, host LIMIT ?`, limit); err != nil {
+		return s, err
+	}
+	// The newest months are picked, then shown oldest first.
+	s.PerMonth, err = counts(`SELECT month, n FROM (
+		SELECT strftime('%Y-%m', created_at, 'unixepoch', 'localtime') AS month, COUNT(*) AS n
+		FROM bookmarks WHERE deleted_at IS NULL GROUP BY month ORDER BY month DESC LIMIT ?)
+		ORDER BY month`, months)
+	return s, err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// statusCommand sets a status column such as starred on the bookmarks given
+// by ID or URL. A status is not part of the bookmark's content, so it can
+// be changed on locked bookmarks too, and updated_at is left alone.
+func statusCommand(db *sql.DB, args []string, name, column string, value bool, done string) {
+	if len(args) < 1 {
+		fmt.Printf("Usage: importer-exporter %s ID|URL...\n", name)
+		os.Exit(1)
+	}
+
+	// Bookmarks are resolved before the transaction, which needs the
+	// only connection.
+	ids := make(map[string]int64)
+	failed := false
+	for _, arg := range args {
+		id, err := findBookmarkID(db, arg)
+		if err != nil {
+			fmt.Printf("No bookmark matches %s\n", arg)
+			failed = true
+			continue
+		}
+		ids[arg] = id
+	}
+
+	err := inTagTx(db, true, func(tx *sql.Tx) error {
+		for _, arg := range args {
+			id, ok := ids[arg]
+			if !ok {
+				continue
+			}
+			if _, err := tx.Exec("UPDATE bookmarks SET "+column+" = ? WHERE id = ?", value, id); err != nil {
+				return fmt.Errorf("%s: %w", arg, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to %s bookmarks: %v", name, err)
+	}
+	for _, arg := range args {
+		if _, ok := ids[arg]; ok {
+			fmt.Printf("%s %s\n", arg, done)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// rateCommand stores a rating from 1 to 5; 0 removes it. Like the other
+// statuses it may be changed on locked bookmarks.
+func rateCommand(db *sql.DB, args []string) {
+	const usage = "Usage: importer-exporter rate ID|URL 1-5|0"
+	if len(args) != 2 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+	rating, err := strconv.Atoi(args[1])
+	if err != nil || rating < 0 || rating > 5 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
+	id, err := findBookmarkID(db, args[0])
+	if err != nil {
+		fmt.Printf("No bookmark matches %s\n", args[0])
+		os.Exit(1)
+	}
+	err = inTagTx(db, true, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE bookmarks SET rating = ? WHERE id = ?", sql.NullInt64{Int64: int64(rating), Valid: rating > 0}, id)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to rate %s: %v", args[0], err)
+	}
+	if rating == 0 {
+		fmt.Printf("%s unrated\n", args[0])
+	} else {
+		fmt.Printf("%s rated %d\n", args[0], rating)
+	}
+}
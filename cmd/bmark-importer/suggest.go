@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Tag suggestions are drawn from the tags already in use, never made up.
+// Each tag is scored against a bookmark by TF-IDF: how often its words
+// appear in the title, note and archived page text of the bookmark, title
+// words counting most, weighed against how many bookmarks mention them
+// at all. The words of a tag are those of its last level, split at "-"
+// and "_", so lang/machine-learning is suggested for pages that say
+// "machine learning".
+
+const suggestUsage = "Usage: importer-exporter suggest-tags [--accept-top N] [--limit 5] [--dry-run] [--force] ID...|QUERY..."
+
+// Field weights of the term frequency.
+const (
+	titleWeight = 3
+	noteWeight  = 2
+	textWeight  = 1
+)
+
+type tagSuggestion struct {
+	tag   string
+	score float64
+}
+
+// suggestDoc is a bookmark as seen by the scorer: the positions of each
+// word in its fields.
+type suggestDoc struct {
+	fields [3]map[string][]int
+}
+
+func newSuggestDoc(title, note, text string) suggestDoc {
+	var d suggestDoc
+	for i, s := range []string{title, note, text} {
+		d.fields[i] = make(map[string][]int)
+		for pos, word := range suggestWords(s) {
+			d.fields[i][word] = append(d.fields[i][word], pos)
+		}
+	}
+	return d
+}
+
+// suggestWords splits s into lowercase words with a trailing plural "s"
+// taken off, so "tests" and "test" are the same word.
+func suggestWords(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		switch {
+		case len(w) > 4 && strings.HasSuffix(w, "ies"):
+			words[i] = strings.TrimSuffix(w, "ies") + "y"
+		case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+			words[i] = strings.TrimSuffix(w, "s")
+		}
+	}
+	return words
+}
+
+// count returns how often the phrase occurs in field i.
+func (d suggestDoc) count(i int, phrase []string) int {
+	n := 0
+	for _, start := range d.fields[i][phrase[0]] {
+		found := true
+		for k, word := range phrase[1:] {
+			if !containsInt(d.fields[i][word], start+k+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			n++
+		}
+	}
+	return n
+}
+
+func containsInt(sorted []int, n int) bool {
+	i := sort.SearchInts(sorted, n)
+	return i < len(sorted) && sorted[i] == n
+}
+
+func (d suggestDoc) termFrequency(phrase []string) int {
+	return titleWeight*d.count(0, phrase) + noteWeight*d.count(1, phrase) + textWeight*d.count(2, phrase)
+}
+
+// tagPhrase returns the words a tag is recognised by.
+func tagPhrase(tag string) []string {
+	if i := strings.LastIndex(tag, "/"); i >= 0 {
+		tag = tag[i+1:]
+	}
+	return suggestWords(strings.NewReplacer("-", " ", "_", " ").Replace(tag))
+}
+
+// suggestCommand proposes tags for the bookmarks given by ID or query.
+// For each one the best --limit tags are listed and the ones to add are
+// asked for; --accept-top N adds the N best without asking.
+func suggestCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("suggest-tags", flag.ExitOnError)
+	acceptTop := fs.Int("accept-top", 0, "add this many of the best suggestions without asking")
+	limit := fs.Int("limit", 5, "suggestions shown per bookmark")
+	dryRun := fs.Bool("dry-run", false, "only show the suggestions")
+	force := fs.Bool("force", false, "tag locked bookmarks too")
+	words := parseInterspersed(fs, args)
+
+	if len(words) == 0 || *acceptTop < 0 {
+		fmt.Println(suggestUsage)
+		os.Exit(1)
+	}
+	var targets []Bookmark
+	var err error
+	if allIDs(words) {
+		targets, err = selectBookmarks(db, words, "")
+	} else {
+		filter := bookmarkFilter{Query: strings.Join(words, " ")}
+		if _, err := compileQuery(filter.Query); err != nil {
+			log.Fatalf("Invalid query: %v", err)
+		}
+		err = forEachBookmark(db, filter, func(b Bookmark) error {
+			targets = append(targets, b)
+			return nil
+		})
+	}
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "No bookmarks found.")
+		os.Exit(1)
+	}
+
+	docs, err := loadSuggestDocs(db)
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	vocabulary := make(map[string][]string)
+	for _, d := range docs {
+		for _, tag := range d.tags {
+			if _, ok := vocabulary[tag]; !ok && tag != deadTag {
+				if phrase := tagPhrase(tag); len(phrase) > 0 {
+					vocabulary[tag] = phrase
+				}
+			}
+		}
+	}
+	if len(vocabulary) == 0 {
+		fmt.Fprintln(os.Stderr, "No tags to suggest from.")
+		os.Exit(1)
+	}
+	idf := make(map[string]float64)
+	for tag, phrase := range vocabulary {
+		df := 0
+		for _, d := range docs {
+			if d.doc.termFrequency(phrase) > 0 {
+				df++
+			}
+		}
+		idf[tag] = math.Log(float64(len(docs)+1) / float64(df+1))
+	}
+	locked, err := lockedBookmarkIDs(db)
+	if err != nil {
+		log.Fatalf("Failed to read locked bookmarks: %v", err)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	tagged, kept := 0, 0
+	for _, b := range targets {
+		suggestions := suggestTags(docs[b.ID].doc, b.Tags, vocabulary, idf)
+		if len(suggestions) > *limit {
+			suggestions = suggestions[:*limit]
+		}
+		if len(suggestions) == 0 {
+			continue
+		}
+		fmt.Printf("%d\t%s\t%s\n", b.ID, truncate(b.Title, titleWidth), b.URI)
+		for i, s := range suggestions {
+			fmt.Printf("  %d) %s (%.2f)\n", i+1, s.tag, s.score)
+		}
+		if *dryRun {
+			continue
+		}
+		if locked[b.ID] && !*force {
+			fmt.Println("  Skipped, it is locked (use --force)")
+			kept++
+			continue
+		}
+
+		var add []string
+		if *acceptTop > 0 {
+			for _, s := range suggestions[:min(*acceptTop, len(suggestions))] {
+				add = append(add, s.tag)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "Add which tags? [numbers, a for all, empty for none, q to stop] ")
+			answer, err := in.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer == "q" || answer == "" && err != nil {
+				break
+			}
+			for _, field := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' }) {
+				i, err := strconv.Atoi(field)
+				switch {
+				case field == "a":
+					add = nil
+					for _, s := range suggestions {
+						add = append(add, s.tag)
+					}
+				case err == nil && i >= 1 && i <= len(suggestions):
+					add = append(add, suggestions[i-1].tag)
+				default:
+					fmt.Printf("  Ignoring %s, no such suggestion\n", field)
+				}
+			}
+		}
+		if len(add) == 0 {
+			continue
+		}
+		if err := addSuggestedTags(db, b.ID, add, *force); err != nil {
+			log.Fatalf("Failed to tag %s: %v", b.URI, err)
+		}
+		fmt.Printf("  Added %s\n", strings.Join(add, ","))
+		tagged++
+	}
+	if *dryRun {
+		return
+	}
+	if kept > 0 {
+		fmt.Printf("Keeping %d locked bookmark(s), use --force to tag them too\n", kept)
+	}
+	fmt.Printf("Tagged %d bookmark(s)\n", tagged)
+}
+
+func allIDs(words []string) bool {
+	for _, word := range words {
+		if _, err := strconv.ParseInt(word, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+type suggestEntry struct {
+	doc  suggestDoc
+	tags []string
+}
+
+// loadSuggestDocs reads every bookmark with the text of its archived
+// page, which is what the document frequencies are taken over.
+func loadSuggestDocs(db *sql.DB) (map[int64]suggestEntry, error) {
+	texts := make(map[int64]string)
+	err := queryEach(db, "SELECT bookmark_id, text FROM page_texts", func(rows *sql.Rows) error {
+		var id int64
+		var text string
+		err := rows.Scan(&id, &text)
+		texts[id] = text
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[int64]suggestEntry)
+	err = forEachBookmark(db, bookmarkFilter{}, func(b Bookmark) error {
+		docs[b.ID] = suggestEntry{doc: newSuggestDoc(b.Title, b.Note, texts[b.ID]), tags: b.Tags}
+		return nil
+	})
+	return docs, err
+}
+
+// suggestTags scores the vocabulary against doc, best first, leaving out
+// the tags the bookmark already has.
+func suggestTags(doc suggestDoc, has []string, vocabulary map[string][]string, idf map[string]float64) []tagSuggestion {
+	skip := make(map[string]bool)
+	for _, tag := range has {
+		skip[tag] = true
+	}
+	var suggestions []tagSuggestion
+	for tag, phrase := range vocabulary {
+		if skip[tag] {
+			continue
+		}
+		if tf := doc.termFrequency(phrase); tf > 0 && idf[tag] > 0 {
+			suggestions = append(suggestions, tagSuggestion{tag, (1 + math.Log(float64(tf))) * idf[tag]})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].score != suggestions[j].score {
+			return suggestions[i].score > suggestions[j].score
+		}
+		return suggestions[i].tag < suggestions[j].tag
+	})
+	return suggestions
+}
+
+func addSuggestedTags(db *sql.DB, id int64, tags []string, force bool) error {
+	return inTagTx(db, force, func(tx *sql.Tx) error {
+		if err := saveRevision(tx, id); err != nil {
+			return err
+		}
+		if err := linkTags(tx, id, tags); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE bookmarks SET updated_at = ? WHERE id = ?", time.Now().Unix(), id)
+		return err
+	})
+}
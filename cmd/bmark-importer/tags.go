@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const tagUsage = "Usage: importer-exporter tag list | tree | rename OLD NEW | merge FROM... INTO | rm TAG... [--force] | prune | publish|unpublish TAG..."
+
+// tagCommand manages tags as a whole. Every change runs in one
+// transaction, so bookmark_tags never points at a tag that is gone.
+// Changing the tags of a locked bookmark needs --force.
+func tagCommand(db *sql.DB, args []string) {
+	if len(args) < 1 {
+		fmt.Println(tagUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("tag "+args[0], flag.ExitOnError)
+	force := fs.Bool("force", false, "change tags of locked bookmarks too")
+	names := parseInterspersed(fs, args[1:])
+
+	var err error
+	switch args[0] {
+	case "list":
+		listTags(db)
+		return
+	case "tree":
+		tagTree(db)
+		return
+	case "rename":
+		if len(names) != 2 {
+			fmt.Println(tagUsage)
+			os.Exit(1)
+		}
+		err = inTagTx(db, *force, func(tx *sql.Tx) error { return renameTag(tx, names[0], names[1]) })
+		if err == nil {
+			fmt.Printf("Renamed tag %s to %s\n", names[0], names[1])
+		}
+	case "merge":
+		if len(names) < 2 {
+			fmt.Println(tagUsage)
+			os.Exit(1)
+		}
+		from, into := names[:len(names)-1], names[len(names)-1]
+		var moved int64
+		err = inTagTx(db, *force, func(tx *sql.Tx) error {
+			var err error
+			moved, err = mergeTags(tx, from, into)
+			return err
+		})
+		if err == nil {
+			fmt.Printf("Merged %d tag(s) into %s, %d bookmark(s) relinked\n", len(from), into, moved)
+		}
+	case "rm":
+		if len(names) < 1 {
+			fmt.Println(tagUsage)
+			os.Exit(1)
+		}
+		err = inTagTx(db, *force, func(tx *sql.Tx) error {
+			for _, name := range names {
+				if err := removeTag(tx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			fmt.Printf("Removed %d tag(s)\n", len(names))
+		}
+	case "publish", "unpublish":
+		if len(names) < 1 {
+			fmt.Println(tagUsage)
+			os.Exit(1)
+		}
+		// Publishing leaves the bookmarks alone, so it needs no --force.
+		err = inTagTx(db, true, func(tx *sql.Tx) error {
+			for _, name := range names {
+				res, err := tx.Exec("UPDATE tags SET public = ? WHERE tag = ?", args[0] == "publish", name)
+				if err != nil {
+					return err
+				}
+				if n, _ := res.RowsAffected(); n == 0 {
+					return fmt.Errorf("no tag %s", name)
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			fmt.Printf("%sed %d tag(s)\n", strings.ToUpper(args[0][:1])+args[0][1:], len(names))
+		}
+	case "prune":
+		var pruned []string
+		err = inTagTx(db, false, func(tx *sql.Tx) error {
+			var err error
+			pruned, err = pruneTags(tx)
+			return err
+		})
+		if err == nil {
+			for _, name := range pruned {
+				fmt.Println(name)
+			}
+			fmt.Printf("Pruned %d unused tag(s)\n", len(pruned))
+		}
+	default:
+		fmt.Printf("Unknown tag command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("Failed to change tags: %v", err)
+	}
+}
+
+func listTags(db *sql.DB) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	err := queryEach(db, `SELECT t.tag, t.public, COUNT(b.id) FROM tags t
+		LEFT JOIN bookmark_tags bt ON bt.tag_id = t.id
+		LEFT JOIN bookmarks b ON b.id = bt.bookmark_id AND b.deleted_at IS NULL
+		GROUP BY t.id ORDER BY COUNT(b.id) DESC, t.tag`, func(rows *sql.Rows) error {
+		var tag string
+		var public bool
+		var count int
+		if err := rows.Scan(&tag, &public, &count); err != nil {
+			return err
+		}
+		if public {
+			tag += " (public)"
+		}
+		_, err := fmt.Fprintf(tw, "%d\t  %s\n", count, tag)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to list tags: %v", err)
+	}
+	tw.Flush()
+}
+
+func inTagTx(db *sql.DB, force bool, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if force {
+		if err := overrideLocks(tx); err != nil {
+			return err
+		}
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if force {
+		if err := restoreLocks(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func tagID(tx *sql.Tx, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow("SELECT id FROM tags WHERE tag = ?", name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("tag %s does not exist", name)
+	}
+	return id, err
+}
+
+func renameTag(tx *sql.Tx, oldName, newName string) error {
+	id, err := tagID(tx, oldName)
+	if err != nil {
+		return err
+	}
+	if _, err := tagID(tx, newName); err == nil {
+		return fmt.Errorf("tag %s already exists, use tag merge %s %s", newName, oldName, newName)
+	}
+	_, err = tx.Exec("UPDATE tags SET tag = ? WHERE id = ?", newName, id)
+	return err
+}
+
+// mergeTags moves every bookmark of the from tags to into, creating into
+// if needed, and removes the from tags. It returns how many links moved.
+func mergeTags(tx *sql.Tx, from []string, into string) (int64, error) {
+	if _, err := tx.Exec("INSERT OR IGNORE INTO tags (tag) VALUES (?)", into); err != nil {
+		return 0, err
+	}
+	intoID, err := tagID(tx, into)
+	if err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for _, name := range from {
+		if name == into {
+			continue
+		}
+		id, err := tagID(tx, name)
+		if err != nil {
+			return moved, err
+		}
+		res, err := tx.Exec(`INSERT OR IGNORE INTO bookmark_tags (bookmark_id, tag_id)
+			SELECT bookmark_id, ? FROM bookmark_tags WHERE tag_id = ?`, intoID, id)
+		if err != nil {
+			return moved, err
+		}
+		n, _ := res.RowsAffected()
+		moved += n
+		if err := deleteTag(tx, id); err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+func removeTag(tx *sql.Tx, name string) error {
+	id, err := tagID(tx, name)
+	if err != nil {
+		return err
+	}
+	return deleteTag(tx, id)
+}
+
+// deleteTag removes a tag and its links. The links are deleted first so
+// this does not depend on foreign keys being enforced.
+func deleteTag(tx *sql.Tx, id int64) error {
+	if _, err := tx.Exec("DELETE FROM bookmark_tags WHERE tag_id = ?", id); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM tags WHERE id = ?", id)
+	return err
+}
+
+// pruneTags deletes tags no bookmark links to, which importing and
+// removing bookmarks leave behind, and returns their names.
+func pruneTags(tx *sql.Tx) ([]string, error) {
+	rows, err := tx.Query(`SELECT tag FROM tags
+		WHERE id NOT IN (SELECT tag_id FROM bookmark_tags) ORDER BY tag`)
+	if err != nil {
+		return nil, err
+	}
+	var pruned []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pruned = append(pruned, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM bookmark_tags)")
+	return pruned, err
+}
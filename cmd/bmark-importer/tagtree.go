@@ -0,0 +1,94 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Tags containing "/" form a hierarchy: lang/go and lang/rust are both
+// below lang, whether or not lang is itself a tag. Filtering by a tag
+// takes in the tags below it (see tagCondition).
+
+// flattenTags splits hierarchical tags into one tag per level, keeping
+// the first occurrence of each.
+func flattenTags(tags []string) []string {
+	var flat []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		for _, part := range strings.Split(tag, "/") {
+			if part = strings.TrimSpace(part); part != "" && !seen[part] {
+				seen[part] = true
+				flat = append(flat, part)
+			}
+		}
+	}
+	return flat
+}
+
+type tagNode struct {
+	name      string
+	children  map[string]*tagNode
+	bookmarks map[int64]bool
+}
+
+func (n *tagNode) child(name string) *tagNode {
+	c, ok := n.children[name]
+	if !ok {
+		c = &tagNode{name: name, children: make(map[string]*tagNode), bookmarks: make(map[int64]bool)}
+		n.children[name] = c
+	}
+	return c
+}
+
+// tagTree prints the tag hierarchy with the number of bookmarks at or
+// below each level.
+func tagTree(db *sql.DB) {
+	root := &tagNode{children: make(map[string]*tagNode)}
+	err := queryEach(db, `SELECT t.tag, bt.bookmark_id FROM tags t
+		JOIN bookmark_tags bt ON bt.tag_id = t.id
+		JOIN bookmarks b ON b.id = bt.bookmark_id AND b.deleted_at IS NULL`, func(rows *sql.Rows) error {
+		var tag string
+		var id int64
+		if err := rows.Scan(&tag, &id); err != nil {
+			return err
+		}
+		node := root
+		for _, part := range strings.Split(tag, "/") {
+			if part == "" {
+				continue
+			}
+			node = node.child(part)
+			node.bookmarks[id] = true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read tags: %v", err)
+	}
+	if len(root.children) == 0 {
+		fmt.Fprintln(os.Stderr, "No tags found.")
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	var walk func(n *tagNode, depth int)
+	walk = func(n *tagNode, depth int) {
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := n.children[name]
+			fmt.Fprintf(tw, "%d\t  %s%s\n", len(c.bookmarks), strings.Repeat("  ", depth), c.name)
+			walk(c, depth+1)
+		}
+	}
+	walk(root, 0)
+	tw.Flush()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateBookmark is what export templates see for each bookmark.
+type templateBookmark struct {
+	ID        int64
+	URL       string
+	Title     string
+	Note      string
+	Tags      []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Keyword   string
+	Private   bool
+	Unread    bool
+	Starred   bool
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// parseExportTemplate reads a text/template file. Besides the built-in
+// functions, templates can use join to format tag lists.
+func parseExportTemplate(path string) (*template.Template, error) {
+	return template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+}
+
+// templateExtension derives the output extension from the template name,
+// so list.md.tmpl produces a .md file.
+func templateExtension(path string) string {
+	return filepath.Ext(strings.TrimSuffix(filepath.Base(path), ".tmpl"))
+}
+
+// writeTemplate executes the template once with .Bookmarks holding every
+// bookmark, which lets it write headers, footers and separators itself.
+func writeTemplate(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	var bookmarks []templateBookmark
+	err := forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		bookmarks = append(bookmarks, templateBookmark{
+			ID:        b.ID,
+			URL:       b.URI,
+			Title:     b.Title,
+			Note:      b.Note,
+			Tags:      b.Tags,
+			CreatedAt: time.Unix(b.CreatedAt, 0).UTC(),
+			UpdatedAt: time.Unix(b.UpdatedAt, 0).UTC(),
+			Keyword:   b.Keyword,
+			Private:   b.Private,
+			Unread:    b.Unread,
+			Starred:   b.Starred,
+		})
+		return nil
+	})
+	if err != nil {
+		return len(bookmarks), err
+	}
+
+	data := struct{ Bookmarks []templateBookmark }{bookmarks}
+	return len(bookmarks), opts.Template.Execute(out, data)
+}
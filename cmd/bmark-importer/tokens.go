@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// API tokens let serve tell clients apart: each has a name, such as the
+// device it is used on, and scopes that limit it to reading or also allow
+// changes. A token made with --user works on the bookmarks of that user
+// instead of the owner's. Only a hash of the secret is stored, so the
+// secret is shown once, when the token is created; a lost one is revoked
+// and replaced.
+
+const apiTokensSchema = `CREATE TABLE IF NOT EXISTS api_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	secret_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	last_used_at INTEGER
+);`
+
+const tokenUsage = "Usage: importer-exporter token create --name NAME [--scopes read,write] [--user USER] | list | revoke ID|NAME..."
+
+// tokenScopes are the scopes a token can have: read for GET requests,
+// write for the others.
+var tokenScopes = []string{"read", "write"}
+
+type apiToken struct {
+	ID   int64
+	Name string
+	// UserID is 0 for tokens of the owner.
+	UserID    int64
+	User      string
+	Scopes    []string
+	CreatedAt int64
+	LastUsed  int64
+}
+
+func (t apiToken) allows(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupToken returns the stored token whose secret is secret, and
+// whether there is one.
+func lookupToken(db *sql.DB, secret string) (apiToken, bool, error) {
+	var t apiToken
+	var scopes string
+	var lastUsed sql.NullInt64
+	err := db.QueryRow("SELECT id, name, COALESCE(user_id, 0), scopes, created_at, last_used_at FROM api_tokens WHERE secret_hash = ?",
+		hashTokenSecret(secret)).Scan(&t.ID, &t.Name, &t.UserID, &scopes, &t.CreatedAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return t, false, nil
+	}
+	if err != nil {
+		return t, false, err
+	}
+	t.Scopes = strings.Split(scopes, ",")
+	t.LastUsed = lastUsed.Int64
+	return t, true, nil
+}
+
+// touchToken records that a token was used, at most once a minute.
+func touchToken(db *sql.DB, id int64) error {
+	now := time.Now().Unix()
+	_, err := db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ? AND COALESCE(last_used_at, 0) < ?", now, id, now-60)
+	return err
+}
+
+func loadTokens(db *sql.DB) ([]apiToken, error) {
+	var tokens []apiToken
+	err := queryEach(db, `SELECT t.id, t.name, COALESCE(t.user_id, 0), COALESCE(u.name, ''), t.scopes, t.created_at, COALESCE(t.last_used_at, 0)
+		FROM api_tokens t LEFT JOIN users u ON u.id = t.user_id ORDER BY t.id`, func(rows *sql.Rows) error {
+		var t apiToken
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.Name, &t.UserID, &t.User, &scopes, &t.CreatedAt, &t.LastUsed); err != nil {
+			return err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, t)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// resolveToken returns the ID of the token key names, by ID if it is a
+// number and by name otherwise, or 0 if there is none. A number that is
+// the ID of one token and the name of another is refused.
+func resolveToken(db *sql.DB, key string) (int64, error) {
+	var ids []int64
+	err := queryEach(db, "SELECT id FROM api_tokens WHERE CAST(id AS TEXT) = ?1 OR name = ?1", func(rows *sql.Rows) error {
+		var id int64
+		err := rows.Scan(&id)
+		ids = append(ids, id)
+		return err
+	}, key)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	if len(ids) > 1 {
+		return 0, fmt.Errorf("%s is the ID of one token and the name of another; give the name of the first or the ID of the second", key)
+	}
+	return ids[0], nil
+}
+
+// tokenCommand manages the API tokens serve accepts.
+func tokenCommand(db *sql.DB, args []string) {
+	if len(args) < 1 {
+		fmt.Println(tokenUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("token "+args[0], flag.ExitOnError)
+	name := fs.String("name", "", "name of the token, such as the device it is for")
+	scopes := fs.String("scopes", "read,write", "comma-separated scopes: "+strings.Join(tokenScopes, ", "))
+	user := fs.String("user", "", "make the token for this user, see bmark user add")
+	names := parseInterspersed(fs, args[1:])
+
+	switch args[0] {
+	case "create":
+		if strings.TrimSpace(*name) == "" || len(names) > 0 {
+			fmt.Println(tokenUsage)
+			os.Exit(1)
+		}
+		var granted []string
+		for _, scope := range strings.Split(*scopes, ",") {
+			scope = strings.TrimSpace(scope)
+			if !slices.Contains(tokenScopes, scope) {
+				log.Fatalf("Unknown scope %q, use %s", scope, strings.Join(tokenScopes, " or "))
+			}
+			if !slices.Contains(granted, scope) {
+				granted = append(granted, scope)
+			}
+		}
+		var owner sql.NullInt64
+		if *user != "" {
+			id, err := userID(db, *user)
+			if err != nil {
+				log.Fatalf("Failed to read users: %v", err)
+			}
+			if id == 0 {
+				log.Fatalf("No user %s, see bmark user add", *user)
+			}
+			owner = sql.NullInt64{Int64: id, Valid: true}
+		}
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("Failed to make a token: %v", err)
+		}
+		secret := "bmark_" + hex.EncodeToString(buf)
+		_, err := db.Exec("INSERT INTO api_tokens (name, secret_hash, scopes, user_id, created_at) VALUES (?, ?, ?, ?, ?)",
+			strings.TrimSpace(*name), hashTokenSecret(secret), strings.Join(granted, ","), owner, time.Now().Unix())
+		if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+			log.Fatalf("A token named %s exists already, revoke it first", *name)
+		}
+		if err != nil {
+			log.Fatalf("Failed to create token: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Created token %s (%s). Copy it now, it is not shown again:\n", strings.TrimSpace(*name), strings.Join(granted, ","))
+		fmt.Println(secret)
+	case "list":
+		tokens, err := loadTokens(db)
+		if err != nil {
+			log.Fatalf("Failed to list tokens: %v", err)
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintln(os.Stderr, "No tokens found.")
+			os.Exit(1)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, t := range tokens {
+			lastUsed := "never used"
+			if t.LastUsed > 0 {
+				lastUsed = "used " + time.Unix(t.LastUsed, 0).Format("2006-01-02 15:04")
+			}
+			owner := t.User
+			if t.UserID == 0 {
+				owner = "(owner)"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\tcreated %s\t%s\n", t.ID, t.Name, owner, strings.Join(t.Scopes, ","),
+				time.Unix(t.CreatedAt, 0).Format("2006-01-02"), lastUsed)
+		}
+		tw.Flush()
+	case "revoke":
+		if len(names) == 0 {
+			fmt.Println(tokenUsage)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			id, err := resolveToken(db, name)
+			if err != nil {
+				log.Fatalf("Failed to revoke token %s: %v", name, err)
+			}
+			if id == 0 {
+				fmt.Printf("No token %s\n", name)
+				os.Exit(1)
+			}
+			if _, err := db.Exec("DELETE FROM api_tokens WHERE id = ?", id); err != nil {
+				log.Fatalf("Failed to revoke token %s: %v", name, err)
+			}
+		}
+		fmt.Printf("Revoked %d token(s)\n", len(names))
+	default:
+		fmt.Printf("Unknown token command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
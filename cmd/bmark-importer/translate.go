@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Translated titles and notes are stored next to the originals, one row
+// per language, and "bmark list" matches them as well.
+const translationsSchema = `CREATE TABLE IF NOT EXISTS translations (
+	bookmark_id INTEGER NOT NULL,
+	lang TEXT NOT NULL,
+	title TEXT,
+	note TEXT,
+	translated_at INTEGER NOT NULL,
+	PRIMARY KEY (bookmark_id, lang),
+	FOREIGN KEY (bookmark_id) REFERENCES bookmarks(id) ON DELETE CASCADE
+);`
+
+// translateFunc translates texts into the target language, returning
+// them in the same order.
+type translateFunc func(texts []string, target string) ([]string, error)
+
+func translateCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("translate", flag.ExitOnError)
+	backend := fs.String("backend", envOr("BMARK_TRANSLATE_BACKEND", "libretranslate"), "translation service: libretranslate or deepl ($BMARK_TRANSLATE_BACKEND)")
+	api := fs.String("api", os.Getenv("BMARK_TRANSLATE_URL"), "service URL; defaults to the public endpoint ($BMARK_TRANSLATE_URL)")
+	key := fs.String("key", os.Getenv("BMARK_TRANSLATE_KEY"), "API key ($BMARK_TRANSLATE_KEY)")
+	to := fs.String("to", envOr("BMARK_TRANSLATE_TO", "en"), "target language code ($BMARK_TRANSLATE_TO)")
+	query := fs.String("query", "", "translate bookmarks whose title, note or URL contains this text")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 && *query == "" {
+		fmt.Println("Usage: importer-exporter translate [--to LANG] [--backend libretranslate|deepl] ID... | --query TEXT")
+		os.Exit(1)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	var translate translateFunc
+	switch *backend {
+	case "libretranslate":
+		if *api == "" {
+			*api = "https://libretranslate.com"
+		}
+		translate = libreTranslate(client, *api, *key)
+	case "deepl":
+		if *key == "" {
+			log.Fatalf("DeepL needs an API key, pass --key or set BMARK_TRANSLATE_KEY")
+		}
+		// Free API keys end in ":fx" and use their own endpoint.
+		if *api == "" && strings.HasSuffix(*key, ":fx") {
+			*api = "https://api-free.deepl.com"
+		} else if *api == "" {
+			*api = "https://api.deepl.com"
+		}
+		translate = deepLTranslate(client, *api, *key)
+	default:
+		log.Fatalf("Unknown translation backend: %s", *backend)
+	}
+
+	bookmarks, err := selectBookmarks(db, fs.Args(), *query)
+	if err != nil {
+		log.Fatalf("Failed to read bookmarks: %v", err)
+	}
+	if len(bookmarks) == 0 {
+		fmt.Println("No matching bookmarks found.")
+		os.Exit(1)
+	}
+
+	lang := strings.ToLower(*to)
+	failed := 0
+	for _, b := range bookmarks {
+		texts, err := translate([]string{b.Title, b.Note}, lang)
+		if err != nil {
+			log.Printf("Failed to translate %s: %v", b.URI, err)
+			failed++
+			continue
+		}
+		_, err = db.Exec(`INSERT OR REPLACE INTO translations (bookmark_id, lang, title, note, translated_at)
+			VALUES (?, ?, ?, ?, ?)`, b.ID, lang, texts[0], texts[1], time.Now().Unix())
+		if err != nil {
+			log.Fatalf("Failed to store translation: %v", err)
+		}
+		fmt.Printf("%d [%s] %s\n", b.ID, lang, texts[0])
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// selectBookmarks loads the bookmarks given by ID or URL, or those
+// matching query. They are read up front so callers can write while
+// going through them.
+func selectBookmarks(db *sql.DB, keys []string, query string) ([]Bookmark, error) {
+	ids := make(map[int64]bool)
+	urls := make(map[string]bool)
+	for _, key := range keys {
+		if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+			ids[id] = true
+		} else {
+			urls[key] = true
+		}
+	}
+	query = strings.ToLower(query)
+
+	var bookmarks []Bookmark
+	err := forEachBookmark(db, bookmarkFilter{}, func(b Bookmark) error {
+		match := ids[b.ID] || urls[b.URI]
+		if query != "" {
+			text := strings.ToLower(b.Title + "\n" + b.Note + "\n" + b.URI)
+			match = match || strings.Contains(text, query)
+		}
+		if match {
+			bookmarks = append(bookmarks, b)
+		}
+		return nil
+	})
+	return bookmarks, err
+}
+
+// libreTranslate uses the /translate endpoint of a LibreTranslate server,
+// which accepts a batch of texts.
+func libreTranslate(client *http.Client, api, key string) translateFunc {
+	return func(texts []string, target string) ([]string, error) {
+		var result struct {
+			TranslatedText []string `json:"translatedText"`
+			Error          string   `json:"error"`
+		}
+		body := map[string]any{"q": texts, "source": "auto", "target": target, "format": "text"}
+		if key != "" {
+			body["api_key"] = key
+		}
+		err := postJSON(client, strings.TrimSuffix(api, "/")+"/translate", nil, body, &result)
+		if err != nil {
+			return nil, err
+		}
+		if result.Error != "" {
+			return nil, fmt.Errorf("libretranslate: %s", result.Error)
+		}
+		if len(result.TranslatedText) != len(texts) {
+			return nil, fmt.Errorf("libretranslate returned %d texts for %d", len(result.TranslatedText), len(texts))
+		}
+		return result.TranslatedText, nil
+	}
+}
+
+// deepLTranslate uses the DeepL v2 API.
+func deepLTranslate(client *http.Client, api, key string) translateFunc {
+	return func(texts []string, target string) ([]string, error) {
+		var result struct {
+			Translations []struct {
+				Text string `json:"text"`
+			} `json:"translations"`
+		}
+		header := http.Header{"Authorization": {"DeepL-Auth-Key " + key}}
+		body := map[string]any{"text": texts, "target_lang": strings.ToUpper(target)}
+		err := postJSON(client, strings.TrimSuffix(api, "/")+"/v2/translate", header, body, &result)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Translations) != len(texts) {
+			return nil, fmt.Errorf("deepl returned %d texts for %d", len(result.Translations), len(texts))
+		}
+		out := make([]string, len(texts))
+		for i, t := range result.Translations {
+			out[i] = t.Text
+		}
+		return out, nil
+	}
+}
+
+func postJSON(client *http.Client, url string, header http.Header, body, result any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func envOr(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
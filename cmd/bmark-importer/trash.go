@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const trashUsage = "Usage: importer-exporter trash list | restore ID|URL... | empty [--older-than 30d] [--yes]"
+
+// trashCommand manages bookmarks removed with rm. They keep their tags
+// and everything else until the trash is emptied, so restoring one brings
+// it back as it was.
+func trashCommand(db *sql.DB, args []string) {
+	if len(args) < 1 {
+		fmt.Println(trashUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("trash "+args[0], flag.ExitOnError)
+	olderThan := fs.String("older-than", "", "only empty bookmarks trashed longer ago than this, like 30d or 12h")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	keys := parseInterspersed(fs, args[1:])
+
+	switch args[0] {
+	case "list":
+		listTrash(db)
+	case "restore":
+		if len(keys) == 0 {
+			fmt.Println(trashUsage)
+			os.Exit(1)
+		}
+		restoreCommand(db, keys)
+	case "empty":
+		cutoff := time.Now().Unix() + 1
+		if *olderThan != "" {
+			age, err := parseAge(*olderThan)
+			if err != nil {
+				log.Fatalf("Invalid --older-than: %v", err)
+			}
+			cutoff = time.Now().Add(-age).Unix()
+		}
+		emptyTrash(db, cutoff, *yes)
+	default:
+		fmt.Printf("Unknown trash command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func listTrash(db *sql.DB) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	count := 0
+	err := forEachBookmark(db, bookmarkFilter{Trashed: true}, func(b Bookmark) error {
+		count++
+		title := strings.Join(strings.Fields(b.Title), " ")
+		if title == "" {
+			title = "-"
+		}
+		deleted := time.Unix(b.DeletedAt, 0).Format("2006-01-02")
+		_, err := fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", b.ID, deleted, truncate(title, titleWidth), b.URI)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to list trash: %v", err)
+	}
+	tw.Flush()
+	if count == 0 {
+		fmt.Println("The trash is empty.")
+	}
+}
+
+func restoreCommand(db *sql.DB, keys []string) {
+	ids := make(map[string]int64)
+	err := forEachBookmark(db, bookmarkFilter{Trashed: true}, func(b Bookmark) error {
+		ids[strconv.FormatInt(b.ID, 10)] = b.ID
+		ids[b.URI] = b.ID
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read trash: %v", err)
+	}
+
+	var restore []int64
+	failed := false
+	for _, key := range keys {
+		id, ok := ids[key]
+		if !ok {
+			fmt.Printf("No bookmark in the trash matches %s\n", key)
+			failed = true
+			continue
+		}
+		restore = append(restore, id)
+	}
+
+	err = inTagTx(db, false, func(tx *sql.Tx) error {
+		for _, id := range restore {
+			if err := restoreFromTrash(tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to restore bookmarks: %v", err)
+	}
+	fmt.Printf("Restored %d bookmark(s)\n", len(restore))
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// restoreFromTrash takes a bookmark out of the trash, if it is there.
+// Locked bookmarks could only be trashed with --force, so their lock does
+// not stand in the way of getting them back.
+func restoreFromTrash(tx *sql.Tx, id int64) error {
+	var trashed bool
+	err := tx.QueryRow("SELECT deleted_at IS NOT NULL FROM bookmarks WHERE id = ?", id).Scan(&trashed)
+	if err != nil || !trashed {
+		return err
+	}
+	if err := overrideLocks(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE bookmarks SET deleted_at = NULL WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to restore bookmark %d: %w", id, err)
+	}
+	return restoreLocks(tx)
+}
+
+// emptyTrash deletes bookmarks trashed before cutoff for good. Their tag
+// links, push state, samples and translations go with them through
+// ON DELETE CASCADE.
+func emptyTrash(db *sql.DB, cutoff int64, yes bool) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM bookmarks WHERE deleted_at < ?", cutoff).Scan(&n)
+	if err != nil {
+		log.Fatalf("Failed to read trash: %v", err)
+	}
+	if n == 0 {
+		fmt.Println("Nothing to delete.")
+		return
+	}
+	if !yes && !confirm(fmt.Sprintf("Delete %d bookmark(s) for good?", n)) {
+		fmt.Println("Nothing deleted.")
+		os.Exit(1)
+	}
+
+	err = inTagTx(db, true, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM bookmarks WHERE deleted_at < ?", cutoff)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to empty trash: %v", err)
+	}
+	fmt.Printf("Deleted %d bookmark(s)\n", n)
+}
+
+// parseAge reads a duration like 30d, 2w, 2y or 12h. Days, weeks and
+// years (of 365 days) are not Go durations, so they are handled here.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			days, err := strconv.Atoi(n)
+			if err != nil || days < 0 {
+				return 0, fmt.Errorf("%q is not a duration like 30d", s)
+			}
+			return time.Duration(days) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration like 30d", s)
+	}
+	return d, nil
+}
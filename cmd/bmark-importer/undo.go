@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Every command that changes bookmarks runs as an operation. While an
+// operation is open, triggers write the SQL that reverses each changed row
+// to undo_log, following the undo log pattern from the SQLite
+// documentation; undo replays it backwards. A whole import is one
+// operation, so it is undone in one go. Only the newest operations are
+// kept.
+
+const operationsSchema = `CREATE TABLE IF NOT EXISTS operations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	at INTEGER NOT NULL,
+	open INTEGER NOT NULL DEFAULT 1,
+	undone INTEGER NOT NULL DEFAULT 0
+);`
+
+const undoLogSchema = `CREATE TABLE IF NOT EXISTS undo_log (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	op_id INTEGER NOT NULL REFERENCES operations(id) ON DELETE CASCADE,
+	sql TEXT NOT NULL
+);`
+
+const keptOperations = 50
+
+// journaledTables are the tables undo restores. Metadata fetched from the
+// network, samples and push state are not part of it. Revisions are, so
+// that undoing an edit also drops the revision it saved.
+var journaledTables = []string{"bookmarks", "tags", "bookmark_tags", "folders", "tag_rules", "bookmark_revisions"}
+
+// journaledCommands open an operation around themselves. check and enrich
+// are left out: they store what they find on the network, often from
+// cron, and should not become the step undo reverses instead of the
+// user's own last change.
+var journaledCommands = map[string]bool{
+	"add": true, "import": true, "migrate": true, "pull": true,
+	"edit": true, "rm": true, "trash": true,
+	"tag": true, "folder": true, "lock": true, "unlock": true,
+	"star": true, "unstar": true, "archive": true, "unarchive": true,
+	"mark-read": true, "mark-unread": true, "rate": true, "revert": true,
+	"dedupe": true, "retag": true, "bulk-edit": true, "rule": true,
+	"archive-org": true, "suggest-tags": true, "ai": true, "publish": true, "unpublish": true,
+}
+
+// journalTriggers creates the undo_log triggers. They list every column,
+// so they are recreated whenever a table gained one.
+func journalTriggers(db *sql.DB) error {
+	for _, table := range journaledTables {
+		triggers, err := undoTriggers(db, table)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		for name, trigger := range triggers {
+			var current string
+			err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = ?", name).Scan(&current)
+			if err == nil && current == trigger {
+				continue
+			}
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return fmt.Errorf("failed to drop trigger %s: %w", name, err)
+			}
+			if _, err := db.Exec(trigger); err != nil {
+				return fmt.Errorf("failed to create trigger %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func undoTriggers(db *sql.DB, table string) (map[string]string, error) {
+	var columns []string
+	key := "rowid"
+	err := queryEach(db, `SELECT name, type, pk, (SELECT COUNT(*) FROM pragma_table_info(?1) WHERE pk > 0)
+		FROM pragma_table_info(?1) ORDER BY cid`, func(rows *sql.Rows) error {
+		var name, typ string
+		var pk, keyColumns int
+		if err := rows.Scan(&name, &typ, &pk, &keyColumns); err != nil {
+			return err
+		}
+		// An INTEGER PRIMARY KEY is the rowid itself, unless the key
+		// spans several columns.
+		if pk == 1 && keyColumns == 1 && strings.EqualFold(typ, "INTEGER") {
+			key = name
+			return nil
+		}
+		columns = append(columns, name)
+		return nil
+	}, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var sets, values []string
+	for _, c := range columns {
+		sets = append(sets, fmt.Sprintf("'%s = ' || quote(OLD.%s)", c, c))
+		values = append(values, fmt.Sprintf("quote(OLD.%s)", c))
+	}
+	names := key + ", " + strings.Join(columns, ", ")
+
+	trigger := func(event, reverse string) string {
+		return fmt.Sprintf(`CREATE TRIGGER undo_%s_%s AFTER %s ON %s
+	WHEN EXISTS (SELECT 1 FROM operations WHERE open = 1) BEGIN
+	INSERT INTO undo_log (op_id, sql) VALUES ((SELECT MAX(id) FROM operations WHERE open = 1), %s);
+	END`, table, strings.ToLower(event), event, table, reverse)
+	}
+	return map[string]string{
+		"undo_" + table + "_insert": trigger("INSERT",
+			fmt.Sprintf("'DELETE FROM %s WHERE %s = ' || NEW.%s", table, key, key)),
+		"undo_" + table + "_update": trigger("UPDATE",
+			fmt.Sprintf("'UPDATE %s SET ' || %s || ' WHERE %s = ' || OLD.%s", table, strings.Join(sets, " || ', ' || "), key, key)),
+		"undo_" + table + "_delete": trigger("DELETE",
+			fmt.Sprintf("'INSERT INTO %s (%s) VALUES (' || OLD.%s || ', ' || %s || ')'", table, names, key, strings.Join(values, " || ', ' || "))),
+	}, nil
+}
+
+// beginOperation opens an operation named after the command line. One
+// left open by a command that exited early is closed first, and the
+// oldest operations are forgotten.
+func beginOperation(db *sql.DB, name string) error {
+	if err := endOperation(db); err != nil {
+		return err
+	}
+	_, err := db.Exec(`DELETE FROM operations WHERE id IN
+		(SELECT id FROM operations ORDER BY id DESC LIMIT -1 OFFSET ?)`, keptOperations)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO operations (name, at) VALUES (?, ?)", name, time.Now().Unix())
+	return err
+}
+
+// endOperation closes the open operation, dropping it if it changed
+// nothing.
+func endOperation(db *sql.DB) error {
+	if _, err := db.Exec("UPDATE operations SET open = 0 WHERE open = 1"); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM operations WHERE NOT EXISTS (SELECT 1 FROM undo_log WHERE op_id = operations.id)")
+	return err
+}
+
+// undoCommand reverses the newest operation that has not been undone.
+// Undoing is not itself recorded, so running undo again reverses the
+// operation before that.
+func undoCommand(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	list := fs.Bool("list", false, "list the operations that can be undone")
+	fs.Parse(args)
+
+	if err := endOperation(db); err != nil {
+		log.Fatalf("Failed to close operations: %v", err)
+	}
+	if *list {
+		listOperations(db)
+		return
+	}
+
+	var id, at int64
+	var name string
+	err := db.QueryRow("SELECT id, name, at FROM operations WHERE undone = 0 ORDER BY id DESC LIMIT 1").Scan(&id, &name, &at)
+	if err == sql.ErrNoRows {
+		fmt.Println("Nothing to undo.")
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalf("Failed to read operations: %v", err)
+	}
+
+	var statements []string
+	err = queryEach(db, "SELECT sql FROM undo_log WHERE op_id = ? ORDER BY seq DESC", func(rows *sql.Rows) error {
+		var stmt string
+		err := rows.Scan(&stmt)
+		statements = append(statements, stmt)
+		return err
+	}, id)
+	if err != nil {
+		log.Fatalf("Failed to read undo log: %v", err)
+	}
+
+	// Rows come back in reverse order, so a tag link can be restored
+	// before its bookmark; foreign keys are checked at commit.
+	err = inTagTx(db, true, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("PRAGMA defer_foreign_keys = ON"); err != nil {
+			return err
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("%s: %w", stmt, err)
+			}
+		}
+		_, err := tx.Exec("UPDATE operations SET undone = 1 WHERE id = ?", id)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to undo %s, later changes may conflict with it: %v", name, err)
+	}
+	fmt.Printf("Undid %q from %s (%d change(s))\n", name, time.Unix(at, 0).Format("2006-01-02 15:04"), len(statements))
+}
+
+func listOperations(db *sql.DB) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	err := queryEach(db, `SELECT o.id, o.at, o.name, COUNT(u.seq) FROM operations o
+		JOIN undo_log u ON u.op_id = o.id WHERE o.undone = 0
+		GROUP BY o.id ORDER BY o.id DESC`, func(rows *sql.Rows) error {
+		var id, at int64
+		var name string
+		var changes int
+		if err := rows.Scan(&id, &at, &name, &changes); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(tw, "%d\t%s\t%d change(s)\t%s\n", id, time.Unix(at, 0).Format("2006-01-02 15:04"), changes, name)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to list operations: %v", err)
+	}
+	tw.Flush()
+}
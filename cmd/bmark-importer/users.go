@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Users let one serve share a machine between a household or a small
+// team. The database serve is started on belongs to its owner and keeps
+// the accounts and every token; each user's bookmarks are a database of
+// their own in the users directory next to it, so a user never sees
+// another's bookmarks, and undo, history and locks work per user as they
+// do for the owner. Accounts are made by the owner, who gives each user a
+// token: "bmark token create --name alice-phone --user alice".
+
+const usersSchema = `CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	created_at INTEGER NOT NULL
+);`
+
+const userUsage = "Usage: importer-exporter user add NAME | list | rm NAME"
+
+// userNames are safe as file names everywhere.
+var userNames = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// userDatabasePath returns where the bookmarks of user name are kept when
+// the owner's database is dbFile.
+func userDatabasePath(dbFile, name string) string {
+	return filepath.Join(filepath.Dir(dbFile), "users", name+".db")
+}
+
+// userID returns the ID of user name, or 0 if there is none.
+func userID(db *sql.DB, name string) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT id FROM users WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// userCommand manages the accounts of serve. Removing a user revokes the
+// user's tokens but keeps the bookmarks database, whose path is printed.
+func userCommand(db *sql.DB, dbFile string, args []string) {
+	if len(args) < 1 {
+		fmt.Println(userUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	names := parseInterspersed(fs, args[1:])
+
+	switch args[0] {
+	case "add":
+		if len(names) != 1 {
+			fmt.Println(userUsage)
+			os.Exit(1)
+		}
+		name := names[0]
+		if !userNames.MatchString(name) {
+			log.Fatalf("Invalid user name %q, use lowercase letters, digits, - and _", name)
+		}
+		path := userDatabasePath(dbFile, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			log.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		userDB, err := openDatabase(path)
+		if err != nil {
+			log.Fatalf("Failed to create database of %s: %v", name, err)
+		}
+		userDB.Close()
+		_, err = db.Exec("INSERT INTO users (name, created_at) VALUES (?, ?)", name, time.Now().Unix())
+		if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+			log.Fatalf("User %s exists already", name)
+		}
+		if err != nil {
+			log.Fatalf("Failed to add user: %v", err)
+		}
+		fmt.Printf("Added user %s, with bookmarks in %s\n", name, path)
+		fmt.Printf("Give them a token: bmark token create --name %s-laptop --user %s\n", name, name)
+	case "list":
+		type user struct {
+			name      string
+			createdAt int64
+			tokens    int
+		}
+		var users []user
+		err := queryEach(db, `SELECT u.name, u.created_at, COUNT(t.id) FROM users u
+			LEFT JOIN api_tokens t ON t.user_id = u.id GROUP BY u.id ORDER BY u.name`, func(rows *sql.Rows) error {
+			var u user
+			err := rows.Scan(&u.name, &u.createdAt, &u.tokens)
+			users = append(users, u)
+			return err
+		})
+		if err != nil {
+			log.Fatalf("Failed to list users: %v", err)
+		}
+		if len(users) == 0 {
+			fmt.Fprintln(os.Stderr, "No users found.")
+			os.Exit(1)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, u := range users {
+			fmt.Fprintf(tw, "%s\tcreated %s\t%d token(s)\t%s\n", u.name, time.Unix(u.createdAt, 0).Format("2006-01-02"),
+				u.tokens, userDatabasePath(dbFile, u.name))
+		}
+		tw.Flush()
+	case "rm":
+		if len(names) != 1 {
+			fmt.Println(userUsage)
+			os.Exit(1)
+		}
+		res, err := db.Exec("DELETE FROM users WHERE name = ?", names[0])
+		if err != nil {
+			log.Fatalf("Failed to remove user %s: %v", names[0], err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			fmt.Printf("No user %s\n", names[0])
+			os.Exit(1)
+		}
+		fmt.Printf("Removed user %s and revoked their tokens; their bookmarks are still in %s\n", names[0], userDatabasePath(dbFile, names[0]))
+	default:
+		fmt.Printf("Unknown user command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
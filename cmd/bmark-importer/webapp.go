@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// writeWebapp writes a self-contained HTML page with the bookmarks
+// embedded as JSON and a small search UI, so the collection can be browsed
+// from a USB stick or a phone without a server. encoding/json escapes '<',
+// '>' and '&', so the data cannot close the <script> element early. The
+// favicons of the hosts on the page follow as a second JSON object.
+func writeWebapp(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	if _, err := io.WriteString(out, webappHead); err != nil {
+		return 0, err
+	}
+	// The page needs every field, whatever --fields says.
+	opts.Fields = nil
+	count, err := writeJSON(db, out, opts)
+	if err != nil {
+		return count, err
+	}
+
+	icons, err := loadFavicons(db)
+	if err != nil {
+		return count, fmt.Errorf("failed to load favicons: %w", err)
+	}
+	shown := make(map[string]string)
+	err = forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		host := urlHost(b.URI)
+		if icon := icons[host].dataURI(); icon != "" {
+			shown[host] = icon
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	data, err := json.Marshal(shown)
+	if err != nil {
+		return count, err
+	}
+	if _, err := io.WriteString(out, "</script>\n<script id=\"icons\" type=\"application/json\">"); err != nil {
+		return count, err
+	}
+	if _, err := out.Write(data); err != nil {
+		return count, err
+	}
+	_, err = io.WriteString(out, webappTail)
+	return count, err
+}
+
+const webappStyle = `
+:root { color-scheme: light dark; --fg: #1f2328; --bg: #ffffff; --muted: #656d76; --accent: #0969da; --border: #d0d7de; }
+@media (prefers-color-scheme: dark) {
+  :root { --fg: #e6edf3; --bg: #0d1117; --muted: #8d96a0; --accent: #4493f8; --border: #30363d; }
+}
+body { font: 16px/1.5 system-ui, sans-serif; color: var(--fg); background: var(--bg); max-width: 50rem; margin: 0 auto; padding: 1rem; }
+a { color: var(--accent); text-decoration: none; }
+a:hover { text-decoration: underline; }
+input[type=search] { width: 100%; box-sizing: border-box; padding: .5rem; font: inherit; color: inherit; background: transparent; border: 1px solid var(--border); border-radius: 6px; }
+ul.bookmarks { list-style: none; padding: 0; }
+ul.bookmarks li { padding: .6rem 0; border-bottom: 1px solid var(--border); }
+.url, .note, .meta { color: var(--muted); font-size: .875rem; overflow-wrap: anywhere; }
+.icon { width: 16px; height: 16px; margin-right: .4rem; vertical-align: -2px; }
+.tag { display: inline-block; margin-right: .4rem; font-size: .8rem; cursor: pointer; }
+`
+
+const webappHead = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Bookmarks</title>
+<style>` + webappStyle + `</style>
+</head>
+<body>
+<h1>Bookmarks</h1>
+<input type="search" id="q" placeholder="Search titles, URLs, notes and tags (#tag)" autofocus>
+<p class="meta" id="count"></p>
+<ul class="bookmarks" id="list"></ul>
+<script id="data" type="application/json">`
+
+const webappTail = `</script>
+<script>
+const bookmarks = JSON.parse(document.getElementById("data").textContent);
+const icons = JSON.parse(document.getElementById("icons").textContent);
+const q = document.getElementById("q");
+const list = document.getElementById("list");
+const count = document.getElementById("count");
+
+function el(tag, cls, text) {
+  const e = document.createElement(tag);
+  if (cls) e.className = cls;
+  if (text) e.textContent = text;
+  return e;
+}
+
+function host(url) {
+  try { return new URL(url).hostname.toLowerCase(); } catch { return ""; }
+}
+
+function matches(b, terms) {
+  const hay = [b.title, b.url, b.note].join(" ").toLowerCase();
+  return terms.every(t => t.startsWith("#")
+    ? b.tags.some(tag => tag.toLowerCase() === t.slice(1))
+    : hay.includes(t) || b.tags.some(tag => tag.toLowerCase().includes(t)));
+}
+
+function render() {
+  const terms = q.value.toLowerCase().split(/\s+/).filter(Boolean);
+  const shown = bookmarks.filter(b => matches(b, terms));
+  list.replaceChildren(...shown.map(b => {
+    const li = el("li");
+    const icon = icons[host(b.url)];
+    if (icon) {
+      const img = el("img", "icon");
+      img.src = icon;
+      img.alt = "";
+      li.append(img);
+    }
+    const a = el("a", "", b.title || b.url);
+    a.href = b.url;
+    li.append(a, el("div", "url", b.url));
+    if (b.note) li.append(el("div", "note", b.note));
+    const meta = el("div", "meta");
+    for (const tag of b.tags) {
+      const t = el("span", "tag", "#" + tag);
+      t.onclick = () => { q.value = "#" + tag; render(); };
+      meta.append(t);
+    }
+    li.append(meta);
+    return li;
+  }));
+  count.textContent = shown.length + " of " + bookmarks.length + " bookmarks";
+}
+
+q.addEventListener("input", render);
+render();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Webhooks tell other services, such as n8n or Slack, about added,
+// deleted and retagged bookmarks. While a webhook exists, triggers queue
+// an event for every such change in webhook_events, so changes made
+// through the shell script or by undo are caught too. After each command,
+// and after each change made through serve, the queue is emptied and every
+// event is POSTed as JSON to the webhooks that want it, retrying with
+// backoff when the receiver is down. A webhook made with --secret signs
+// the body with HMAC-SHA256 in the X-Bmark-Signature header. Webhooks are
+// kept in the database whose changes they tell about, so those of a user
+// of serve, managed with --user, fire for the changes made with that
+// user's tokens.
+
+const webhooksSchema = `CREATE TABLE IF NOT EXISTS webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL UNIQUE,
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	last_status TEXT,
+	last_delivered_at INTEGER
+);`
+
+const webhookEventsSchema = `CREATE TABLE IF NOT EXISTS webhook_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event TEXT NOT NULL,
+	bookmark_id INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	title TEXT,
+	at INTEGER NOT NULL
+);`
+
+const webhookUsage = "Usage: importer-exporter webhook add --url URL [--events add,delete,tag] [--secret S] | list | rm ID|URL... | test ID|URL [--user USER]"
+
+// webhookEvents are the events a webhook can subscribe to: add when a
+// bookmark is saved or restored from the trash, delete when it is trashed
+// or removed, and tag when its tags change.
+var webhookEvents = []string{"add", "delete", "tag"}
+
+func webhookTrigger(name, event, on, when, id, url, title string) string {
+	return fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s
+		AFTER %s
+		WHEN EXISTS (SELECT 1 FROM webhooks)%s BEGIN
+		INSERT INTO webhook_events (event, bookmark_id, url, title, at)
+		VALUES ('%s', %s, %s, %s, strftime('%%s', 'now'));
+		END;`, name, on, when, event, id, url, title)
+}
+
+var webhookTriggers = []string{
+	webhookTrigger("webhook_bookmarks_insert", "add", "INSERT ON bookmarks", " AND NEW.deleted_at IS NULL",
+		"NEW.id", "NEW.url", "NEW.title"),
+	webhookTrigger("webhook_bookmarks_trash", "delete", "UPDATE OF deleted_at ON bookmarks",
+		" AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL", "NEW.id", "NEW.url", "NEW.title"),
+	webhookTrigger("webhook_bookmarks_restore", "add", "UPDATE OF deleted_at ON bookmarks",
+		" AND OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL", "NEW.id", "NEW.url", "NEW.title"),
+	webhookTrigger("webhook_bookmarks_delete", "delete", "DELETE ON bookmarks", " AND OLD.deleted_at IS NULL",
+		"OLD.id", "OLD.url", "OLD.title"),
+	// Undo may restore tag links before their bookmark, which then brings
+	// its own add event.
+	webhookTrigger("webhook_bookmark_tags_insert", "tag", "INSERT ON bookmark_tags",
+		" AND EXISTS (SELECT 1 FROM bookmarks WHERE id = NEW.bookmark_id)",
+		"NEW.bookmark_id", "(SELECT url FROM bookmarks WHERE id = NEW.bookmark_id)", "(SELECT title FROM bookmarks WHERE id = NEW.bookmark_id)"),
+	webhookTrigger("webhook_bookmark_tags_delete", "tag", "DELETE ON bookmark_tags",
+		" AND EXISTS (SELECT 1 FROM bookmarks WHERE id = OLD.bookmark_id)",
+		"OLD.bookmark_id", "(SELECT url FROM bookmarks WHERE id = OLD.bookmark_id)", "(SELECT title FROM bookmarks WHERE id = OLD.bookmark_id)"),
+	// A renamed tag changes the tags of every bookmark that has it.
+	`CREATE TRIGGER IF NOT EXISTS webhook_tags_rename
+		AFTER UPDATE OF tag ON tags
+		WHEN EXISTS (SELECT 1 FROM webhooks) AND OLD.tag != NEW.tag BEGIN
+		INSERT INTO webhook_events (event, bookmark_id, url, title, at)
+		SELECT 'tag', b.id, b.url, b.title, strftime('%s', 'now')
+		FROM bookmark_tags bt JOIN bookmarks b ON b.id = bt.bookmark_id WHERE bt.tag_id = NEW.id;
+		END;`,
+}
+
+type webhook struct {
+	ID            int64
+	URL           string
+	Events        []string
+	Secret        string
+	CreatedAt     int64
+	LastStatus    string
+	LastDelivered int64
+}
+
+func loadWebhooks(db *sql.DB) ([]webhook, error) {
+	var hooks []webhook
+	err := queryEach(db, `SELECT id, url, events, secret, created_at, COALESCE(last_status, ''), COALESCE(last_delivered_at, 0)
+		FROM webhooks ORDER BY id`, func(rows *sql.Rows) error {
+		var h webhook
+		var events string
+		if err := rows.Scan(&h.ID, &h.URL, &events, &h.Secret, &h.CreatedAt, &h.LastStatus, &h.LastDelivered); err != nil {
+			return err
+		}
+		h.Events = strings.Split(events, ",")
+		hooks = append(hooks, h)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// webhookRef is what a delete event tells about a bookmark that may be
+// gone.
+type webhookRef struct {
+	ID    int64  `json:"id"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+type webhookPayload struct {
+	Event    string `json:"event"`
+	At       string `json:"at"`
+	Bookmark any    `json:"bookmark,omitempty"`
+	// Text lets the payload be posted to a Slack incoming webhook as is.
+	Text string `json:"text"`
+}
+
+// webhookDelivery is one payload for one webhook.
+type webhookDelivery struct {
+	db   *sql.DB
+	hook webhook
+	body []byte
+}
+
+// takeWebhookEvents empties the queue of events and returns what to send
+// for them. Events of one bookmark are sent once per command, and a tag
+// event is left out when the bookmark was added too, as the add event
+// carries its tags.
+func takeWebhookEvents(db *sql.DB) ([]webhookDelivery, error) {
+	type event struct {
+		name  string
+		at    int64
+		ref   webhookRef
+		queue int64
+	}
+	var events []event
+	err := queryEach(db, "SELECT id, event, bookmark_id, url, COALESCE(title, ''), at FROM webhook_events ORDER BY id", func(rows *sql.Rows) error {
+		var e event
+		err := rows.Scan(&e.queue, &e.name, &e.ref.ID, &e.ref.URL, &e.ref.Title, &e.at)
+		events = append(events, e)
+		return err
+	})
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	if _, err := db.Exec("DELETE FROM webhook_events WHERE id <= ?", events[len(events)-1].queue); err != nil {
+		return nil, err
+	}
+	hooks, err := loadWebhooks(db)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for _, e := range events {
+		seen[e.name+" "+strconv.FormatInt(e.ref.ID, 10)] = true
+	}
+	var pending []event
+	sent := make(map[string]bool)
+	for _, e := range events {
+		key := e.name + " " + strconv.FormatInt(e.ref.ID, 10)
+		if sent[key] || e.name == "tag" && seen["add "+strconv.FormatInt(e.ref.ID, 10)] {
+			continue
+		}
+		sent[key] = true
+		pending = append(pending, e)
+		keys = append(keys, strconv.FormatInt(e.ref.ID, 10))
+	}
+	bookmarks, err := selectBookmarks(db, keys, "")
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]Bookmark)
+	for _, b := range bookmarks {
+		byID[b.ID] = b
+	}
+
+	var deliveries []webhookDelivery
+	for _, e := range pending {
+		payload := webhookPayload{Event: e.name, At: formatTime(e.at), Bookmark: e.ref}
+		if b, ok := byID[e.ref.ID]; ok && e.name != "delete" {
+			payload.Bookmark = newJSONBookmark(b)
+		}
+		payload.Text = webhookText(e.name, e.ref)
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hooks {
+			if slices.Contains(h.Events, e.name) {
+				deliveries = append(deliveries, webhookDelivery{db: db, hook: h, body: body})
+			}
+		}
+	}
+	return deliveries, nil
+}
+
+func webhookText(event string, b webhookRef) string {
+	verb := map[string]string{"add": "Saved", "delete": "Deleted", "tag": "Retagged"}[event]
+	if b.Title == "" {
+		return fmt.Sprintf("%s %s", verb, b.URL)
+	}
+	return fmt.Sprintf("%s %s: %s", verb, b.Title, b.URL)
+}
+
+// webhookBackoff is how long to wait before each retry of a delivery.
+var webhookBackoff = []time.Duration{time.Second, 4 * time.Second, 16 * time.Second}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// deliver POSTs the payload, retrying on network errors, 429 and 5xx,
+// and records how it went on the webhook.
+func (d webhookDelivery) deliver() error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = d.post()
+		if err == nil || !retry || attempt == len(webhookBackoff) {
+			break
+		}
+		time.Sleep(webhookBackoff[attempt])
+	}
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+	if _, dbErr := d.db.Exec("UPDATE webhooks SET last_status = ?, last_delivered_at = ? WHERE id = ?",
+		status, time.Now().Unix(), d.hook.ID); dbErr != nil {
+		log.Printf("Failed to record delivery to %s: %v", d.hook.URL, dbErr)
+	}
+	return err
+}
+
+// post sends the payload once and reports whether a failure is worth a
+// retry.
+func (d webhookDelivery) post() (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, d.hook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bmark-webhook")
+	if d.hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(d.hook.Secret))
+		mac.Write(d.body)
+		req.Header.Set("X-Bmark-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return false, nil
+}
+
+// sendDeliveries sends deliveries in order. Failures are logged, as the
+// change they tell about is made already; once a webhook failed, the rest
+// of its deliveries are skipped so that an import does not wait out the
+// backoff for every bookmark.
+func sendDeliveries(deliveries []webhookDelivery) {
+	failed := make(map[int64]bool)
+	for _, d := range deliveries {
+		if failed[d.hook.ID] {
+			continue
+		}
+		if err := d.deliver(); err != nil {
+			log.Printf("Failed to notify webhook %s, skipping its other events: %v", d.hook.URL, err)
+			failed[d.hook.ID] = true
+		}
+	}
+}
+
+// deliverWebhooks sends the queued events.
+func deliverWebhooks(db *sql.DB) {
+	deliveries, err := takeWebhookEvents(db)
+	if err != nil {
+		log.Printf("Failed to read webhook events: %v", err)
+		return
+	}
+	sendDeliveries(deliveries)
+}
+
+// webhookCommand manages the webhooks of the owner, or with --user those
+// of a user.
+func webhookCommand(db *sql.DB, dbFile string, args []string) {
+	if len(args) < 1 {
+		fmt.Println(webhookUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("webhook "+args[0], flag.ExitOnError)
+	hookURL := fs.String("url", "", "address to POST events to")
+	events := fs.String("events", strings.Join(webhookEvents, ","), "comma-separated events: "+strings.Join(webhookEvents, ", "))
+	secret := fs.String("secret", "", "sign payloads with HMAC-SHA256 of this secret")
+	user := fs.String("user", "", "manage the webhooks of this user, see bmark user add")
+	keys := parseInterspersed(fs, args[1:])
+
+	if *user != "" {
+		id, err := userID(db, *user)
+		if err != nil {
+			log.Fatalf("Failed to read users: %v", err)
+		}
+		if id == 0 {
+			log.Fatalf("No user %s, see bmark user add", *user)
+		}
+		userDB, err := openDatabase(userDatabasePath(dbFile, *user))
+		if err != nil {
+			log.Fatalf("Failed to open database of %s: %v", *user, err)
+		}
+		defer userDB.Close()
+		db = userDB
+	}
+
+	switch args[0] {
+	case "add":
+		u, err := url.Parse(*hookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(keys) > 0 {
+			fmt.Println(webhookUsage)
+			os.Exit(1)
+		}
+		var subscribed []string
+		for _, event := range strings.Split(*events, ",") {
+			event = strings.TrimSpace(event)
+			if !slices.Contains(webhookEvents, event) {
+				log.Fatalf("Unknown event %q, use %s", event, strings.Join(webhookEvents, ", "))
+			}
+			if !slices.Contains(subscribed, event) {
+				subscribed = append(subscribed, event)
+			}
+		}
+		res, err := db.Exec("INSERT INTO webhooks (url, events, secret, created_at) VALUES (?, ?, ?, ?)",
+			*hookURL, strings.Join(subscribed, ","), *secret, time.Now().Unix())
+		if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+			log.Fatalf("There is a webhook for %s already, remove it first", *hookURL)
+		}
+		if err != nil {
+			log.Fatalf("Failed to add webhook: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		fmt.Printf("Added webhook %d for %s\n", id, strings.Join(subscribed, ","))
+	case "list":
+		hooks, err := loadWebhooks(db)
+		if err != nil {
+			log.Fatalf("Failed to list webhooks: %v", err)
+		}
+		if len(hooks) == 0 {
+			fmt.Fprintln(os.Stderr, "No webhooks found.")
+			os.Exit(1)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, h := range hooks {
+			last := "never sent"
+			if h.LastDelivered > 0 {
+				last = time.Unix(h.LastDelivered, 0).Format("2006-01-02 15:04") + " " + h.LastStatus
+			}
+			signed := ""
+			if h.Secret != "" {
+				signed = "signed"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", h.ID, h.URL, strings.Join(h.Events, ","), signed, last)
+		}
+		tw.Flush()
+	case "rm":
+		if len(keys) == 0 {
+			fmt.Println(webhookUsage)
+			os.Exit(1)
+		}
+		for _, key := range keys {
+			res, err := db.Exec("DELETE FROM webhooks WHERE CAST(id AS TEXT) = ? OR url = ?", key, key)
+			if err != nil {
+				log.Fatalf("Failed to remove webhook %s: %v", key, err)
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				fmt.Printf("No webhook %s\n", key)
+				os.Exit(1)
+			}
+		}
+		// Events queued for no one are dropped with the last webhook.
+		if _, err := db.Exec("DELETE FROM webhook_events WHERE NOT EXISTS (SELECT 1 FROM webhooks)"); err != nil {
+			log.Fatalf("Failed to clear webhook events: %v", err)
+		}
+		fmt.Printf("Removed %d webhook(s)\n", len(keys))
+	case "test":
+		if len(keys) != 1 {
+			fmt.Println(webhookUsage)
+			os.Exit(1)
+		}
+		hooks, err := loadWebhooks(db)
+		if err != nil {
+			log.Fatalf("Failed to read webhooks: %v", err)
+		}
+		i := slices.IndexFunc(hooks, func(h webhook) bool { return strconv.FormatInt(h.ID, 10) == keys[0] || h.URL == keys[0] })
+		if i < 0 {
+			fmt.Printf("No webhook %s\n", keys[0])
+			os.Exit(1)
+		}
+		body, err := json.Marshal(webhookPayload{Event: "ping", At: formatTime(time.Now().Unix()), Text: "bmark webhook test"})
+		if err != nil {
+			log.Fatalf("Failed to encode payload: %v", err)
+		}
+		if err := (webhookDelivery{db: db, hook: hooks[i], body: body}).deliver(); err != nil {
+			log.Fatalf("Failed to notify webhook %s: %v", hooks[i].URL, err)
+		}
+		fmt.Printf("Sent a ping to %s\n", hooks[i].URL)
+	default:
+		fmt.Printf("Unknown webhook command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeXBEL writes an XBEL 1.0 document as read by qutebrowser and KDE
+// tools. Bookmarks imported with --folders table are nested in their
+// folders; everything else sits at the top level. XBEL has no tags, so
+// they are kept in a bmark <metadata> element.
+func writeXBEL(db *sql.DB, out io.Writer, opts exportOptions) (int, error) {
+	folders, err := loadFolders(db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load folders: %w", err)
+	}
+
+	// The tree is written depth first, so bookmarks are collected per
+	// folder before anything is written.
+	byFolder := make(map[int64][]Bookmark)
+	count := 0
+	err = forEachBookmark(db, opts.Filter, func(b Bookmark) error {
+		if _, ok := folders[b.FolderID]; !ok {
+			b.FolderID = 0
+		}
+		byFolder[b.FolderID] = append(byFolder[b.FolderID], b)
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	x := &xbelWriter{out: out, folders: folders, children: folderChildren(folders), bookmarks: byFolder}
+	fmt.Fprintln(out, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(out, `<!DOCTYPE xbel PUBLIC "+//IDN python.org//DTD XML Bookmark Exchange Language 1.0//EN//XML" "http://pyxml.sourceforge.net/topics/dtds/xbel.dtd">`)
+	fmt.Fprintln(out, `<xbel version="1.0">`)
+	x.writeFolder(0, 1)
+	_, err = fmt.Fprintln(out, `</xbel>`)
+	return count, err
+}
+
+type xbelWriter struct {
+	out       io.Writer
+	folders   map[int64]folder
+	children  map[int64][]int64
+	bookmarks map[int64][]Bookmark
+}
+
+// writeFolder writes the contents of folder id at the given depth: its
+// bookmarks first, then its subfolders.
+func (x *xbelWriter) writeFolder(id int64, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, b := range x.bookmarks[id] {
+		fmt.Fprintf(x.out, `%s<bookmark href="%s" added="%s" modified="%s"`, indent, xmlEscape(b.URI), formatTime(b.CreatedAt), formatTime(b.UpdatedAt))
+		if b.LastVisit > 0 {
+			fmt.Fprintf(x.out, ` visited="%s"`, formatTime(b.LastVisit))
+		}
+		fmt.Fprintln(x.out, ">")
+		fmt.Fprintf(x.out, "%s  <title>%s</title>\n", indent, xmlEscape(b.Title))
+		if b.Note != "" {
+			fmt.Fprintf(x.out, "%s  <desc>%s</desc>\n", indent, xmlEscape(b.Note))
+		}
+		if len(b.Tags) > 0 {
+			fmt.Fprintf(x.out, "%s  <info><metadata owner=\"bmark\" tags=\"%s\"/></info>\n", indent, xmlEscape(strings.Join(b.Tags, ",")))
+		}
+		fmt.Fprintf(x.out, "%s</bookmark>\n", indent)
+	}
+	for _, child := range x.children[id] {
+		fmt.Fprintf(x.out, "%s<folder>\n", indent)
+		fmt.Fprintf(x.out, "%s  <title>%s</title>\n", indent, xmlEscape(x.folders[child].Name))
+		x.writeFolder(child, depth+1)
+		fmt.Fprintf(x.out, "%s</folder>\n", indent)
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
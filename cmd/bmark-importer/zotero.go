@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const zoteroDateLayout = "2006-01-02 15:04:05"
+
+// parseZoteroCSV reads a Zotero "Export Collection… > CSV" file. The CSV
+// export carries no collection membership, so the item's manual and
+// automatic tags are used instead.
+func parseZoteroCSV(input io.Reader, jobs chan<- Job) error {
+	r := csv.NewReader(input)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	if _, ok := columns["Url"]; !ok {
+		return fmt.Errorf("not a Zotero CSV export: no Url column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	now := time.Now().Unix()
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV record: %w", err)
+		}
+
+		uri := field(record, "Url")
+		if uri == "" {
+			continue
+		}
+
+		var tags []string
+		for _, column := range []string{"Manual Tags", "Automatic Tags"} {
+			tags = append(tags, splitZoteroTags(field(record, column))...)
+		}
+
+		createdAt := parseZoteroDate(field(record, "Date Added"), now)
+		jobs <- Job{
+			URI:       uri,
+			Title:     field(record, "Title"),
+			Note:      field(record, "Abstract Note"),
+			CreatedAt: createdAt,
+			UpdatedAt: parseZoteroDate(field(record, "Date Modified"), createdAt),
+			Tags:      tags,
+		}
+	}
+
+	return nil
+}
+
+func splitZoteroTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func parseZoteroDate(s string, defaultValue int64) int64 {
+	if t, err := time.Parse(zoteroDateLayout, s); err == nil {
+		return t.Unix()
+	}
+	return defaultValue
+}
+
+type zoteroResource struct {
+	Resource string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# resource,attr"`
+}
+
+type zoteroNode struct {
+	XMLName       xml.Name
+	About         string           `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	ItemType      string           `xml:"http://www.zotero.org/namespaces/export# itemType"`
+	Title         string           `xml:"http://purl.org/dc/elements/1.1/ title"`
+	Abstract      string           `xml:"http://purl.org/dc/terms/ abstract"`
+	URI           string           `xml:"identifier>URI>value"`
+	DateSubmitted string           `xml:"http://purl.org/dc/terms/ dateSubmitted"`
+	Modified      string           `xml:"http://purl.org/dc/terms/ modified"`
+	Subjects      []zoteroSubject  `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Links         []zoteroResource `xml:"http://purl.org/rss/1.0/modules/link/ link"`
+	Parts         []zoteroResource `xml:"http://purl.org/dc/terms/ hasPart"`
+}
+
+// zoteroSubject is either a plain <dc:subject> string or an automatic tag
+// wrapped in <z:AutomaticTag><rdf:value>.
+type zoteroSubject struct {
+	Text  string `xml:",chardata"`
+	Value string `xml:"AutomaticTag>value"`
+}
+
+// parseZoteroRDF reads a Zotero RDF export. Every item or attachment with
+// a URL becomes a bookmark tagged with the names of the collections that
+// contain it (or its parent item), with the abstract stored as the note.
+func parseZoteroRDF(input io.Reader, jobs chan<- Job) error {
+	var doc struct {
+		Nodes []zoteroNode `xml:",any"`
+	}
+	if err := xml.NewDecoder(input).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to parse RDF: %w", err)
+	}
+
+	nodes := make(map[string]*zoteroNode, len(doc.Nodes))
+	parents := make(map[string]string)
+	collections := make(map[string][]string)
+	for i := range doc.Nodes {
+		node := &doc.Nodes[i]
+		nodes[node.About] = node
+		for _, link := range node.Links {
+			parents[link.Resource] = node.About
+		}
+		if node.XMLName.Local == "Collection" {
+			for _, part := range node.Parts {
+				collections[part.Resource] = append(collections[part.Resource], strings.TrimSpace(node.Title))
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	seen := make(map[string]bool)
+	for _, node := range doc.Nodes {
+		if node.XMLName.Local == "Collection" {
+			continue
+		}
+		uri := strings.TrimSpace(node.URI)
+		if uri == "" || seen[uri] {
+			continue
+		}
+		seen[uri] = true
+
+		title := strings.TrimSpace(node.Title)
+		note := strings.TrimSpace(node.Abstract)
+		tags := append([]string{}, collections[node.About]...)
+		for _, subject := range node.Subjects {
+			tag := strings.TrimSpace(subject.Text)
+			if subject.Value != "" {
+				tag = strings.TrimSpace(subject.Value)
+			}
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+
+		if parent, ok := nodes[parents[node.About]]; ok {
+			if parent.Title != "" {
+				title = strings.TrimSpace(parent.Title)
+			}
+			if note == "" {
+				note = strings.TrimSpace(parent.Abstract)
+			}
+			tags = append(tags, collections[parent.About]...)
+		}
+
+		createdAt := parseZoteroDate(node.DateSubmitted, now)
+		jobs <- Job{
+			URI:       uri,
+			Title:     title,
+			Note:      note,
+			CreatedAt: createdAt,
+			UpdatedAt: parseZoteroDate(node.Modified, createdAt),
+			Tags:      tags,
+		}
+	}
+
+	return nil
+}
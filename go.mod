@@ -3,3 +3,13 @@ module bmark-importer
 go 1.24.3
 
 require github.com/mattn/go-sqlite3 v1.14.28
+
+require (
+	filippo.io/age v1.2.1
+	golang.org/x/net v0.40.0
+)
+
+require (
+	golang.org/x/crypto v0.38.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)